@@ -17,8 +17,11 @@ import (
 	"0x53/internal/core"
 	"0x53/internal/dns"
 	"0x53/internal/ipc" // Added import
+	"0x53/internal/metrics"
 	sys "0x53/internal/os"
+	"0x53/internal/querylog"
 	"0x53/internal/service"
+	"0x53/internal/timeseries"
 	"0x53/internal/ui"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -39,6 +42,14 @@ func main() {
 		runDaemon()
 	case "tui", "client":
 		runClient()
+	case "import-hosts":
+		runImportHosts(os.Args[2:])
+	case "queries":
+		runQueries(os.Args[2:])
+	case "history":
+		runHistory(os.Args[2:])
+	case "reload":
+		runReload()
 	case "run", "monolith":
 		runMonolith()
 	default:
@@ -46,7 +57,7 @@ func main() {
 		if strings.HasPrefix(mode, "-") {
 			runMonolith()
 		} else {
-			fmt.Printf("Unknown command: %s\nUsage: sinkhole [run|daemon|tui]\n", mode)
+			fmt.Printf("Unknown command: %s\nUsage: sinkhole [run|daemon|tui|import-hosts|queries|history|reload]\n", mode)
 			os.Exit(1)
 		}
 	}
@@ -72,6 +83,227 @@ func runClient() {
 	}
 }
 
+// --- HOSTS IMPORT (via the daemon) ---
+func runImportHosts(args []string) {
+	fs := flag.NewFlagSet("import-hosts", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Only report what would change")
+	overwrite := fs.Bool("overwrite", false, "Replace conflicting local records")
+	link := fs.Bool("link", false, "Keep the file linked and re-read it on every reload")
+	unlink := fs.Bool("unlink", false, "Stop re-reading a linked file")
+	fs.Usage = func() {
+		fmt.Println("Usage: sinkhole import-hosts [-dry-run] [-overwrite] [-link|-unlink] [file, default /etc/hosts]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	// The daemon runs elsewhere, resolve relative paths here
+	path := fs.Arg(0)
+	if path != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+
+	client, err := ipc.NewClient(SocketPath)
+	if err != nil {
+		fmt.Printf("Failed to connect to daemon at %s: %v\n", SocketPath, err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	res, err := client.ImportHosts(core.HostsImportOptions{
+		Path:      path,
+		DryRun:    *dryRun,
+		Overwrite: *overwrite,
+		Link:      *link,
+		Unlink:    *unlink,
+	})
+	if err != nil {
+		fmt.Printf("Import failed: %v\n", err)
+		os.Exit(1)
+	}
+	if *unlink {
+		if *dryRun {
+			fmt.Printf("Would unlink %s\n", res.Path)
+		} else {
+			fmt.Printf("Unlinked %s\n", res.Path)
+		}
+		return
+	}
+
+	for _, rec := range res.Added {
+		fmt.Printf("+ %-5s %-40s %s\n", rec.Type, rec.Domain, rec.Value)
+	}
+	for _, c := range res.Conflicts {
+		action := "kept"
+		if c.Replaced {
+			action = "replaced"
+		}
+		fmt.Printf("! %-5s %-40s %s conflicts with %s (%s)\n", c.Imported.Type, c.Imported.Domain, c.Imported.Value, c.Existing.Value, action)
+	}
+
+	verb := "Imported"
+	if *dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d records from %s: %d unchanged, %d conflicts, %d invalid entries\n",
+		verb, len(res.Added), res.Path, res.Unchanged, len(res.Conflicts), res.Invalid)
+}
+
+// --- QUERY LOG (via the daemon) ---
+func runQueries(args []string) {
+	fs := flag.NewFlagSet("queries", flag.ExitOnError)
+	client := fs.String("client", "", "Only queries from this client IP")
+	domain := fs.String("domain", "", "Only domains containing this text")
+	status := fs.String("status", "", "Only this status (allowed, blocked, local, rebind, refused, throttled, error)")
+	limit := fs.Int("n", 50, "Number of events to show")
+	fs.Usage = func() {
+		fmt.Println("Usage: sinkhole queries [-client ip] [-domain text] [-status s] [-n count]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	c, err := ipc.NewClient(SocketPath)
+	if err != nil {
+		fmt.Printf("Failed to connect to daemon at %s: %v\n", SocketPath, err)
+		os.Exit(1)
+	}
+	defer c.Close()
+
+	events, err := c.GetQueryEvents(core.QueryFilter{
+		Client: *client,
+		Domain: *domain,
+		Status: core.QueryStatus(*status),
+		Limit:  *limit,
+	})
+	if err != nil {
+		fmt.Printf("Query log failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Oldest first, like a log
+	for i := len(events) - 1; i >= 0; i-- {
+		printEvent(events[i], "15:04:05")
+	}
+}
+
+// --- CONFIG RELOAD (via the daemon) ---
+func runReload() {
+	c, err := ipc.NewClient(SocketPath)
+	if err != nil {
+		fmt.Printf("Failed to connect to daemon at %s: %v\n", SocketPath, err)
+		os.Exit(1)
+	}
+	defer c.Close()
+
+	res, err := c.Reload()
+	if err != nil {
+		fmt.Printf("Reload failed: %v\n", err)
+		os.Exit(1)
+	}
+	switch {
+	case res.Path == "":
+		fmt.Println("No configuration file, blocklists reloaded")
+	case len(res.Changed) == 0:
+		fmt.Printf("Reloaded %s: no changes\n", res.Path)
+	default:
+		fmt.Printf("Reloaded %s: %s\n", res.Path, strings.Join(res.Changed, ", "))
+	}
+	if res.Rebound {
+		fmt.Println("Listeners moved to the new address")
+	}
+	if len(res.Restart) > 0 {
+		fmt.Printf("Restart the daemon to apply: %s\n", strings.Join(res.Restart, ", "))
+	}
+}
+
+// --- QUERY HISTORY (via the daemon) ---
+func runHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	client := fs.String("client", "", "Only queries from this client IP")
+	domain := fs.String("domain", "", "Only this exact domain")
+	status := fs.String("status", "", "Only this status (allowed, blocked, local, rebind, refused, throttled, error)")
+	search := fs.String("search", "", "Only queries whose domain, client, rule or upstream contain this text")
+	from := fs.String("from", "", "Start time, \"2006-01-02 15:04\" (local time)")
+	to := fs.String("to", "", "End time, same format")
+	limit := fs.Int("n", 50, "Events per page")
+	pageNum := fs.Int("page", 1, "Page to show, newest events first")
+	fs.Usage = func() {
+		fmt.Println("Usage: sinkhole history [-client ip] [-domain name] [-status s] [-search text] [-from time] [-to time] [-n count] [-page n]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *limit < 1 {
+		*limit = 1
+	}
+	if *pageNum < 1 {
+		*pageNum = 1
+	}
+
+	q := core.HistoryQuery{
+		Client: *client,
+		Domain: *domain,
+		Status: core.QueryStatus(*status),
+		Search: *search,
+		Limit:  *limit,
+		Offset: (*pageNum - 1) * *limit,
+	}
+	var err error
+	if q.From, err = parseHistoryTime(*from); err != nil {
+		fmt.Printf("Invalid -from: %v\n", err)
+		os.Exit(1)
+	}
+	if q.To, err = parseHistoryTime(*to); err != nil {
+		fmt.Printf("Invalid -to: %v\n", err)
+		os.Exit(1)
+	}
+
+	c, err := ipc.NewClient(SocketPath)
+	if err != nil {
+		fmt.Printf("Failed to connect to daemon at %s: %v\n", SocketPath, err)
+		os.Exit(1)
+	}
+	defer c.Close()
+
+	page, err := c.QueryHistory(q)
+	if err != nil {
+		fmt.Printf("History query failed: %v\n", err)
+		os.Exit(1)
+	}
+	for i := len(page.Events) - 1; i >= 0; i-- {
+		printEvent(page.Events[i], "2006-01-02 15:04:05")
+	}
+	pages := (page.Total + *limit - 1) / *limit
+	fmt.Printf("Page %d of %d, %d matching queries\n", *pageNum, max(pages, 1), page.Total)
+}
+
+// parseHistoryTime parses a -from/-to flag, empty meaning unbounded.
+func parseHistoryTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not like \"2006-01-02 15:04\"", s)
+}
+
+// printEvent prints one query event as a line of columns.
+func printEvent(ev core.QueryEvent, timeLayout string) {
+	status := string(ev.Status)
+	if ev.Cached {
+		status += " (cache)"
+	}
+	detail := ev.Rule
+	if detail == "" {
+		detail = ev.Upstream
+	}
+	fmt.Printf("%s %-15s %-5s %-40s %-16s %-8s %6dms %s\n",
+		ev.Time.Local().Format(timeLayout), ev.Client, ev.Type, ev.Domain, status, ev.Rcode, ev.Latency.Milliseconds(), detail)
+}
+
 // --- DAEMON MODE (Root Required) ---
 func runDaemon() {
 	requireRoot()
@@ -115,6 +347,10 @@ func runDaemon() {
 	blMgr := blocklist.NewManager(cfg)
 	srv := dns.NewServer(cfg, blMgr)
 	svc := service.NewAppService(srv, blMgr)
+
+	osConfig := getOSConfig()
+	srv.SetUpstreamDetector(osConfig.DetectUpstreams)
+	srv.SetNeighborLookup(sys.NewNeighborTable().Lookup)
 	
 	// Setup File Logging (Same as Monolith)
 	if err := os.MkdirAll(filepath.Dir(cfg.LogPath), 0755); err != nil {
@@ -144,8 +380,42 @@ func runDaemon() {
 	srv.SetLogger(logFunc)
 	blMgr.SetLogger(logFunc)
 
+	// Wire Query Events
+	srv.AddQuerySink(svc)
+	if sink := openQueryLog(cfg.QueryLogPath); sink != nil {
+		defer sink.Close()
+		srv.AddQuerySink(sink)
+	}
+	if store := openHistory(cfg); store != nil {
+		defer store.Close()
+		srv.AddQuerySink(store)
+		svc.SetHistory(store)
+	}
+	if series := openStatsSeries(cfg); series != nil {
+		defer series.Close()
+		srv.AddQuerySink(series)
+		svc.SetStatsSeries(series)
+	}
+
+	// Prometheus Metrics
+	var countIPC func(string)
+	if cfg.MetricsEnabled {
+		reg := metrics.New(srv, blMgr)
+		srv.AddQuerySink(reg)
+		srv.SetExchangeObserver(reg.ObserveExchange)
+		countIPC = reg.CountIPC
+
+		metricsSrv, err := metrics.Serve(cfg.MetricsAddr, reg)
+		if err != nil {
+			fmt.Printf("Failed to start metrics listener: %v\n", err)
+		} else {
+			defer metricsSrv.Close()
+			fmt.Printf("Metrics at http://%s/metrics\n", cfg.MetricsAddr)
+		}
+	}
+
 	// Start IPC Server
-	listener, err := ipc.StartServer(svc, SocketPath)
+	listener, err := ipc.StartServer(svc, SocketPath, countIPC)
 	if err != nil {
 		fmt.Printf("Failed to start IPC server: %v\n", err)
 		os.Exit(1)
@@ -153,15 +423,15 @@ func runDaemon() {
 	defer listener.Close()
 	fmt.Printf("IPC active at %s\n", SocketPath)
 
-	// Load Blocklists
+	// Load Blocklists. Not svc.Reload: that also re-applies the config
+	// file, racing Start below.
 	go func() {
-		if err := svc.Reload(); err != nil {
+		if err := blMgr.LoadBlocklists(context.Background()); err != nil {
 			logFunc(fmt.Sprintf("Blocklist load error: %v", err))
 		}
 	}()
 	
 	// Start DNS
-	osConfig := getOSConfig()
 	fmt.Println("Unlocking Port 53...")
 	osConfig.UnlockPort()
 
@@ -236,15 +506,16 @@ func runMonolith() {
 	// Create Core Components
 	blMgr := blocklist.NewManager(cfg)
 	srv := dns.NewServer(cfg, blMgr)
+	srv.SetUpstreamDetector(osConfig.DetectUpstreams)
+	srv.SetNeighborLookup(sys.NewNeighborTable().Lookup)
 
 	// Create Service Layer (The Brain)
 	svc := service.NewAppService(srv, blMgr)
 
 	// Load Blocklists asynchronously
 	fmt.Println("Loading blocklists...")
-	// Use Service to reload (it wraps manager)
 	go func() {
-		if err := svc.Reload(); err != nil {
+		if err := blMgr.LoadBlocklists(context.Background()); err != nil {
 			fmt.Printf("Error loading blocklists: %v\n", err)
 		}
 	}()
@@ -316,6 +587,23 @@ func runMonolith() {
 	srv.SetLogger(logFunc)
 	blMgr.SetLogger(logFunc)
 
+	// Wire Query Events
+	srv.AddQuerySink(svc)
+	if sink := openQueryLog(cfg.QueryLogPath); sink != nil {
+		defer sink.Close()
+		srv.AddQuerySink(sink)
+	}
+	if store := openHistory(cfg); store != nil {
+		defer store.Close()
+		srv.AddQuerySink(store)
+		svc.SetHistory(store)
+	}
+	if series := openStatsSeries(cfg); series != nil {
+		defer series.Close()
+		srv.AddQuerySink(series)
+		svc.SetStatsSeries(series)
+	}
+
 	// 7. Setup TUI Debug Logging (Bubbletea)
 	if f, err := tea.LogToFile("debug.log", "debug"); err != nil {
 		fmt.Println("fatal: could not create debug logs:", err)
@@ -347,6 +635,49 @@ func runMonolith() {
 	time.Sleep(500 * time.Millisecond)
 }
 
+// openQueryLog opens the JSON lines query log, nil if disabled or failing.
+func openQueryLog(path string) *querylog.FileSink {
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fmt.Printf("Failed to create query log dir: %v\n", err)
+		return nil
+	}
+	sink, err := querylog.NewFileSink(path)
+	if err != nil {
+		fmt.Printf("Failed to open query log %s: %v\n", path, err)
+		return nil
+	}
+	fmt.Printf("Query Log: %s\n", path)
+	return sink
+}
+
+// openHistory opens the persistent query history, nil if disabled or failing.
+func openHistory(cfg *config.Config) *querylog.Store {
+	if cfg.QueryHistoryDays <= 0 {
+		return nil
+	}
+	dir := filepath.Join(cfg.CacheDir, "history")
+	store, err := querylog.OpenStore(dir, time.Duration(cfg.QueryHistoryDays)*24*time.Hour)
+	if err != nil {
+		fmt.Printf("Failed to open query history %s: %v\n", dir, err)
+		return nil
+	}
+	return store
+}
+
+// openStatsSeries opens the query counters kept over time, nil if failing.
+func openStatsSeries(cfg *config.Config) *timeseries.Store {
+	dir := filepath.Join(cfg.CacheDir, "stats")
+	series, err := timeseries.Open(dir)
+	if err != nil {
+		fmt.Printf("Failed to open statistics history %s: %v\n", dir, err)
+		return nil
+	}
+	return series
+}
+
 func getOSConfig() core.DNSConfigurator {
 	if runtime.GOOS == "windows" {
 		return sys.NewWindowsConfigurator()
@@ -0,0 +1,97 @@
+package blocklist
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// ipTrie is a binary prefix trie of blocked networks. Each node carries the
+// mask of the sources listing the prefix ending there, so a lookup walks at
+// most 32 (IPv4) or 128 (IPv6) nodes regardless of the list size.
+type ipTrie struct {
+	v4, v6 *ipNode
+	size   int // Distinct prefixes
+}
+
+type ipNode struct {
+	child [2]*ipNode
+	mask  uint64
+}
+
+func newIPTrie() *ipTrie {
+	return &ipTrie{v4: &ipNode{}, v6: &ipNode{}}
+}
+
+func (t *ipTrie) root(addr netip.Addr) *ipNode {
+	if addr.Is4() {
+		return t.v4
+	}
+	return t.v6
+}
+
+// insert adds prefix for the sources in mask.
+func (t *ipTrie) insert(prefix netip.Prefix, mask uint64) {
+	prefix = prefix.Masked()
+	addr := prefix.Addr()
+	raw := addr.AsSlice()
+
+	n := t.root(addr)
+	for i := 0; i < prefix.Bits(); i++ {
+		b := raw[i/8] >> (7 - i%8) & 1
+		if n.child[b] == nil {
+			n.child[b] = &ipNode{}
+		}
+		n = n.child[b]
+	}
+	if n.mask == 0 {
+		t.size++
+	}
+	n.mask |= mask
+}
+
+// lookup returns the mask of every source with a prefix covering addr.
+func (t *ipTrie) lookup(addr netip.Addr) uint64 {
+	addr = addr.Unmap()
+	raw := addr.AsSlice()
+
+	n := t.root(addr)
+	mask := n.mask
+	for i := 0; i < len(raw)*8; i++ {
+		n = n.child[raw[i/8]>>(7-i%8)&1]
+		if n == nil {
+			break
+		}
+		mask |= n.mask
+	}
+	return mask
+}
+
+// parseIPLine reads a CIDR or a bare address from an "ip" format line.
+// Bare addresses block just themselves (/32 or /128).
+func parseIPLine(line string) (netip.Prefix, bool) {
+	if idx := strings.IndexAny(line, "#;"); idx != -1 {
+		line = line[:idx]
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return netip.Prefix{}, false
+	}
+
+	if strings.Contains(line, "/") {
+		prefix, err := netip.ParsePrefix(line)
+		if err != nil {
+			return netip.Prefix{}, false
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix, true
+	}
+
+	addr, err := netip.ParseAddr(line)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), true
+}
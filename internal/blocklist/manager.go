@@ -7,7 +7,10 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"math/bits"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"strings"
@@ -15,18 +18,38 @@ import (
 	"time"
 
 	"0x53/internal/config"
+	"0x53/internal/core"
 )
 
+// maxSources is how many sources can be told apart per domain (bits of a mask).
+const maxSources = 64
+
 // Manager implements core.BlocklistManager.
 type Manager struct {
 	cfg     *config.Config
-	domains map[string]struct{}
+	// domains maps each blocked domain to a bitmask of the sources listing it.
+	// Bit i refers to sources[i].
+	domains map[string]uint64
+	ips     *ipTrie // Networks of "ip" format sources, same masks as domains
+	sources []config.BlocklistSource // Snapshot of cfg.Blocklists at load time
+	// enabled masks the globally enabled sources: sources only referenced by
+	// client groups are loaded too, but must not apply to everyone.
+	enabled uint64
+	groups  map[string]groupPolicy // Client group policies, by name
+	fetches map[string]core.SourceStats // By source name, from the last load
 	// Allowlist is now directly in cfg, but for O(1) lookup we keep a runtime map.
 	allowlistMap map[string]struct{}
+	denylistMap  map[string]struct{} // Runtime copy of cfg.Denylist
 	logFunc func(string)
 	mu      sync.RWMutex
 }
 
+// groupPolicy is the compiled form of a config.ClientGroup.
+type groupPolicy struct {
+	mask  uint64              // Sources applied to the group
+	allow map[string]struct{} // Group allowlist, on top of the global one
+}
+
 // SetLogger sets the logging callback.
 func (m *Manager) SetLogger(fn func(string)) {
 	m.mu.Lock()
@@ -46,8 +69,10 @@ func (m *Manager) log(format string, args ...interface{}) {
 func NewManager(cfg *config.Config) *Manager {
 	mgr := &Manager{
 		cfg:          cfg,
-		domains:      make(map[string]struct{}),
+		domains:      make(map[string]uint64),
+		ips:          newIPTrie(),
 		allowlistMap: make(map[string]struct{}),
+		denylistMap:  make(map[string]struct{}),
 	}
 	mgr.syncAllowlistMap()
 	return mgr
@@ -58,14 +83,23 @@ func (m *Manager) syncAllowlistMap() {
 	for _, domain := range m.cfg.Allowlist {
 		m.allowlistMap[strings.ToLower(domain)] = struct{}{}
 	}
+	m.denylistMap = make(map[string]struct{})
+	for _, domain := range m.cfg.Denylist {
+		m.denylistMap[strings.ToLower(domain)] = struct{}{}
+	}
 }
 
-// LoadBlocklists fetches and parses all enabled blocklists.
+// denylistSource is reported for domains blocked by the denylist.
+var denylistSource = config.BlocklistSource{Name: "Denylist", Enabled: true}
+
+// LoadBlocklists fetches and parses all enabled blocklists, and the
+// sources used by client groups.
 func (m *Manager) LoadBlocklists(ctx context.Context) error {
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 
-	newMap := make(map[string]struct{})
+	newMap := make(map[string]uint64)
+	newIPs := newIPTrie()
 
 	// Ensure cache dir exists
 	if err := os.MkdirAll(m.cfg.CacheDir, 0755); err != nil {
@@ -77,24 +111,73 @@ func (m *Manager) LoadBlocklists(ctx context.Context) error {
 	var duplicates int64
 	var statMu sync.Mutex
 
-	for _, source := range m.cfg.Blocklists {
-		if !source.Enabled {
+	m.mu.RLock()
+	sources := make([]config.BlocklistSource, len(m.cfg.Blocklists))
+	copy(sources, m.cfg.Blocklists)
+	groups := make([]config.ClientGroup, len(m.cfg.ClientGroups))
+	copy(groups, m.cfg.ClientGroups)
+	// Failures are counted since startup
+	fetches := make(map[string]core.SourceStats, len(sources))
+	for name, st := range m.fetches {
+		fetches[name] = core.SourceStats{Name: name, Failures: st.Failures}
+	}
+	m.mu.RUnlock()
+
+	enabled, policies := compileGroups(sources, groups)
+	used := enabled
+	for _, p := range policies {
+		used |= p.mask
+	}
+
+	for i, source := range sources {
+		if !source.Enabled && used&(1<<i) == 0 {
+			continue
+		}
+		if i >= maxSources {
+			m.log("Skipping %s: only the first %d sources are supported", source.Name, maxSources)
 			continue
 		}
 
 		wg.Add(1)
-		go func(src config.BlocklistSource) {
+		go func(idx int, src config.BlocklistSource) {
 			defer wg.Done()
 
 			// Try cache first or download
 			m.log("Fetching source: %s...", src.Name)
+			start := time.Now()
 			content, err := m.fetchEx(ctx, src)
+			mu.Lock()
+			st := fetches[src.Name]
+			st.Name, st.FetchDuration = src.Name, time.Since(start)
+			if err != nil {
+				st.Failures++
+			}
+			fetches[src.Name] = st
+			mu.Unlock()
 			if err != nil {
 				m.log("Failed to fetch %s: %v", src.Name, err)
 				return
 			}
 			m.log("Fetched %s (Size: %d bytes). Parsing...", src.Name, len(content))
 
+			if src.Format == "ip" {
+				var prefixes []netip.Prefix
+				for _, line := range strings.Split(content, "\n") {
+					if prefix, ok := parseIPLine(line); ok {
+						prefixes = append(prefixes, prefix)
+					}
+				}
+				mu.Lock()
+				for _, prefix := range prefixes {
+					newIPs.insert(prefix, 1<<idx)
+				}
+				st.Rules = len(prefixes)
+				fetches[src.Name] = st
+				mu.Unlock()
+				m.log("Loaded %d networks from %s", len(prefixes), src.Name)
+				return
+			}
+
 			// Parse into LOCAL map to avoid mutex contention on every line
 			localMap := make(map[string]struct{})
 			count := 0
@@ -134,6 +217,11 @@ func (m *Manager) LoadBlocklists(ctx context.Context) error {
 				m.log("Error scanning %s: %v", src.Name, err)
 			}
 
+			mu.Lock()
+			st.Rules = len(localMap)
+			fetches[src.Name] = st
+			mu.Unlock()
+
 			// Merge local results into main map (Single Lock)
 			if count > 0 {
 				mu.Lock()
@@ -143,7 +231,7 @@ func (m *Manager) LoadBlocklists(ctx context.Context) error {
 						duplicates++
 						statMu.Unlock()
 					}
-					newMap[k] = struct{}{}
+					newMap[k] |= 1 << idx
 				}
 				mu.Unlock()
 
@@ -153,20 +241,59 @@ func (m *Manager) LoadBlocklists(ctx context.Context) error {
 			}
 
 			m.log("Loaded %d domains from %s", count, src.Name)
-		}(source)
+		}(i, source)
 	}
 
 	wg.Wait()
 
 	m.mu.Lock()
 	m.domains = newMap
+	m.ips = newIPs
+	m.sources = sources
+	m.enabled = enabled
+	m.groups = policies
+	m.fetches = fetches
 	m.mu.Unlock()
 
 	m.log("Blocklist Update Complete.")
-	m.log("Total Rules: %d | Duplicates Removed: %d", len(newMap), duplicates)
+	m.log("Total Rules: %d | Networks: %d | Duplicates Removed: %d", len(newMap), newIPs.size, duplicates)
 	return nil
 }
 
+// compileGroups returns the mask of the enabled sources and the policy of
+// each client group. Groups without sources use the enabled ones.
+func compileGroups(sources []config.BlocklistSource, groups []config.ClientGroup) (uint64, map[string]groupPolicy) {
+	index := make(map[string]int, len(sources))
+	var enabled uint64
+	for i, src := range sources {
+		if i >= maxSources {
+			break
+		}
+		index[src.Name] = i
+		if src.Enabled {
+			enabled |= 1 << i
+		}
+	}
+
+	policies := make(map[string]groupPolicy, len(groups))
+	for _, g := range groups {
+		p := groupPolicy{mask: enabled, allow: make(map[string]struct{}, len(g.Allowlist))}
+		if len(g.Sources) > 0 {
+			p.mask = 0
+			for _, name := range g.Sources {
+				if i, ok := index[name]; ok {
+					p.mask |= 1 << i
+				}
+			}
+		}
+		for _, d := range g.Allowlist {
+			p.allow[strings.TrimSuffix(strings.ToLower(d), ".")] = struct{}{}
+		}
+		policies[g.Name] = p
+	}
+	return enabled, policies
+}
+
 // fetchEx handles caching and downloading.
 func (m *Manager) fetchEx(ctx context.Context, src config.BlocklistSource) (string, error) {
 	hash := md5.Sum([]byte(src.URL))
@@ -231,21 +358,80 @@ func parseHostsLine(line string) string {
 }
 
 func (m *Manager) IsBlocked(domain string) bool {
+	_, blocked := m.Match(domain)
+	return blocked
+}
+
+// Match reports whether domain is blocked and by which source.
+// When several sources list it, the first one in the configuration wins.
+func (m *Manager) Match(domain string) (config.BlocklistSource, bool) {
+	return m.MatchGroup(domain, "")
+}
+
+// MatchGroup is like Match, with the sources and allowlist of the named
+// client group. Unknown groups, and "", get the default policy.
+func (m *Manager) MatchGroup(domain, group string) (config.BlocklistSource, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	policy := m.policy(group)
+	if src, ok := m.source(m.lookup(domain, policy.allow) & policy.mask); ok {
+		return src, true
+	}
+	if m.denied(domain, policy.allow) {
+		return denylistSource, true
+	}
+	return config.BlocklistSource{}, false
+}
+
+// MatchIP reports whether ip lies in a network of an "ip" format source
+// applied to the client group, and which one.
+func (m *Manager) MatchIP(ip net.IP, group string) (config.BlocklistSource, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return config.BlocklistSource{}, false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.source(m.ips.lookup(addr) & m.policy(group).mask)
+}
+
+// policy returns the policy of group, or the default one. Caller must hold m.mu.
+func (m *Manager) policy(group string) groupPolicy {
+	if p, ok := m.groups[group]; ok && group != "" {
+		return p
+	}
+	return groupPolicy{mask: m.enabled}
+}
+
+// source returns the first source in mask. Caller must hold m.mu.
+func (m *Manager) source(mask uint64) (config.BlocklistSource, bool) {
+	if mask == 0 {
+		return config.BlocklistSource{}, false
+	}
+	return m.sources[bits.TrailingZeros64(mask)], true
+}
+
+// lookup returns the mask of sources blocking domain or one of its parents,
+// unless it is in the global allowlist or allow. Caller must hold m.mu.
+func (m *Manager) lookup(domain string, allow map[string]struct{}) uint64 {
 	// Normalize
 	domain = strings.ToLower(domain)
 	domain = strings.TrimSuffix(domain, ".")
 
 	// 0. Check Allowlist (Exact Match)
 	if _, allowed := m.allowlistMap[domain]; allowed {
-		return false
+		return 0
+	}
+	if _, allowed := allow[domain]; allowed {
+		return 0
 	}
 
 	// 1. Exact Match
-	if _, ok := m.domains[domain]; ok {
-		return true
+	if mask, ok := m.domains[domain]; ok {
+		return mask
 	}
 
 	// 2. Subdomain Walking (Alloc-free)
@@ -266,18 +452,69 @@ func (m *Manager) IsBlocked(domain string) bool {
 			// Let's allow TLD checking for robustness if user adds "zip".
 		}
 
-		if _, ok := m.domains[domain]; ok {
-			return true
+		if mask, ok := m.domains[domain]; ok {
+			return mask
 		}
 	}
 
-	return false
+	return 0
+}
+
+// IsAllowed reports whether domain is in the global allowlist or the one of
+// group.
+func (m *Manager) IsAllowed(domain, group string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if _, ok := m.allowlistMap[domain]; ok {
+		return true
+	}
+	_, ok := m.policy(group).allow[domain]
+	return ok
+}
+
+// denied reports whether domain or one of its parents is in the denylist,
+// unless it is in the global allowlist or allow. Caller must hold m.mu.
+func (m *Manager) denied(domain string, allow map[string]struct{}) bool {
+	if len(m.denylistMap) == 0 {
+		return false
+	}
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if _, allowed := m.allowlistMap[domain]; allowed {
+		return false
+	}
+	if _, allowed := allow[domain]; allowed {
+		return false
+	}
+	for {
+		if _, ok := m.denylistMap[domain]; ok {
+			return true
+		}
+		idx := strings.Index(domain, ".")
+		if idx == -1 {
+			return false
+		}
+		domain = domain[idx+1:]
+	}
 }
 
 func (m *Manager) Stats() int {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return len(m.domains)
+	return len(m.domains) + m.ips.size
+}
+
+// SourceStats returns the statistics of every configured source, in order.
+func (m *Manager) SourceStats() []core.SourceStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stats := make([]core.SourceStats, 0, len(m.cfg.Blocklists))
+	for _, src := range m.cfg.Blocklists {
+		st := m.fetches[src.Name]
+		st.Name = src.Name
+		stats = append(stats, st)
+	}
+	return stats
 }
 
 func (m *Manager) ListSources() []config.BlocklistSource {
@@ -298,7 +535,7 @@ func (m *Manager) ToggleSource(name string, enabled bool) error {
 			m.cfg.Blocklists[i].Enabled = enabled
 			
 			// Save config
-			return config.Save(m.cfg, filepath.Join(m.cfg.ConfigDir, "config.yaml"))
+			return config.SaveCurrent(m.cfg)
 		}
 	}
 	return fmt.Errorf("source not found: %s", name)
@@ -317,6 +554,9 @@ func (m *Manager) AddAllowed(domain string) error {
 
 	// Add to map for lookup
 	m.allowlistMap[domain] = struct{}{}
+	// Allowing a denied domain lifts the denial
+	delete(m.denylistMap, domain)
+	m.cfg.Denylist = without(m.cfg.Denylist, domain)
 	
 	// Add to config slice if not exists
 	found := false
@@ -330,7 +570,7 @@ func (m *Manager) AddAllowed(domain string) error {
 		m.cfg.Allowlist = append(m.cfg.Allowlist, domain)
 	}
 
-	return config.Save(m.cfg, filepath.Join(m.cfg.ConfigDir, "config.yaml"))
+	return config.SaveCurrent(m.cfg)
 }
 
 func (m *Manager) RemoveAllowed(domain string) error {
@@ -351,7 +591,7 @@ func (m *Manager) RemoveAllowed(domain string) error {
 	}
 	m.cfg.Allowlist = newSlice
 
-	return config.Save(m.cfg, filepath.Join(m.cfg.ConfigDir, "config.yaml"))
+	return config.SaveCurrent(m.cfg)
 }
 
 func (m *Manager) ListAllowed() []string {
@@ -364,6 +604,76 @@ func (m *Manager) ListAllowed() []string {
 	return dst
 }
 
+// --- Denylist Implementation ---
+
+// AddBlocked blocks domain and its subdomains for every client, and removes
+// it from the allowlist.
+func (m *Manager) AddBlocked(domain string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" {
+		return fmt.Errorf("empty domain")
+	}
+
+	delete(m.allowlistMap, domain)
+	m.cfg.Allowlist = without(m.cfg.Allowlist, domain)
+
+	if _, ok := m.denylistMap[domain]; !ok {
+		m.denylistMap[domain] = struct{}{}
+		m.cfg.Denylist = append(m.cfg.Denylist, domain)
+	}
+
+	return config.SaveCurrent(m.cfg)
+}
+
+func (m *Manager) RemoveBlocked(domain string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if _, ok := m.denylistMap[domain]; !ok {
+		return fmt.Errorf("denylist entry not found: %s", domain)
+	}
+	delete(m.denylistMap, domain)
+	m.cfg.Denylist = without(m.cfg.Denylist, domain)
+
+	return config.SaveCurrent(m.cfg)
+}
+
+func (m *Manager) ListBlocked() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	dst := make([]string, len(m.cfg.Denylist))
+	copy(dst, m.cfg.Denylist)
+	return dst
+}
+
+// without returns list minus domain, in a new slice.
+func without(list []string, domain string) []string {
+	out := make([]string, 0, len(list))
+	for _, d := range list {
+		if d != domain {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// ApplyConfig takes the sources, allowlist and denylist of next, returning
+// the keys of those that changed. LoadBlocklists fetches new sources.
+func (m *Manager) ApplyConfig(next *config.Config) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changed := config.Diff(m.cfg, next, config.ListKeys)
+	config.Copy(m.cfg, next, changed)
+	m.syncAllowlistMap()
+	return changed
+}
+
 func (m *Manager) InvalidateCache() error {
 	return os.RemoveAll(m.cfg.CacheDir)
 }
@@ -2,9 +2,11 @@ package blocklist
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"0x53/internal/config"
@@ -60,6 +62,224 @@ func TestManager_LoadBlocklists(t *testing.T) {
 	}
 }
 
+func TestManager_MatchReportsSource(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/first":
+			w.Write([]byte("0.0.0.0 shared.example\n0.0.0.0 first.example\n"))
+		case "/second":
+			w.Write([]byte("shared.example\nsecond.example\n"))
+		}
+	}))
+	defer ts.Close()
+
+	cfg := config.Default()
+	cfg.CacheDir = t.TempDir()
+	cfg.Blocklists = []config.BlocklistSource{
+		{Name: "First", URL: ts.URL + "/first", Format: "hosts", Enabled: true},
+		{Name: "Second", URL: ts.URL + "/second", Format: "wild", Enabled: true, BlockingMode: config.BlockNXDomain},
+	}
+
+	mgr := NewManager(cfg)
+	if err := mgr.LoadBlocklists(context.Background()); err != nil {
+		t.Fatalf("LoadBlocklists failed: %v", err)
+	}
+
+	tests := []struct {
+		domain string
+		source string
+	}{
+		{"shared.example", "First"}, // Listed twice, first source wins
+		{"first.example", "First"},
+		{"sub.second.example", "Second"},
+	}
+	for _, tt := range tests {
+		src, ok := mgr.Match(tt.domain)
+		if !ok || src.Name != tt.source {
+			t.Errorf("Match(%q) = %q, %v; want %q", tt.domain, src.Name, ok, tt.source)
+		}
+	}
+	if src, _ := mgr.Match("second.example"); src.BlockingMode != config.BlockNXDomain {
+		t.Errorf("Expected source override to be returned, got %q", src.BlockingMode)
+	}
+	if _, ok := mgr.Match("clean.example"); ok {
+		t.Error("clean.example should not match")
+	}
+}
+
+func TestManager_SourceStats(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			http.Error(w, "gone", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("a.example\nb.example\n"))
+	}))
+	defer ts.Close()
+
+	cfg := config.Default()
+	cfg.CacheDir = t.TempDir()
+	cfg.Blocklists = []config.BlocklistSource{
+		{Name: "Good", URL: ts.URL + "/good", Format: "wild", Enabled: true},
+		{Name: "Broken", URL: ts.URL + "/broken", Format: "wild", Enabled: true},
+		{Name: "Off", URL: ts.URL + "/off", Format: "wild"},
+	}
+
+	mgr := NewManager(cfg)
+	for i := 0; i < 2; i++ {
+		if err := mgr.LoadBlocklists(context.Background()); err != nil {
+			t.Fatalf("LoadBlocklists failed: %v", err)
+		}
+	}
+
+	stats := mgr.SourceStats()
+	if len(stats) != 3 {
+		t.Fatalf("Expected stats for 3 sources, got %v", stats)
+	}
+	if stats[0].Name != "Good" || stats[0].Rules != 2 || stats[0].Failures != 0 {
+		t.Errorf("Unexpected stats for the good source: %+v", stats[0])
+	}
+	if stats[1].Rules != 0 || stats[1].Failures != 2 {
+		t.Errorf("Expected failures to accumulate over loads: %+v", stats[1])
+	}
+	if stats[2].Name != "Off" || stats[2].Rules != 0 || stats[2].FetchDuration != 0 {
+		t.Errorf("Expected a disabled source not to be fetched: %+v", stats[2])
+	}
+}
+
+func TestManager_MatchIP(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("# bad hosting ranges\n198.51.100.0/24\n203.0.113.7 ; single host\n2001:db8:bad::/48\nnot-a-network\n"))
+	}))
+	defer ts.Close()
+
+	cfg := config.Default()
+	cfg.CacheDir = t.TempDir()
+	cfg.Blocklists = []config.BlocklistSource{
+		{Name: "Bad Ranges", URL: ts.URL, Format: "ip", Enabled: true},
+	}
+
+	mgr := NewManager(cfg)
+	if err := mgr.LoadBlocklists(context.Background()); err != nil {
+		t.Fatalf("LoadBlocklists failed: %v", err)
+	}
+	if mgr.Stats() != 3 {
+		t.Errorf("Expected 3 networks, got %d", mgr.Stats())
+	}
+
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{"198.51.100.1", true},
+		{"198.51.100.255", true},
+		{"198.51.101.1", false},
+		{"203.0.113.7", true},
+		{"203.0.113.8", false},
+		{"::ffff:198.51.100.9", true},
+		{"2001:db8:bad:1::1", true},
+		{"2001:db8:bae::1", false},
+	}
+	for _, tt := range tests {
+		src, ok := mgr.MatchIP(net.ParseIP(tt.ip), "")
+		if ok != tt.blocked || (ok && src.Name != "Bad Ranges") {
+			t.Errorf("MatchIP(%s) = %q, %v; want blocked %v", tt.ip, src.Name, ok, tt.blocked)
+		}
+	}
+	if mgr.IsBlocked("198.51.100.1") {
+		t.Error("Networks must not be matched as domain names")
+	}
+}
+
+func TestManager_MatchGroup(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ads":
+			w.Write([]byte("ads.example\nvideo.example\n"))
+		case "/strict":
+			w.Write([]byte("games.example\n"))
+		}
+	}))
+	defer ts.Close()
+
+	cfg := config.Default()
+	cfg.CacheDir = t.TempDir()
+	cfg.Blocklists = []config.BlocklistSource{
+		{Name: "Ads", URL: ts.URL + "/ads", Format: "wild", Enabled: true},
+		{Name: "Strict", URL: ts.URL + "/strict", Format: "wild", Enabled: false},
+	}
+	cfg.ClientGroups = []config.ClientGroup{
+		{Name: "kids", Clients: []string{"192.168.1.50"}, Sources: []string{"Ads", "Strict"}, Allowlist: []string{"video.example"}},
+		{Name: "iot", Clients: []string{"192.168.2.0/24"}, Sources: []string{"Strict"}},
+		{Name: "laptops", Clients: []string{"192.168.3.0/24"}},
+	}
+
+	mgr := NewManager(cfg)
+	if err := mgr.LoadBlocklists(context.Background()); err != nil {
+		t.Fatalf("LoadBlocklists failed: %v", err)
+	}
+
+	tests := []struct {
+		group, domain string
+		blocked       bool
+	}{
+		{"", "ads.example", true},
+		{"", "games.example", false}, // Strict is only loaded for groups
+		{"kids", "ads.example", true},
+		{"kids", "games.example", true},
+		{"kids", "video.example", false}, // Group allowlist
+		{"iot", "ads.example", false},
+		{"iot", "games.example", true},
+		{"laptops", "ads.example", true},
+		{"laptops", "games.example", false},
+		{"unknown", "games.example", false},
+	}
+	for _, tt := range tests {
+		if _, ok := mgr.MatchGroup(tt.domain, tt.group); ok != tt.blocked {
+			t.Errorf("MatchGroup(%s, %q) = %v, want %v", tt.domain, tt.group, ok, tt.blocked)
+		}
+	}
+}
+
+func TestManager_Denylist(t *testing.T) {
+	cfg := config.Default()
+	cfg.ConfigDir = t.TempDir()
+	cfg.CacheDir = t.TempDir()
+	cfg.Blocklists = nil
+	cfg.Allowlist = []string{"tracker.example"}
+
+	mgr := NewManager(cfg)
+	if err := mgr.AddBlocked("Tracker.Example."); err != nil {
+		t.Fatalf("AddBlocked failed: %v", err)
+	}
+	if got := mgr.ListAllowed(); len(got) != 0 {
+		t.Errorf("Blocking must lift the allowlist entry, got %v", got)
+	}
+	src, ok := mgr.MatchGroup("cdn.tracker.example", "kids")
+	if !ok || src.Name != "Denylist" {
+		t.Fatalf("Expected subdomain blocked by the denylist, got %v %+v", ok, src)
+	}
+
+	// Allowing wins and removes the domain from the denylist
+	if err := mgr.AddAllowed("tracker.example"); err != nil {
+		t.Fatalf("AddAllowed failed: %v", err)
+	}
+	if mgr.IsBlocked("tracker.example") || len(mgr.ListBlocked()) != 0 {
+		t.Error("Expected tracker.example allowed again")
+	}
+	if err := mgr.RemoveBlocked("tracker.example"); err == nil {
+		t.Error("Expected an error removing a missing entry")
+	}
+
+	saved, err := config.Load(filepath.Join(cfg.ConfigDir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(saved.Denylist) != 0 || len(saved.Allowlist) != 1 {
+		t.Errorf("Unexpected saved lists: deny %v, allow %v", saved.Denylist, saved.Allowlist)
+	}
+}
+
 func TestParseHostsLine(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -80,3 +300,44 @@ func TestParseHostsLine(t *testing.T) {
 		}
 	}
 }
+
+func TestManager_ApplyConfig(t *testing.T) {
+	cfg := config.Default()
+	cfg.ConfigDir = t.TempDir()
+	cfg.CacheDir = t.TempDir()
+	cfg.Blocklists = nil
+	mgr := NewManager(cfg)
+
+	next := config.Default()
+	next.Blocklists = nil
+	next.Denylist = []string{"Tracker.Example"}
+	next.BindPort = 5399 // Not the manager's to apply
+	if got := mgr.ApplyConfig(next); len(got) != 1 || got[0] != "denylist" {
+		t.Errorf("ApplyConfig changed %v; want [denylist]", got)
+	}
+	if !mgr.IsBlocked("cdn.tracker.example") {
+		t.Error("Expected the new denylist to apply")
+	}
+	if cfg.BindPort == next.BindPort {
+		t.Error("ApplyConfig copied a server setting")
+	}
+	if got := mgr.ApplyConfig(next); len(got) != 0 {
+		t.Errorf("Applying the same configuration changed %v", got)
+	}
+}
+
+func TestManager_IsAllowed(t *testing.T) {
+	cfg := config.Default()
+	cfg.ConfigDir = t.TempDir()
+	cfg.CacheDir = t.TempDir()
+	cfg.Blocklists = nil
+	cfg.Allowlist = []string{"Printer.Example"}
+	mgr := NewManager(cfg)
+
+	if !mgr.IsAllowed("printer.example.", "") {
+		t.Error("Expected printer.example allowed")
+	}
+	if mgr.IsAllowed("other.example", "") {
+		t.Error("Expected other.example not allowed")
+	}
+}
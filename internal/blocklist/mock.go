@@ -2,21 +2,27 @@ package blocklist
 
 import (
 	"context"
+	"net"
 	"strings"
 	"sync"
 
 	"0x53/internal/config"
+	"0x53/internal/core"
 )
 
 // MockManager is a simple thread-safe map-based blocklist for testing.
 type MockManager struct {
 	blockedDomains map[string]struct{}
+	blockedNets    []*net.IPNet
+	groupDomains   map[string]map[string]struct{} // Blocked for one client group only
+	allowed        map[string]struct{}
 	mu             sync.RWMutex
 }
 
 func NewMockManager() *MockManager {
 	return &MockManager{
 		blockedDomains: make(map[string]struct{}),
+		allowed:        make(map[string]struct{}),
 	}
 }
 
@@ -35,20 +41,79 @@ func (m *MockManager) IsBlocked(domain string) bool {
 	return exists
 }
 
+func (m *MockManager) Match(domain string) (config.BlocklistSource, bool) {
+	if !m.IsBlocked(domain) {
+		return config.BlocklistSource{}, false
+	}
+	return config.BlocklistSource{Name: "mock", Enabled: true}, true
+}
+
+// MatchGroup blocks the domains added for everyone or for group.
+func (m *MockManager) MatchGroup(domain, group string) (config.BlocklistSource, bool) {
+	m.mu.RLock()
+	_, blocked := m.groupDomains[group][strings.ToLower(domain)]
+	m.mu.RUnlock()
+	if blocked {
+		return config.BlocklistSource{Name: "mock:" + group, Enabled: true}, true
+	}
+	return m.Match(domain)
+}
+
+// AddForGroup blocks domain for the clients of group only.
+func (m *MockManager) AddForGroup(group, domain string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.groupDomains == nil {
+		m.groupDomains = make(map[string]map[string]struct{})
+	}
+	if m.groupDomains[group] == nil {
+		m.groupDomains[group] = make(map[string]struct{})
+	}
+	m.groupDomains[group][strings.ToLower(domain)] = struct{}{}
+}
+
 func (m *MockManager) Add(domain string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.blockedDomains[strings.ToLower(domain)] = struct{}{}
 }
 
+func (m *MockManager) MatchIP(ip net.IP, group string) (config.BlocklistSource, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, n := range m.blockedNets {
+		if n.Contains(ip) {
+			return config.BlocklistSource{Name: "mock", Enabled: true}, true
+		}
+	}
+	return config.BlocklistSource{}, false
+}
+
+// AddCIDR blocks every address in cidr.
+func (m *MockManager) AddCIDR(cidr string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, n, err := net.ParseCIDR(cidr); err == nil {
+		m.blockedNets = append(m.blockedNets, n)
+	}
+}
+
 func (m *MockManager) Stats() int {
 	return len(m.blockedDomains)
 }
 
+func (m *MockManager) SourceStats() []core.SourceStats {
+	return nil
+}
+
 func (m *MockManager) InvalidateCache() error {
 	return nil
 }
 
+func (m *MockManager) ApplyConfig(next *config.Config) []string {
+	return nil
+}
+
 func (m *MockManager) ListSources() []config.BlocklistSource {
 	return []config.BlocklistSource{}
 }
@@ -58,9 +123,19 @@ func (m *MockManager) ToggleSource(name string, enabled bool) error {
 }
 
 func (m *MockManager) AddAllowed(domain string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.allowed[strings.ToLower(domain)] = struct{}{}
 	return nil
 }
 
+func (m *MockManager) IsAllowed(domain, group string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.allowed[strings.ToLower(domain)]
+	return ok
+}
+
 func (m *MockManager) RemoveAllowed(domain string) error {
 	return nil
 }
@@ -68,3 +143,15 @@ func (m *MockManager) RemoveAllowed(domain string) error {
 func (m *MockManager) ListAllowed() []string {
 	return []string{}
 }
+
+func (m *MockManager) AddBlocked(domain string) error {
+	return nil
+}
+
+func (m *MockManager) RemoveBlocked(domain string) error {
+	return nil
+}
+
+func (m *MockManager) ListBlocked() []string {
+	return []string{}
+}
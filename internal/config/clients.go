@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ClientGroup gives the devices it matches their own filtering policy.
+type ClientGroup struct {
+	Name string `yaml:"name"`
+	// Clients are IP addresses, CIDRs or MAC addresses. MACs are resolved
+	// through the neighbor (ARP) table, so they only match clients on the LAN.
+	Clients []string `yaml:"clients"`
+	// Sources names the blocklist sources applied to the group, whether or
+	// not they are enabled globally. Empty means the globally enabled ones.
+	Sources []string `yaml:"sources,omitempty"`
+	// Allowlist adds domains allowed for the group only (exact match, like
+	// the global allowlist, which applies too).
+	Allowlist []string `yaml:"allowlist,omitempty"`
+	// BlockingMode overrides the global blocking mode for the group; a
+	// source's own override still takes precedence.
+	BlockingMode BlockingMode `yaml:"blocking_mode,omitempty"`
+}
+
+// ClientKind tells how a client entry of a group is matched.
+type ClientKind int
+
+const (
+	ClientIP ClientKind = iota
+	ClientCIDR
+	ClientMAC
+)
+
+// ParseClient classifies a client entry, returning its canonical form:
+// the address, the masked network or the lowercase colon-separated MAC.
+func ParseClient(client string) (ClientKind, string, error) {
+	client = strings.TrimSpace(client)
+	if ip := net.ParseIP(client); ip != nil {
+		return ClientIP, ip.String(), nil
+	}
+	if _, n, err := net.ParseCIDR(client); err == nil {
+		return ClientCIDR, n.String(), nil
+	}
+	if mac, err := net.ParseMAC(client); err == nil {
+		return ClientMAC, mac.String(), nil
+	}
+	return 0, "", fmt.Errorf("invalid client %q: want an IP, CIDR or MAC address", client)
+}
+
+// Normalize trims the name and puts the clients and allowlist in canonical form.
+// Entries that do not parse are kept as is for Validate to report.
+func (g *ClientGroup) Normalize() {
+	g.Name = strings.TrimSpace(g.Name)
+	for i, c := range g.Clients {
+		if _, canon, err := ParseClient(c); err == nil {
+			g.Clients[i] = canon
+		}
+	}
+	for i, d := range g.Allowlist {
+		g.Allowlist[i] = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(d)), ".")
+	}
+	g.BlockingMode = BlockingMode(strings.ToLower(strings.TrimSpace(string(g.BlockingMode))))
+}
+
+// Validate checks the group is well formed. Source names are checked
+// against sources, the configured blocklists.
+func (g ClientGroup) Validate(sources []BlocklistSource) error {
+	if g.Name == "" {
+		return fmt.Errorf("client group with empty name")
+	}
+	if len(g.Clients) == 0 {
+		return fmt.Errorf("client group %s has no clients", g.Name)
+	}
+	for _, c := range g.Clients {
+		if _, _, err := ParseClient(c); err != nil {
+			return fmt.Errorf("client group %s: %w", g.Name, err)
+		}
+	}
+next:
+	for _, name := range g.Sources {
+		for _, src := range sources {
+			if src.Name == name {
+				continue next
+			}
+		}
+		return fmt.Errorf("client group %s: unknown blocklist source %q", g.Name, name)
+	}
+	switch g.BlockingMode {
+	case "", BlockNullIP, BlockNXDomain, BlockRefused, BlockNoData, BlockCustomIP:
+	default:
+		return fmt.Errorf("client group %s: invalid blocking mode %q", g.Name, g.BlockingMode)
+	}
+	return nil
+}
@@ -18,44 +18,166 @@ const (
 	UpstreamCloudflare UpstreamStrategy = "cloudflare"
 	// UpstreamGoogle uses 8.8.8.8.
 	UpstreamGoogle UpstreamStrategy = "google"
+	// UpstreamCloudflareDoH uses Cloudflare over DNS-over-HTTPS.
+	UpstreamCloudflareDoH UpstreamStrategy = "cloudflare-doh"
+	// UpstreamGoogleDoH uses Google over DNS-over-HTTPS.
+	UpstreamGoogleDoH UpstreamStrategy = "google-doh"
+	// UpstreamCloudflareDoT uses Cloudflare over DNS-over-TLS.
+	UpstreamCloudflareDoT UpstreamStrategy = "cloudflare-dot"
+	// UpstreamGoogleDoT uses Google over DNS-over-TLS.
+	UpstreamGoogleDoT UpstreamStrategy = "google-dot"
+	// UpstreamQuad9DoT uses Quad9 over DNS-over-TLS.
+	UpstreamQuad9DoT UpstreamStrategy = "quad9-dot"
 	// UpstreamCustom uses the CustomUpstream field.
 	UpstreamCustom UpstreamStrategy = "custom"
 )
 
+// UpstreamPolicy defines how a query picks among several upstreams.
+type UpstreamPolicy string
+
+const (
+	// PolicyFailover always tries upstreams in the configured order.
+	PolicyFailover UpstreamPolicy = "failover"
+	// PolicyRoundRobin rotates the first upstream tried on every query.
+	PolicyRoundRobin UpstreamPolicy = "round_robin"
+	// PolicyRandom tries upstreams in a random order.
+	PolicyRandom UpstreamPolicy = "random"
+	// PolicyFastest prefers the upstream with the lowest average latency.
+	PolicyFastest UpstreamPolicy = "fastest"
+)
+
+// BlockingMode defines how blocked queries are answered.
+type BlockingMode string
+
+const (
+	// BlockNullIP answers A with 0.0.0.0 and AAAA with ::.
+	BlockNullIP BlockingMode = "null"
+	// BlockNXDomain answers NXDOMAIN with a synthetic SOA for negative caching.
+	BlockNXDomain BlockingMode = "nxdomain"
+	// BlockRefused answers REFUSED.
+	BlockRefused BlockingMode = "refused"
+	// BlockNoData answers NOERROR without records.
+	BlockNoData BlockingMode = "nodata"
+	// BlockCustomIP answers A/AAAA with BlockingIPv4/BlockingIPv6.
+	BlockCustomIP BlockingMode = "custom"
+)
+
+// ACLAction defines what happens to queries from clients the ACL rejects.
+type ACLAction string
+
+const (
+	// ACLRefuse answers REFUSED.
+	ACLRefuse ACLAction = "refuse"
+	// ACLDrop sends no answer at all.
+	ACLDrop ACLAction = "drop"
+)
+
 // Config holds the runtime configuration for the application.
 type Config struct {
 	// Network Configuration
 	BindPort int    `yaml:"bind_port"`
 	BindIP   string `yaml:"bind_ip"`
 
+	// Client Access Control: only clients in AllowClients (all if empty) and
+	// not in DenyClients may query; entries are CIDRs or single addresses
+	AllowClients []string  `yaml:"allow_clients"`
+	DenyClients  []string  `yaml:"deny_clients"`
+	ACLAction    ACLAction `yaml:"acl_action"`
+
+	// Per-client rate limiting (token bucket per client prefix), 0 disables it.
+	// Throttled UDP queries are dropped, except every RateLimitSlip-th one
+	// which gets a truncated reply so real clients retry over TCP.
+	RateLimit           int `yaml:"rate_limit"`       // Queries per second
+	RateLimitBurst      int `yaml:"rate_limit_burst"` // Bucket size
+	RateLimitSlip       int `yaml:"rate_limit_slip"`
+	RateLimitIPv4Prefix int `yaml:"rate_limit_ipv4_prefix"` // Clients sharing a prefix share a bucket
+	RateLimitIPv6Prefix int `yaml:"rate_limit_ipv6_prefix"`
+
 	// Local DNS Records
-	LocalRecords map[string]string `yaml:"local_records"`
+	LocalRecords     LocalRecords `yaml:"local_records"`
+	LinkedHostsFiles []string     `yaml:"linked_hosts_files"` // Hosts-format files re-read on every reload
 
 	// Allowlist
 	Allowlist []string `yaml:"allowlist"`
+	// Denylist blocks domains and their subdomains for everyone, on top of the sources
+	Denylist []string `yaml:"denylist"`
+
+	// Per-client policies, matched by source IP, CIDR or MAC
+	ClientGroups []ClientGroup `yaml:"client_groups"`
 
 	// Upstream Configuration
-	Upstream       UpstreamStrategy `yaml:"upstream_strategy"`
-	CustomUpstream string           `yaml:"custom_upstream"` // "IP:Port"
+	Upstream        UpstreamStrategy `yaml:"upstream_strategy"`
+	CustomUpstream  string           `yaml:"custom_upstream"`  // "IP:Port", "https://host/dns-query" or "tls://host:853"
+	CustomUpstreams []string         `yaml:"custom_upstreams"` // Extra custom upstreams, same formats
+	UpstreamPolicy  UpstreamPolicy   `yaml:"upstream_policy"`
+	TLSServerName   string           `yaml:"tls_server_name"`  // Overrides the DoT certificate name, for IP-literal upstreams
+	DoHMethod       string           `yaml:"doh_method"`       // "post" (default) or "get"
+	BootstrapDNS    string           `yaml:"bootstrap_dns"`    // "IP:Port" used to resolve DoH hostnames
+
+	// Conditional Forwarding (evaluated before the default upstreams)
+	ForwardRules []ForwardRule `yaml:"forward_rules"`
+
+	// Response Cache
+	CacheSize   int    `yaml:"cache_size"`    // Max cached answers, 0 disables the cache
+	CacheMinTTL uint32 `yaml:"cache_min_ttl"` // Seconds, raises shorter TTLs
+	CacheMaxTTL uint32 `yaml:"cache_max_ttl"` // Seconds, caps longer TTLs
+
+	// Blocking Response
+	BlockingMode BlockingMode `yaml:"blocking_mode"`
+	BlockingIPv4 string       `yaml:"blocking_ipv4"` // Used by the custom mode
+	BlockingIPv6 string       `yaml:"blocking_ipv6"` // Used by the custom mode
+	BlockTTL     uint32       `yaml:"block_ttl"`     // Seconds
+
+	// Also check every CNAME target of upstream answers against the blocklists
+	BlockCNAMECloaking bool `yaml:"block_cname_cloaking"`
+
+	// DNS Rebinding Protection: strip private, loopback, link-local and CGNAT
+	// addresses from upstream answers, except for names under RebindExempt
+	// (suffixes), a forward rule or allowlisted. Those are the way out for
+	// VPN and split-horizon resolvers answering with private addresses.
+	RebindProtection bool     `yaml:"rebind_protection"`
+	RebindExempt     []string `yaml:"rebind_exempt"`
 
 	// Persistence Paths
 	ConfigDir string `yaml:"config_dir"`
 	CacheDir  string `yaml:"cache_dir"`
 	LogPath   string `yaml:"log_path"`
 
+	// QueryLogPath appends every query event as a JSON line, empty disables it
+	QueryLogPath string `yaml:"query_log_path"`
+	// QueryHistoryDays keeps a searchable query history under CacheDir, 0 disables it
+	QueryHistoryDays int `yaml:"query_history_days"`
+
+	// Prometheus metrics, served by the daemon on MetricsAddr under /metrics
+	MetricsEnabled bool   `yaml:"metrics_enabled"`
+	MetricsAddr    string `yaml:"metrics_addr"`
+
 	// Feature Flags
 	EnableIPv6    bool `yaml:"enable_ipv6"`
 	RestoreOnExit bool `yaml:"restore_on_exit"`
 
 	// Blocklists
 	Blocklists []BlocklistSource `yaml:"blocklists"`
+
+	// Path is the file the configuration was loaded from, empty for defaults
+	Path string `yaml:"-"`
+}
+
+// ForwardRule sends every query under Domain to its own upstreams.
+type ForwardRule struct {
+	Domain    string   `yaml:"domain"`    // Suffix, e.g. "corp.internal" or "168.192.in-addr.arpa"
+	Upstreams []string `yaml:"upstreams"` // Same formats as custom_upstream
 }
 
 type BlocklistSource struct {
 	Name    string `yaml:"name"`
 	URL     string `yaml:"url"`
-	Format  string `yaml:"format"` // hosts, abp, wild
+	Format  string `yaml:"format"` // hosts, abp, wild, or ip (CIDRs matched against answer addresses)
 	Enabled bool   `yaml:"enabled"`
+
+	// Optional overrides of the global blocking response
+	BlockingMode BlockingMode `yaml:"blocking_mode,omitempty"`
+	BlockTTL     uint32       `yaml:"block_ttl,omitempty"`
 }
 
 // Default returns a safe default configuration.
@@ -74,10 +196,41 @@ func Default() *Config {
 		BindIP:   "0.0.0.0",
 		Upstream: UpstreamGoogle, // Default to Google for stability
 
+		// Loopback and private networks only, so a public IP is not an open resolver
+		AllowClients: []string{
+			"127.0.0.0/8", "::1/128",
+			"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16",
+			"fc00::/7", "fe80::/10",
+		},
+		ACLAction: ACLRefuse,
+
+		RateLimit:           100,
+		RateLimitBurst:      300,
+		RateLimitSlip:       2,
+		RateLimitIPv4Prefix: 32,
+		RateLimitIPv6Prefix: 56,
+
+		UpstreamPolicy: PolicyFailover,
+		DoHMethod:      "post",
+		BootstrapDNS: "1.1.1.1:53",
+
+		BlockingMode: BlockNullIP,
+		BlockTTL:     3600,
+
+		BlockCNAMECloaking: true,
+		RebindProtection:   true,
+
+		CacheSize:   10000,
+		CacheMinTTL: 0,
+		CacheMaxTTL: 86400,
+
 		ConfigDir: filepath.Join(home, ".config", "0x53"),
 		CacheDir:  filepath.Join(home, ".cache", "0x53"),
 		LogPath:   "/var/log/0x53.log", // Default for daemon
 
+		QueryHistoryDays: 7,
+		MetricsAddr:      "127.0.0.1:9153",
+
 		EnableIPv6:    true,
 		RestoreOnExit: true,
 
@@ -133,10 +286,25 @@ func loadFromFile(path string) (*Config, error) {
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
 	}
+	cfg.Path = path
 
 	return cfg, nil
 }
 
+// CurrentPath returns the file cfg is saved to and reloaded from: the one it
+// was loaded from, or config.yaml in ConfigDir.
+func CurrentPath(cfg *Config) string {
+	if cfg.Path != "" {
+		return cfg.Path
+	}
+	return filepath.Join(cfg.ConfigDir, "config.yaml")
+}
+
+// SaveCurrent writes cfg to CurrentPath.
+func SaveCurrent(cfg *Config) error {
+	return Save(cfg, CurrentPath(cfg))
+}
+
 // Save attempts to save the current configuration to the specified path.
 func Save(cfg *Config, path string) error {
 	data, err := yaml.Marshal(cfg)
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+)
+
+// ParseHosts reads a hosts-format file ("IP name [aliases...]") into A/AAAA
+// records. Unspecified addresses (0.0.0.0, ::), which hosts-format blocklists
+// use to sink names, are skipped along with lines that do not parse; their
+// count is returned as invalid.
+func ParseHosts(r io.Reader) (recs []LocalRecord, invalid int, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.IndexByte(line, '#'); idx != -1 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		ip := net.ParseIP(fields[0])
+		if ip == nil || ip.IsUnspecified() || len(fields) < 2 {
+			invalid++
+			continue
+		}
+		for _, name := range fields[1:] {
+			rec := LocalRecord{Domain: name, Value: ip.String()}
+			rec.Normalize()
+			if rec.Validate() != nil {
+				invalid++
+				continue
+			}
+			recs = append(recs, rec)
+		}
+	}
+	return recs, invalid, scanner.Err()
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+// Record types supported by local records.
+const (
+	RecordA     = "A"
+	RecordAAAA  = "AAAA"
+	RecordCNAME = "CNAME"
+	RecordTXT   = "TXT"
+	RecordMX    = "MX"
+	RecordSRV   = "SRV"
+)
+
+// DefaultLocalTTL is used for local records without an explicit TTL.
+const DefaultLocalTTL = 3600
+
+// LocalRecord is a DNS record answered by the sinkhole itself.
+type LocalRecord struct {
+	Domain   string `yaml:"domain"`
+	Type     string `yaml:"type"`
+	Value    string `yaml:"value"` // IP for A/AAAA, target for CNAME/MX/SRV, text for TXT
+	TTL      uint32 `yaml:"ttl,omitempty"`
+	Priority uint16 `yaml:"priority,omitempty"` // MX and SRV
+	Weight   uint16 `yaml:"weight,omitempty"`   // SRV
+	Port     uint16 `yaml:"port,omitempty"`     // SRV
+
+	Source string `yaml:"-"` // Linked hosts file the record comes from, "" for the config
+}
+
+// Normalize lowercases the names, strips trailing dots and defaults the type.
+func (r *LocalRecord) Normalize() {
+	r.Domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(r.Domain)), ".")
+	r.Type = strings.ToUpper(strings.TrimSpace(r.Type))
+	if r.Type == "" {
+		r.Type = inferAddressType(r.Value)
+	}
+	switch r.Type {
+	case RecordCNAME, RecordMX, RecordSRV:
+		r.Value = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(r.Value)), ".")
+	case RecordA, RecordAAAA:
+		r.Value = strings.TrimSpace(r.Value)
+	}
+}
+
+// Validate checks the record is well formed for its type.
+func (r LocalRecord) Validate() error {
+	if r.Domain == "" {
+		return fmt.Errorf("empty domain")
+	}
+	if _, ok := dns.IsDomainName(r.Domain); !ok {
+		return fmt.Errorf("invalid domain: %s", r.Domain)
+	}
+	if strings.Contains(strings.TrimPrefix(r.Domain, "*."), "*") {
+		return fmt.Errorf("invalid domain: %s (a wildcard must be the whole first label, as in *.dev.lan)", r.Domain)
+	}
+
+	switch r.Type {
+	case RecordA:
+		if ip := net.ParseIP(r.Value); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("%s: A record needs an IPv4 address, got %q", r.Domain, r.Value)
+		}
+	case RecordAAAA:
+		if ip := net.ParseIP(r.Value); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("%s: AAAA record needs an IPv6 address, got %q", r.Domain, r.Value)
+		}
+	case RecordCNAME, RecordMX, RecordSRV:
+		if _, ok := dns.IsDomainName(r.Value); !ok || r.Value == "" {
+			return fmt.Errorf("%s: %s record needs a target name, got %q", r.Domain, r.Type, r.Value)
+		}
+		if r.Type == RecordCNAME && r.Value == r.Domain {
+			return fmt.Errorf("%s: CNAME points to itself", r.Domain)
+		}
+		if r.Type == RecordSRV && r.Port == 0 {
+			return fmt.Errorf("%s: SRV record needs a port", r.Domain)
+		}
+	case RecordTXT:
+		if r.Value == "" {
+			return fmt.Errorf("%s: empty TXT record", r.Domain)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported record type %q", r.Domain, r.Type)
+	}
+	return nil
+}
+
+// IsWildcard reports whether the record covers every name under its parent, as "*.dev.lan" does.
+func (r LocalRecord) IsWildcard() bool {
+	return strings.HasPrefix(r.Domain, "*.")
+}
+
+// TTLOrDefault returns the record TTL, or DefaultLocalTTL if unset.
+func (r LocalRecord) TTLOrDefault() uint32 {
+	if r.TTL == 0 {
+		return DefaultLocalTTL
+	}
+	return r.TTL
+}
+
+// inferAddressType picks A or AAAA for a bare IP, as used by the legacy format.
+func inferAddressType(value string) string {
+	if ip := net.ParseIP(strings.TrimSpace(value)); ip != nil && ip.To4() == nil {
+		return RecordAAAA
+	}
+	return RecordA
+}
+
+// LocalRecords is the list of local records.
+// It also accepts the legacy "domain: ip" mapping, which is converted to
+// A/AAAA records and written back in the typed format on the next save.
+type LocalRecords []LocalRecord
+
+func (l *LocalRecords) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		var legacy map[string]string
+		if err := node.Decode(&legacy); err != nil {
+			return err
+		}
+		domains := make([]string, 0, len(legacy))
+		for d := range legacy {
+			domains = append(domains, d)
+		}
+		sort.Strings(domains)
+
+		recs := make(LocalRecords, 0, len(legacy))
+		for _, d := range domains {
+			rec := LocalRecord{Domain: d, Value: legacy[d]}
+			rec.Normalize()
+			recs = append(recs, rec)
+		}
+		*l = recs
+		return nil
+	}
+
+	var recs []LocalRecord
+	if err := node.Decode(&recs); err != nil {
+		return err
+	}
+	for i := range recs {
+		recs[i].Normalize()
+	}
+	*l = recs
+	return nil
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLocalRecords_LegacyMapping(t *testing.T) {
+	var cfg Config
+	in := "local_records:\n  router.lan: 192.168.1.1\n  NAS.lan.: fd00::10\n"
+	if err := yaml.Unmarshal([]byte(in), &cfg); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	want := LocalRecords{
+		{Domain: "nas.lan", Type: RecordAAAA, Value: "fd00::10"},
+		{Domain: "router.lan", Type: RecordA, Value: "192.168.1.1"},
+	}
+	if len(cfg.LocalRecords) != len(want) {
+		t.Fatalf("Expected %d records, got %+v", len(want), cfg.LocalRecords)
+	}
+	for i := range want {
+		if cfg.LocalRecords[i] != want[i] {
+			t.Errorf("record %d = %+v; want %+v", i, cfg.LocalRecords[i], want[i])
+		}
+	}
+
+	// Saved back in the typed format
+	out, err := yaml.Marshal(&cfg)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var again Config
+	if err := yaml.Unmarshal(out, &again); err != nil {
+		t.Fatalf("Unmarshal typed: %v", err)
+	}
+	if len(again.LocalRecords) != 2 || again.LocalRecords[1] != want[1] {
+		t.Errorf("Round trip lost records: %+v", again.LocalRecords)
+	}
+}
+
+func TestParseHosts(t *testing.T) {
+	in := `# lab machines
+127.0.0.1   localhost
+192.168.1.10 nas.lan files.lan   # storage
+fd00::10     nas.lan
+0.0.0.0      ads.example.com
+not-an-ip    broken.lan
+192.168.1.11
+192.168.1.12 bad..name
+`
+	recs, invalid, err := ParseHosts(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseHosts: %v", err)
+	}
+	want := []LocalRecord{
+		{Domain: "localhost", Type: RecordA, Value: "127.0.0.1"},
+		{Domain: "nas.lan", Type: RecordA, Value: "192.168.1.10"},
+		{Domain: "files.lan", Type: RecordA, Value: "192.168.1.10"},
+		{Domain: "nas.lan", Type: RecordAAAA, Value: "fd00::10"},
+	}
+	if len(recs) != len(want) {
+		t.Fatalf("Expected %d records, got %+v", len(want), recs)
+	}
+	for i := range want {
+		if recs[i] != want[i] {
+			t.Errorf("record %d = %+v; want %+v", i, recs[i], want[i])
+		}
+	}
+	if invalid != 4 {
+		t.Errorf("Expected 4 invalid entries, got %d", invalid)
+	}
+}
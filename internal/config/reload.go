@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+)
+
+// Settings are grouped by what applies them when the configuration is
+// reloaded; the DNS server applies every other one.
+var (
+	// ListKeys are applied by the blocklist manager.
+	ListKeys = []string{"blocklists", "allowlist", "denylist"}
+	// RestartKeys are only read at startup, changing them takes a restart.
+	RestartKeys = []string{"config_dir", "cache_dir", "log_path", "query_log_path", "query_history_days", "metrics_enabled", "metrics_addr"}
+)
+
+// LoadFile reads the configuration at path, on top of the defaults.
+func LoadFile(path string) (*Config, error) {
+	return loadFromFile(path)
+}
+
+// Keys returns the YAML keys of every setting, in declaration order.
+func Keys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if key := yamlKey(t.Field(i)); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Diff returns the keys, among keys, of the settings that differ between
+// a and b. Empty and nil lists are the same setting.
+func Diff(a, b *Config, keys []string) []string {
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	var changed []string
+	for _, key := range keys {
+		i := fieldIndex(key)
+		if i >= 0 && !sameSetting(va.Field(i), vb.Field(i)) {
+			changed = append(changed, key)
+		}
+	}
+	return changed
+}
+
+func sameSetting(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Slice, reflect.Map:
+		if a.Len() == 0 && b.Len() == 0 {
+			return true
+		}
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// Copy sets the settings of dst named by keys to their value in src.
+func Copy(dst, src *Config, keys []string) {
+	vd, vs := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for _, key := range keys {
+		if i := fieldIndex(key); i >= 0 {
+			vd.Field(i).Set(vs.Field(i))
+		}
+	}
+}
+
+func fieldIndex(key string) int {
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if yamlKey(t.Field(i)) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// yamlKey returns the key of a Config field, "" if it is not saved.
+func yamlKey(f reflect.StructField) string {
+	key, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if key == "-" {
+		return ""
+	}
+	return key
+}
+
+// Validate checks the settings that are not checked when applied: the
+// listen address, the upstream and blocking choices, the blocklist sources,
+// local records and client groups.
+func (c *Config) Validate() error {
+	if c.BindPort <= 0 || c.BindPort > 65535 {
+		return fmt.Errorf("invalid bind_port %d", c.BindPort)
+	}
+	if net.ParseIP(c.BindIP) == nil {
+		return fmt.Errorf("invalid bind_ip %q", c.BindIP)
+	}
+
+	switch c.Upstream {
+	case UpstreamAuto, UpstreamCloudflare, UpstreamGoogle, UpstreamCloudflareDoH, UpstreamGoogleDoH,
+		UpstreamCloudflareDoT, UpstreamGoogleDoT, UpstreamQuad9DoT:
+	case UpstreamCustom:
+		if c.CustomUpstream == "" && len(c.CustomUpstreams) == 0 {
+			return fmt.Errorf("upstream_strategy custom needs custom_upstream or custom_upstreams")
+		}
+	default:
+		return fmt.Errorf("invalid upstream_strategy %q", c.Upstream)
+	}
+	switch c.UpstreamPolicy {
+	case "", PolicyFailover, PolicyRoundRobin, PolicyRandom, PolicyFastest:
+	default:
+		return fmt.Errorf("invalid upstream_policy %q", c.UpstreamPolicy)
+	}
+
+	if err := validBlockingMode(c.BlockingMode); err != nil {
+		return err
+	}
+	if ip := net.ParseIP(c.BlockingIPv4); c.BlockingIPv4 != "" && (ip == nil || ip.To4() == nil) {
+		return fmt.Errorf("invalid blocking_ipv4 %q", c.BlockingIPv4)
+	}
+	if ip := net.ParseIP(c.BlockingIPv6); c.BlockingIPv6 != "" && (ip == nil || ip.To4() != nil) {
+		return fmt.Errorf("invalid blocking_ipv6 %q", c.BlockingIPv6)
+	}
+
+	names := make(map[string]bool, len(c.Blocklists))
+	for _, src := range c.Blocklists {
+		if src.Name == "" {
+			return fmt.Errorf("blocklist source with empty name")
+		}
+		if names[src.Name] {
+			return fmt.Errorf("duplicate blocklist source %q", src.Name)
+		}
+		names[src.Name] = true
+		switch src.Format {
+		case "", "hosts", "abp", "wild", "ip":
+		default:
+			return fmt.Errorf("blocklist source %s: invalid format %q", src.Name, src.Format)
+		}
+		if err := validBlockingMode(src.BlockingMode); err != nil {
+			return fmt.Errorf("blocklist source %s: %w", src.Name, err)
+		}
+	}
+
+	for _, rec := range c.LocalRecords {
+		rec.Normalize()
+		if err := rec.Validate(); err != nil {
+			return fmt.Errorf("local record: %w", err)
+		}
+	}
+
+	groups := make(map[string]bool, len(c.ClientGroups))
+	for _, g := range c.ClientGroups {
+		g.Normalize()
+		if err := g.Validate(c.Blocklists); err != nil {
+			return err
+		}
+		if groups[g.Name] {
+			return fmt.Errorf("duplicate client group %q", g.Name)
+		}
+		groups[g.Name] = true
+	}
+	return nil
+}
+
+func validBlockingMode(mode BlockingMode) error {
+	switch mode {
+	case "", BlockNullIP, BlockNXDomain, BlockRefused, BlockNoData, BlockCustomIP:
+		return nil
+	}
+	return fmt.Errorf("invalid blocking_mode %q", mode)
+}
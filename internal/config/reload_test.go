@@ -0,0 +1,109 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffCopy(t *testing.T) {
+	a, b := Default(), Default()
+	b.BindPort = 5399
+	b.Allowlist = []string{"example.com"}
+	b.LocalRecords = LocalRecords{{Domain: "nas.lan", Type: RecordA, Value: "192.168.1.10"}}
+	b.Path = "/elsewhere/config.yaml"
+
+	changed := Diff(a, b, Keys())
+	want := []string{"bind_port", "local_records", "allowlist"}
+	if len(changed) != len(want) {
+		t.Fatalf("Diff = %v; want %v in any order", changed, want)
+	}
+	for _, key := range want {
+		if !strings.Contains(strings.Join(changed, " "), key) {
+			t.Errorf("Diff = %v; missing %s", changed, key)
+		}
+	}
+
+	Copy(a, b, []string{"bind_port", "allowlist"})
+	if a.BindPort != 5399 || !reflect.DeepEqual(a.Allowlist, b.Allowlist) {
+		t.Errorf("Copy did not take bind_port and allowlist: %d %v", a.BindPort, a.Allowlist)
+	}
+	if len(a.LocalRecords) != 0 || a.Path != "" {
+		t.Errorf("Copy changed settings it was not given")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	cfg := Default()
+	cfg.BindPort = 5399
+	if err := Save(cfg, path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if loaded.Path != path || loaded.BindPort != 5399 {
+		t.Errorf("Loaded %s with port %d", loaded.Path, loaded.BindPort)
+	}
+	if changed := Diff(cfg, loaded, Keys()); len(changed) != 0 {
+		t.Errorf("Saved and loaded configurations differ in %v", changed)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("Default configuration is invalid: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string
+	}{
+		{"port", func(c *Config) { c.BindPort = 70000 }, "bind_port"},
+		{"ip", func(c *Config) { c.BindIP = "localhost" }, "bind_ip"},
+		{"strategy", func(c *Config) { c.Upstream = "bogus" }, "upstream_strategy"},
+		{"custom", func(c *Config) { c.Upstream, c.CustomUpstream, c.CustomUpstreams = UpstreamCustom, "", nil }, "custom"},
+		{"blocking mode", func(c *Config) { c.BlockingMode = "sinkhole" }, "blocking_mode"},
+		{"blocking ip", func(c *Config) { c.BlockingIPv4 = "::1" }, "blocking_ipv4"},
+		{"source name", func(c *Config) {
+			c.Blocklists = append(c.Blocklists, BlocklistSource{Name: "Dup"}, BlocklistSource{Name: "Dup"})
+		}, "duplicate blocklist source"},
+		{"source format", func(c *Config) { c.Blocklists = []BlocklistSource{{Name: "x", Format: "csv"}} }, "invalid format"},
+		{"record", func(c *Config) {
+			c.LocalRecords = LocalRecords{{Domain: "nas.lan", Type: RecordA, Value: "not-an-ip"}}
+		}, "local record"},
+	}
+	for _, tt := range tests {
+		cfg := Default()
+		tt.modify(cfg)
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Validate() = %v; want an error about %s", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSaveCurrent(t *testing.T) {
+	cfg := Default()
+	cfg.ConfigDir = t.TempDir()
+	if err := SaveCurrent(cfg); err != nil {
+		t.Fatalf("SaveCurrent: %v", err)
+	}
+	if _, err := LoadFile(filepath.Join(cfg.ConfigDir, "config.yaml")); err != nil {
+		t.Errorf("Expected a configuration without a file to be saved in ConfigDir: %v", err)
+	}
+
+	// A loaded configuration is saved back where it came from
+	cfg.Path = filepath.Join(t.TempDir(), "etc", "config.yaml")
+	cfg.BindPort = 5399
+	if err := SaveCurrent(cfg); err != nil {
+		t.Fatalf("SaveCurrent: %v", err)
+	}
+	if loaded, err := LoadFile(cfg.Path); err != nil || loaded.BindPort != 5399 {
+		t.Errorf("Expected the change in %s, got %v", cfg.Path, err)
+	}
+}
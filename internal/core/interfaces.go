@@ -3,6 +3,8 @@ package core
 import (
 	"0x53/internal/config"
 	"context"
+	"net"
+	"time"
 )
 
 // Engine is the main controller of the Sinkhole.
@@ -12,15 +14,38 @@ type Engine interface {
 	Start(ctx context.Context) error
 	// Stop gracefully shuts down the server and restores system DNS.
 	Stop() error
-	// Reload refreshes blocklists and configuration without dropping connections.
-	Reload() error
-	// Stats returns total queries and blocked queries count.
-	Stats() (queries int, blocked int)
+	// Reload re-reads the configuration file and applies it without dropping
+	// connections, rebinding the listeners if the address changed. An
+	// invalid file is rejected as a whole.
+	Reload() (ReloadResult, error)
+	// Stats returns the query, blocking and cache counters.
+	Stats() Stats
+	// UpstreamStats returns per-upstream counters and health.
+	UpstreamStats() []UpstreamStats
+	// LatencyStats returns the query and upstream latency percentiles.
+	LatencyStats() LatencyStats
+	// TopStats returns the n most frequent domains and clients over window,
+	// which is rounded up to the tracker granularity and capped to a day.
+	TopStats(window time.Duration, n int) TopStats
 	
 	// Local Records
-	AddLocalRecord(domain, ip string) error
-	RemoveLocalRecord(domain string) error
-	ListLocalRecords() map[string]string
+	AddLocalRecord(rec config.LocalRecord) error
+	// RemoveLocalRecord deletes the records matching rec's domain, and its type and value if set.
+	RemoveLocalRecord(rec config.LocalRecord) error
+	ListLocalRecords() []config.LocalRecord
+	// ImportHosts imports or links a hosts-format file, see HostsImportOptions.
+	ImportHosts(opts HostsImportOptions) (HostsImportResult, error)
+
+	// Conditional Forwarding
+	AddForwardRule(rule config.ForwardRule) error
+	RemoveForwardRule(domain string) error
+	ListForwardRules() []config.ForwardRule
+
+	// Client Groups
+	// AddClientGroup adds or replaces the group with the same name.
+	AddClientGroup(group config.ClientGroup) error
+	RemoveClientGroup(name string) error
+	ListClientGroups() []config.ClientGroup
 }
 
 // BlocklistManager handles the lifecycle of blocklists.
@@ -31,19 +56,48 @@ type BlocklistManager interface {
 	// IsBlocked checks if a domain (or subdomain) is in the blocklist.
 	// Returns true if blocked.
 	IsBlocked(domain string) bool
-	// Stats returns the total count of blocked domains currently loaded.
+	// Match is like IsBlocked but also returns the source listing the domain.
+	Match(domain string) (config.BlocklistSource, bool)
+	// MatchGroup is like Match but applies the sources and allowlist of a
+	// client group (see config.ClientGroup); "" is the default policy.
+	MatchGroup(domain, group string) (config.BlocklistSource, bool)
+	// MatchIP reports whether an answer address lies in a blocked network
+	// ("ip" format sources) applied to the client group, and which source lists it.
+	MatchIP(ip net.IP, group string) (config.BlocklistSource, bool)
+	// Stats returns the total count of blocked domains and networks currently loaded.
 	Stats() int
+	// SourceStats returns the rule count and fetch statistics of every source.
+	SourceStats() []SourceStats
 	// ListSources returns the current list configuration.
 	ListSources() []config.BlocklistSource
 	// ToggleSource enables or disables a blocklist source.
 	ToggleSource(name string, enabled bool) error
     // InvalidateCache clears the local disk cache.
     InvalidateCache() error
+	// ApplyConfig takes the sources, allowlist and denylist of next and
+	// returns the keys of those that changed. New sources are fetched by
+	// the next LoadBlocklists.
+	ApplyConfig(next *config.Config) []string
 
 	// Allowlist Management
 	AddAllowed(domain string) error
 	RemoveAllowed(domain string) error
 	ListAllowed() []string
+	// IsAllowed reports whether domain is in the global allowlist or the
+	// one of a client group.
+	IsAllowed(domain, group string) bool
+
+	// Denylist Management
+	// AddBlocked blocks a domain and its subdomains for every client.
+	AddBlocked(domain string) error
+	RemoveBlocked(domain string) error
+	ListBlocked() []string
+}
+
+// QuerySink receives a QueryEvent for every query the engine handles.
+// Record is called on the query path and must not block.
+type QuerySink interface {
+	Record(ev QueryEvent)
 }
 
 // DNSConfigurator abstracts OS-specific network changes.
@@ -57,30 +111,64 @@ type DNSConfigurator interface {
 	// RestoreDNS reverts the system resolver to the pre-setup state.
 	// This should be called on application exit or crash recovery.
 	RestoreDNS() error
+	// DetectUpstreams returns the resolvers the system used before SetupDNS,
+	// and a short description of where they were found.
+	DetectUpstreams() (servers []string, source string, err error)
 }
 
 // Service defines the public API available to the TUI/CLI.
 // It can be implemented by a local struct (Monolith) or an RPC Client (Daemon mode).
 type Service interface {
 	// GetStats returns combined metrics.
-	GetStats() (queries, blocked, activeRules int, err error)
+	GetStats() (Stats, error)
+	// GetUpstreamStats returns per-upstream query/error counts and latency.
+	GetUpstreamStats() ([]UpstreamStats, error)
+	// GetLatencyStats returns the p50/p90/p99 of query and upstream latency.
+	GetLatencyStats() (LatencyStats, error)
+	// GetStatsSeries returns the query counters between from and to (zero is
+	// now), in steps of at least step: a minute for the last two days, an
+	// hour for the last 90 days, a day before.
+	GetStatsSeries(from, to time.Time, step time.Duration) (StatsSeries, error)
+	// GetTopStats returns the n top domains, blocked domains and clients over window.
+	GetTopStats(window time.Duration, n int) (TopStats, error)
 	
 	// Blocklist Management
 	ListSources() ([]config.BlocklistSource, error)
 	ToggleSource(name string, enabled bool) error
-	Reload() error
+	// Reload re-reads the configuration file, applies it and reloads the blocklists.
+	Reload() (ReloadResult, error)
 	
 	// Allowlist Management
 	AddAllowed(domain string) error
 	RemoveAllowed(domain string) error
 	ListAllowed() ([]string, error)
 
+	// Denylist Management
+	AddBlocked(domain string) error
+	RemoveBlocked(domain string) error
+	ListBlocked() ([]string, error)
+
 	// Local Records
-	AddLocalRecord(domain, ip string) error
-	RemoveLocalRecord(domain string) error
-	ListLocalRecords() (map[string]string, error)
+	AddLocalRecord(rec config.LocalRecord) error
+	RemoveLocalRecord(rec config.LocalRecord) error
+	ListLocalRecords() ([]config.LocalRecord, error)
+	ImportHosts(opts HostsImportOptions) (HostsImportResult, error)
+
+	// Conditional Forwarding
+	AddForwardRule(rule config.ForwardRule) error
+	RemoveForwardRule(domain string) error
+	ListForwardRules() ([]config.ForwardRule, error)
+
+	// Client Groups
+	AddClientGroup(group config.ClientGroup) error
+	RemoveClientGroup(name string) error
+	ListClientGroups() ([]config.ClientGroup, error)
 
 	// Logs
 	// GetRecentLogs returns the last 'count' lines of logs.
 	GetRecentLogs(count int) ([]string, error)
+	// GetQueryEvents returns the recent queries matching filter, newest first.
+	GetQueryEvents(filter QueryFilter) ([]QueryEvent, error)
+	// QueryHistory searches the persistent query history.
+	QueryHistory(q HistoryQuery) (HistoryPage, error)
 }
@@ -0,0 +1,207 @@
+package core
+
+import (
+	"strings"
+	"time"
+
+	"0x53/internal/config"
+)
+
+// Stats is a snapshot of the engine counters, as returned by Engine.Stats
+// and Service.GetStats.
+type Stats struct {
+	Queries     int
+	Blocked     int
+	Refused     int // Queries from clients rejected by the ACL, not counted in Queries
+	Throttled   int // Queries dropped by the per-client rate limit, not counted in Queries
+	ActiveRules int // Filled by the service from the blocklist manager
+
+	// Response cache
+	CacheHits    int
+	CacheMisses  int
+	CacheEntries int
+}
+
+// UpstreamStats describes one upstream resolver as seen by the forwarder.
+type UpstreamStats struct {
+	Address    string
+	Queries    int
+	Errors     int
+	AvgLatency time.Duration // Moving average of successful exchanges
+	Healthy    bool          // False while sidelined after repeated failures
+	Source     string        // How it was selected, e.g. "cloudflare" or "auto: resolvectl"
+}
+
+// Percentiles summarizes a latency distribution.
+type Percentiles struct {
+	Count         int // Samples
+	P50, P90, P99 time.Duration
+}
+
+// LatencyStats is a snapshot of the engine's latency distributions.
+type LatencyStats struct {
+	Query          Percentiles   // End to end, from receiving a query to answering it, since startup
+	Upstream       Percentiles   // Upstream exchanges of uncached forwarded queries, since startup
+	RecentQuery    Percentiles   // Same over the last Window
+	RecentUpstream Percentiles
+	Window         time.Duration
+}
+
+// TopEntry is a key counted by a top-K tracker. Trackers keep a bounded
+// number of keys, so the real count may differ from Count by up to Error.
+type TopEntry struct {
+	Key   string
+	Count int
+	Error int
+}
+
+// TopStats lists the most frequent domains and clients over Window.
+type TopStats struct {
+	Window         time.Duration
+	Domains        []TopEntry // Queried domains
+	Blocked        []TopEntry // Blocked domains
+	Clients        []TopEntry // Clients by number of queries
+	BlockedClients []TopEntry // Clients by number of blocked queries
+}
+
+// SourceStats describes the last load of one blocklist source.
+type SourceStats struct {
+	Name          string
+	Rules         int           // Domains or networks loaded, 0 if disabled or failing
+	FetchDuration time.Duration // Download (or cache read) time of the last load
+	Failures      int           // Failed fetches since startup
+}
+
+// ReloadResult reports what a configuration reload changed.
+type ReloadResult struct {
+	Path    string   // File read, empty when running without one
+	Changed []string // Keys of the settings that changed, in file order
+	Restart []string // Changed keys that only apply after a restart
+	Rebound bool     // True if the listeners moved to a new address
+}
+
+// HostsImportOptions controls an import of a hosts-format file into local records.
+type HostsImportOptions struct {
+	Path      string // Defaults to /etc/hosts
+	DryRun    bool   // Only report what would change
+	Overwrite bool   // Replace conflicting local records instead of keeping them
+	Link      bool   // Keep the file linked and re-read it on every reload, instead of copying its records
+	Unlink    bool   // Stop re-reading a linked file and drop its records; other options but DryRun are ignored
+}
+
+// HostsConflict is an imported record that disagrees with an existing local record.
+type HostsConflict struct {
+	Imported config.LocalRecord
+	Existing config.LocalRecord
+	Replaced bool // True if Overwrite removed Existing
+}
+
+// HostsImportResult reports what an import changed, or would change on a dry run.
+type HostsImportResult struct {
+	Path      string
+	Added     []config.LocalRecord
+	Unchanged int // Records already present
+	Invalid   int // Lines or names that could not be parsed
+	Conflicts []HostsConflict
+}
+
+// QueryStatus tells how a query was handled.
+type QueryStatus string
+
+const (
+	StatusAllowed   QueryStatus = "allowed"   // Answered from upstream or the cache
+	StatusBlocked   QueryStatus = "blocked"   // Sinkholed by a blocklist
+	StatusLocal     QueryStatus = "local"     // Answered from local records
+	StatusRebind    QueryStatus = "rebind"    // Refused by the DNS rebinding guard
+	StatusRefused   QueryStatus = "refused"   // Client rejected by the ACL
+	StatusThrottled QueryStatus = "throttled" // Client over its rate limit
+	StatusError     QueryStatus = "error"     // No upstream answered
+)
+
+// QueryEvent records one query and how it was answered.
+type QueryEvent struct {
+	Time     time.Time
+	Client   string // Client IP
+	Group    string // Client group, "" for the default policy
+	Domain   string // Lowercase, without trailing dot
+	Type     string // Query type, e.g. "AAAA"
+	Status   QueryStatus
+	Rcode    string // Response code sent, "" if the query was dropped
+	Upstream string // Upstream that answered, "" if none was asked
+	Cached   bool   // Answered from the response cache
+	Rule     string // What decided the answer: blocklist source, CNAME hop, removed address...
+	Latency  time.Duration
+}
+
+// QueryFilter selects query events. Zero fields match everything.
+type QueryFilter struct {
+	Client string      // Exact client IP
+	Domain string      // Substring of the domain
+	Status QueryStatus // Exact status
+	Since  time.Time   // Events at or after Since
+	Limit  int         // Maximum events returned, newest first; 0 for all
+}
+
+// Match reports whether ev is selected by f (Limit is not considered).
+func (f QueryFilter) Match(ev QueryEvent) bool {
+	return (f.Client == "" || ev.Client == f.Client) &&
+		(f.Domain == "" || strings.Contains(ev.Domain, strings.ToLower(f.Domain))) &&
+		(f.Status == "" || ev.Status == f.Status) &&
+		(f.Since.IsZero() || !ev.Time.Before(f.Since))
+}
+
+// HistoryQuery selects events from the persistent query history.
+// Zero fields match everything.
+type HistoryQuery struct {
+	From   time.Time   // Events at or after From
+	To     time.Time   // Events before To
+	Client string      // Exact client IP
+	Domain string      // Exact domain
+	Status QueryStatus // Exact status
+	Search string      // Case-insensitive text in the domain, client, rule or upstream
+	Offset int         // Matching events to skip, newest first
+	Limit  int         // Page size, 0 for the default
+}
+
+// Match reports whether ev is selected by q (Offset and Limit are not considered).
+func (q HistoryQuery) Match(ev QueryEvent) bool {
+	if (!q.From.IsZero() && ev.Time.Before(q.From)) || (!q.To.IsZero() && !ev.Time.Before(q.To)) {
+		return false
+	}
+	if (q.Client != "" && ev.Client != q.Client) ||
+		(q.Domain != "" && ev.Domain != strings.ToLower(q.Domain)) ||
+		(q.Status != "" && ev.Status != q.Status) {
+		return false
+	}
+	if q.Search == "" {
+		return true
+	}
+	text := strings.ToLower(q.Search)
+	for _, field := range []string{ev.Domain, ev.Client, ev.Rule, ev.Upstream} {
+		if strings.Contains(strings.ToLower(field), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// StatsPoint holds the query counters of one time series step.
+type StatsPoint struct {
+	Time    time.Time // Start of the step
+	Queries int       // As in Stats, refused and throttled queries excluded
+	Blocked int
+	Cached  int // Answered from the response cache
+	Errors  int // No upstream answered
+}
+
+// StatsSeries is a time series of query counters.
+type StatsSeries struct {
+	Step   time.Duration
+	Points []StatsPoint // Every step of the range, oldest first
+}
+
+// HistoryPage is one page of a history query.
+type HistoryPage struct {
+	Events []QueryEvent // Newest first
+	Total  int          // Matching events over all pages
+}
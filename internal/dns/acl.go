@@ -0,0 +1,127 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"0x53/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+// clientACL decides which clients may query, compiled from
+// cfg.AllowClients and cfg.DenyClients. Deny entries win.
+type clientACL struct {
+	allow []*net.IPNet // Empty allows every client
+	deny  []*net.IPNet
+	drop  bool // Drop refused queries instead of answering REFUSED
+}
+
+// newClientACL compiles the access lists of cfg.
+func newClientACL(cfg *config.Config) (*clientACL, error) {
+	allow, err := parseNets(cfg.AllowClients)
+	if err != nil {
+		return nil, fmt.Errorf("allow_clients: %w", err)
+	}
+	deny, err := parseNets(cfg.DenyClients)
+	if err != nil {
+		return nil, fmt.Errorf("deny_clients: %w", err)
+	}
+
+	acl := &clientACL{allow: allow, deny: deny}
+	switch config.ACLAction(strings.ToLower(string(cfg.ACLAction))) {
+	case "", config.ACLRefuse:
+	case config.ACLDrop:
+		acl.drop = true
+	default:
+		return nil, fmt.Errorf("invalid acl_action %q: want %s or %s", cfg.ACLAction, config.ACLRefuse, config.ACLDrop)
+	}
+	return acl, nil
+}
+
+// parseNets parses CIDRs, bare addresses standing for themselves.
+func parseNets(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if ip := net.ParseIP(e); ip != nil {
+			bits := 8 * net.IPv6len
+			if v4 := ip.To4(); v4 != nil {
+				ip, bits = v4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", e)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// allowed reports whether ip may query. A nil ACL allows everyone.
+func (a *clientACL) allowed(ip net.IP) bool {
+	if a == nil {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, n := range a.deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(a.allow) == 0 {
+		return true
+	}
+	for _, n := range a.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// configureACL (re)builds the client access lists from config.
+func (s *Server) configureACL() error {
+	s.mu.RLock()
+	acl, err := newClientACL(s.cfg)
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.acl = acl
+	s.mu.Unlock()
+	return nil
+}
+
+// admit checks the client against the access lists. Refused queries are
+// counted and answered REFUSED, or dropped; admit then returns false.
+func (s *Server) admit(w dns.ResponseWriter, r *dns.Msg) bool {
+	s.mu.RLock()
+	acl := s.acl
+	s.mu.RUnlock()
+
+	if acl.allowed(clientIP(w.RemoteAddr())) {
+		return true
+	}
+	atomic.AddUint64(&s.statsRefused, 1)
+	if acl.drop {
+		w.Close()
+		return false
+	}
+	m := new(dns.Msg)
+	m.SetRcode(r, dns.RcodeRefused)
+	w.WriteMsg(m)
+	return false
+}
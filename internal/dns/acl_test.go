@@ -0,0 +1,83 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"0x53/internal/blocklist"
+	"0x53/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+func TestClientACL(t *testing.T) {
+	cfg := config.Default()
+	cfg.DenyClients = []string{"192.168.66.0/24", "10.1.2.3"}
+
+	acl, err := newClientACL(cfg)
+	if err != nil {
+		t.Fatalf("newClientACL: %v", err)
+	}
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"192.168.1.10", true},
+		{"::ffff:192.168.1.10", true},
+		{"172.20.0.5", true},
+		{"fd12::1", true},
+		{"192.168.66.7", false}, // Denied network
+		{"10.1.2.3", false},     // Denied address
+		{"10.1.2.4", true},
+		{"203.0.113.9", false},
+		{"2001:db8::1", false},
+	}
+	for _, tt := range tests {
+		if got := acl.allowed(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("allowed(%s) = %v; want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	cfg.AllowClients = nil
+	if acl, _ := newClientACL(cfg); !acl.allowed(net.ParseIP("203.0.113.9")) {
+		t.Error("Expected an empty allow list to admit every client")
+	}
+	cfg.AllowClients = []string{"not-a-network"}
+	if _, err := newClientACL(cfg); err == nil {
+		t.Error("Expected invalid network to be rejected")
+	}
+}
+
+func TestServer_RefusesOutsideClients(t *testing.T) {
+	cfg := config.Default()
+	srv := NewServer(cfg, blocklist.NewMockManager())
+
+	query := func() *dns.Msg {
+		r := new(dns.Msg)
+		r.SetQuestion("example.com.", dns.TypeA)
+		return r
+	}
+
+	w := &testWriter{remote: &net.UDPAddr{IP: net.ParseIP("198.51.100.20"), Port: 4000}}
+	srv.handleRequest(w, query())
+	if w.msg == nil || w.msg.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED for a public client, got %v", w.msg)
+	}
+
+	cfg.ACLAction = config.ACLDrop
+	if err := srv.configureACL(); err != nil {
+		t.Fatalf("configureACL: %v", err)
+	}
+	w = &testWriter{remote: &net.TCPAddr{IP: net.ParseIP("198.51.100.20"), Port: 4000}}
+	srv.handleRequest(w, query())
+	if w.msg != nil {
+		t.Errorf("Expected the query to be dropped, got %v", w.msg)
+	}
+
+	st := srv.Stats()
+	if st.Refused != 2 || st.Queries != 0 {
+		t.Errorf("Expected 2 refused and 0 queries, got %d and %d", st.Refused, st.Queries)
+	}
+}
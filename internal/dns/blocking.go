@@ -0,0 +1,143 @@
+package dns
+
+import (
+	"net"
+
+	"0x53/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+// sinkhole answers a blocked query according to the blocking mode of the
+// source, else of the client's group, else the global one.
+func (s *Server) sinkhole(w dns.ResponseWriter, r *dns.Msg, src config.BlocklistSource, group config.ClientGroup) {
+	if src.BlockingMode == "" {
+		src.BlockingMode = group.BlockingMode
+	}
+	w.WriteMsg(s.blockedResponse(r, src))
+}
+
+// cloakedBy returns the first CNAME target in resp's answer chain that is
+// blocked for the client group, catching trackers hidden behind first-party names.
+func (s *Server) cloakedBy(resp *dns.Msg, group string) (string, config.BlocklistSource, bool) {
+	s.mu.RLock()
+	enabled := s.cfg.BlockCNAMECloaking
+	s.mu.RUnlock()
+	if !enabled || s.blocklists == nil {
+		return "", config.BlocklistSource{}, false
+	}
+
+	for _, rr := range resp.Answer {
+		cname, ok := rr.(*dns.CNAME)
+		if !ok {
+			continue
+		}
+		target := normalizeDomain(cname.Target)
+		if src, blocked := s.blocklists.MatchGroup(target, group); blocked {
+			return target, src, true
+		}
+	}
+	return "", config.BlocklistSource{}, false
+}
+
+// blockedAddress returns the first A/AAAA address in resp's answer that lies
+// in a network blocked for the client group.
+func (s *Server) blockedAddress(resp *dns.Msg, group string) (net.IP, config.BlocklistSource, bool) {
+	if s.blocklists == nil {
+		return nil, config.BlocklistSource{}, false
+	}
+	for _, rr := range resp.Answer {
+		var ip net.IP
+		switch rr := rr.(type) {
+		case *dns.A:
+			ip = rr.A
+		case *dns.AAAA:
+			ip = rr.AAAA
+		default:
+			continue
+		}
+		if src, blocked := s.blocklists.MatchIP(ip, group); blocked {
+			return ip, src, true
+		}
+	}
+	return nil, config.BlocklistSource{}, false
+}
+
+// blockedResponse builds the answer for a blocked query. The source may
+// override the global blocking mode and TTL.
+func (s *Server) blockedResponse(r *dns.Msg, src config.BlocklistSource) *dns.Msg {
+	s.mu.RLock()
+	mode, ttl := s.cfg.BlockingMode, s.cfg.BlockTTL
+	ipv4, ipv6 := s.cfg.BlockingIPv4, s.cfg.BlockingIPv6
+	s.mu.RUnlock()
+
+	if src.BlockingMode != "" {
+		mode = src.BlockingMode
+	}
+	if src.BlockTTL != 0 {
+		ttl = src.BlockTTL
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	// Some apps retry aggressively on 0.0.0.0 while others hang on NXDOMAIN,
+	// so the answer style is configurable.
+	switch mode {
+	case config.BlockNXDomain:
+		m.Rcode = dns.RcodeNameError
+		m.Ns = negativeSOA(r, ttl)
+		return m
+	case config.BlockRefused:
+		m.Rcode = dns.RcodeRefused
+		return m
+	case config.BlockNoData:
+		m.Ns = negativeSOA(r, ttl)
+		return m
+	case config.BlockCustomIP:
+	default: // config.BlockNullIP
+		ipv4, ipv6 = "", ""
+	}
+
+	v4 := net.ParseIP(ipv4).To4()
+	if v4 == nil {
+		v4 = net.IPv4zero.To4()
+	}
+	v6 := net.ParseIP(ipv6)
+	if v6 == nil || v6.To4() != nil {
+		v6 = net.IPv6unspecified
+	}
+
+	for _, q := range r.Question {
+		hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: ttl}
+		switch q.Qtype {
+		case dns.TypeA:
+			m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: v4})
+		case dns.TypeAAAA:
+			m.Answer = append(m.Answer, &dns.AAAA{Hdr: hdr, AAAA: v6})
+		}
+	}
+	if len(m.Answer) == 0 {
+		// Other qtypes get NODATA
+		m.Ns = negativeSOA(r, ttl)
+	}
+	return m
+}
+
+// negativeSOA returns a synthetic SOA for the queried name so clients can
+// cache the negative answer for ttl seconds (RFC 2308).
+func negativeSOA(r *dns.Msg, ttl uint32) []dns.RR {
+	if len(r.Question) == 0 {
+		return nil
+	}
+	return []dns.RR{&dns.SOA{
+		Hdr:     dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+		Ns:      "ns.0x53.invalid.",
+		Mbox:    "hostmaster.0x53.invalid.",
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  ttl,
+	}}
+}
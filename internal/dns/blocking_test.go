@@ -0,0 +1,179 @@
+package dns
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"0x53/internal/blocklist"
+	"0x53/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+func TestServer_BlockingModes(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   config.BlockingMode
+		src    config.BlocklistSource
+		qtype  uint16
+		rcode  int
+		answer string // Expected first answer, "" for none
+		soa    bool
+		ttl    uint32
+	}{
+		{"null A", config.BlockNullIP, config.BlocklistSource{}, dns.TypeA, dns.RcodeSuccess, "0.0.0.0", false, 120},
+		{"null AAAA", config.BlockNullIP, config.BlocklistSource{}, dns.TypeAAAA, dns.RcodeSuccess, "::", false, 120},
+		{"null MX is NODATA", config.BlockNullIP, config.BlocklistSource{}, dns.TypeMX, dns.RcodeSuccess, "", true, 120},
+		{"nxdomain", config.BlockNXDomain, config.BlocklistSource{}, dns.TypeA, dns.RcodeNameError, "", true, 120},
+		{"refused", config.BlockRefused, config.BlocklistSource{}, dns.TypeA, dns.RcodeRefused, "", false, 0},
+		{"nodata", config.BlockNoData, config.BlocklistSource{}, dns.TypeAAAA, dns.RcodeSuccess, "", true, 120},
+		{"custom A", config.BlockCustomIP, config.BlocklistSource{}, dns.TypeA, dns.RcodeSuccess, "192.168.1.250", false, 120},
+		{"custom AAAA", config.BlockCustomIP, config.BlocklistSource{}, dns.TypeAAAA, dns.RcodeSuccess, "fd00::250", false, 120},
+		{"source override", config.BlockNullIP, config.BlocklistSource{BlockingMode: config.BlockNXDomain, BlockTTL: 5}, dns.TypeA, dns.RcodeNameError, "", true, 5},
+	}
+
+	for _, tt := range tests {
+		cfg := config.Default()
+		cfg.BlockingMode = tt.mode
+		cfg.BlockTTL = 120
+		cfg.BlockingIPv4 = "192.168.1.250"
+		cfg.BlockingIPv6 = "fd00::250"
+		srv := NewServer(cfg, blocklist.NewMockManager())
+
+		q := new(dns.Msg)
+		q.SetQuestion("ads.example.", tt.qtype)
+		m := srv.blockedResponse(q, tt.src)
+
+		if m.Rcode != tt.rcode {
+			t.Errorf("%s: rcode = %d; want %d", tt.name, m.Rcode, tt.rcode)
+		}
+		switch {
+		case tt.answer == "" && len(m.Answer) != 0:
+			t.Errorf("%s: expected no answer, got %v", tt.name, m.Answer)
+		case tt.answer != "":
+			if len(m.Answer) != 1 {
+				t.Errorf("%s: expected 1 answer, got %d", tt.name, len(m.Answer))
+				continue
+			}
+			var got string
+			switch rr := m.Answer[0].(type) {
+			case *dns.A:
+				got = rr.A.String()
+			case *dns.AAAA:
+				got = rr.AAAA.String()
+			}
+			if got != tt.answer || m.Answer[0].Header().Ttl != tt.ttl {
+				t.Errorf("%s: answer = %s ttl %d; want %s ttl %d", tt.name, got, m.Answer[0].Header().Ttl, tt.answer, tt.ttl)
+			}
+		}
+		if tt.soa {
+			if len(m.Ns) != 1 {
+				t.Errorf("%s: expected synthetic SOA", tt.name)
+			} else if soa := m.Ns[0].(*dns.SOA); soa.Minttl != tt.ttl {
+				t.Errorf("%s: SOA minimum = %d; want %d", tt.name, soa.Minttl, tt.ttl)
+			}
+		}
+	}
+}
+
+func TestServer_CNAMECloaking(t *testing.T) {
+	upstream := startUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		for _, s := range []string{
+			r.Question[0].Name + " 60 IN CNAME cdn.first.example.",
+			"cdn.first.example. 60 IN CNAME tracker.adtech.example.",
+			"tracker.adtech.example. 60 IN A 203.0.113.9",
+		} {
+			rr, _ := dns.NewRR(s)
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})
+
+	cfg := config.Default()
+	cfg.BindIP = "127.0.0.1"
+	cfg.BindPort = 5357
+	cfg.Upstream = config.UpstreamCustom
+	cfg.CustomUpstream = upstream
+
+	bl := blocklist.NewMockManager()
+	bl.Add("tracker.adtech.example")
+
+	srv := NewServer(cfg, bl)
+	var (
+		logMu  sync.Mutex
+		logged []string
+	)
+	srv.SetLogger(func(msg string) {
+		logMu.Lock()
+		logged = append(logged, msg)
+		logMu.Unlock()
+	})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer srv.Stop()
+	<-srv.Ready
+
+	query := func() *dns.Msg {
+		c := &dns.Client{Timeout: time.Second}
+		m := new(dns.Msg)
+		m.SetQuestion("metrics.first.example.", dns.TypeA)
+		r, _, err := c.Exchange(m, "127.0.0.1:5357")
+		if err != nil {
+			t.Fatalf("Exchange failed: %v", err)
+		}
+		return r
+	}
+
+	r := query()
+	if len(r.Answer) != 1 || r.Answer[0].(*dns.A).A.String() != "0.0.0.0" {
+		t.Fatalf("Expected cloaked tracker to be sinkholed, got %v", r.Answer)
+	}
+	logMu.Lock()
+	last := logged[len(logged)-1]
+	logMu.Unlock()
+	if !strings.Contains(last, "via CNAME tracker.adtech.example") {
+		t.Errorf("Expected the matching hop in the log, got %q", last)
+	}
+	if got := srv.Stats().Blocked; got != 1 {
+		t.Errorf("Expected 1 blocked query, got %d", got)
+	}
+
+	srv.mu.Lock()
+	srv.cfg.BlockCNAMECloaking = false
+	srv.mu.Unlock()
+	if r := query(); len(r.Answer) != 3 {
+		t.Errorf("Expected the upstream chain with cloaking checks off, got %v", r.Answer)
+	}
+}
+
+func TestServer_BlockedAddress(t *testing.T) {
+	bl := blocklist.NewMockManager()
+	bl.AddCIDR("198.51.100.0/24")
+	srv := NewServer(config.Default(), bl)
+
+	resp := new(dns.Msg)
+	for _, s := range []string{
+		"rotating.example. 60 IN CNAME edge.example.",
+		"edge.example. 60 IN A 192.0.2.1",
+		"edge.example. 60 IN A 198.51.100.23",
+	} {
+		rr, _ := dns.NewRR(s)
+		resp.Answer = append(resp.Answer, rr)
+	}
+
+	ip, src, blocked := srv.blockedAddress(resp, "")
+	if !blocked || ip.String() != "198.51.100.23" || src.Name != "mock" {
+		t.Errorf("Expected 198.51.100.23 to be blocked, got %v %q %v", ip, src.Name, blocked)
+	}
+
+	resp.Answer = resp.Answer[:2]
+	if _, _, blocked := srv.blockedAddress(resp, ""); blocked {
+		t.Error("Answer outside the listed ranges should pass")
+	}
+}
@@ -0,0 +1,230 @@
+package dns
+
+import (
+	"container/list"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const cacheShards = 16
+
+// cacheKey identifies a cached answer.
+type cacheKey struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+	edns   bool // Client sent an OPT record, which the answer echoes
+	do     bool // DNSSEC OK bit, answers differ when set
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	msg     *dns.Msg
+	stored  time.Time
+	expires time.Time
+}
+
+// cacheShard is an LRU bounded map guarded by its own lock.
+type cacheShard struct {
+	mu       sync.Mutex
+	items    map[cacheKey]*list.Element
+	lru      *list.List // Front is most recently used
+	capacity int
+}
+
+// answerCache is a bounded, sharded cache of upstream answers.
+// Positive answers live for the smallest TTL in the answer section,
+// NXDOMAIN/NODATA answers for the SOA minimum (RFC 2308).
+type answerCache struct {
+	shards [cacheShards]*cacheShard
+	minTTL uint32
+	maxTTL uint32
+
+	hits   uint64
+	misses uint64
+}
+
+// newAnswerCache creates a cache holding up to size answers.
+// It returns nil if size is not positive, which disables caching.
+func newAnswerCache(size int, minTTL, maxTTL uint32) *answerCache {
+	if size <= 0 {
+		return nil
+	}
+	perShard := size / cacheShards
+	if perShard < 1 {
+		perShard = 1
+	}
+
+	c := &answerCache{minTTL: minTTL, maxTTL: maxTTL}
+	for i := range c.shards {
+		c.shards[i] = &cacheShard{
+			items:    make(map[cacheKey]*list.Element),
+			lru:      list.New(),
+			capacity: perShard,
+		}
+	}
+	return c
+}
+
+// keyFor builds the cache key of a query. Only single question queries are cacheable.
+func keyFor(r *dns.Msg) (cacheKey, bool) {
+	if len(r.Question) != 1 {
+		return cacheKey{}, false
+	}
+	q := r.Question[0]
+	key := cacheKey{
+		name:   strings.ToLower(q.Name),
+		qtype:  q.Qtype,
+		qclass: q.Qclass,
+	}
+	if opt := r.IsEdns0(); opt != nil {
+		key.edns = true
+		key.do = opt.Do()
+	}
+	return key, true
+}
+
+func (c *answerCache) shard(key cacheKey) *cacheShard {
+	h := fnv.New32a()
+	h.Write([]byte(key.name))
+	return c.shards[h.Sum32()%cacheShards]
+}
+
+// Get returns a copy of the cached answer for r, with TTLs decremented by
+// the time spent in the cache and the ID/question taken from r.
+func (c *answerCache) Get(r *dns.Msg) (*dns.Msg, bool) {
+	key, ok := keyFor(r)
+	if !ok {
+		return nil, false
+	}
+
+	now := time.Now()
+	sh := c.shard(key)
+	sh.mu.Lock()
+	elem, found := sh.items[key]
+	if !found {
+		sh.mu.Unlock()
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !now.Before(entry.expires) {
+		sh.lru.Remove(elem)
+		delete(sh.items, key)
+		sh.mu.Unlock()
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	sh.lru.MoveToFront(elem)
+	msg := entry.msg.Copy()
+	stored := entry.stored
+	sh.mu.Unlock()
+
+	atomic.AddUint64(&c.hits, 1)
+
+	elapsed := uint32(now.Sub(stored) / time.Second)
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range section {
+			hdr := rr.Header()
+			if hdr.Rrtype == dns.TypeOPT {
+				continue
+			}
+			if hdr.Ttl > elapsed {
+				hdr.Ttl -= elapsed
+			} else {
+				hdr.Ttl = 0
+			}
+		}
+	}
+
+	msg.Id = r.Id
+	msg.Question = r.Question
+	return msg, true
+}
+
+// Set stores the upstream answer to r if it is cacheable.
+func (c *answerCache) Set(r, resp *dns.Msg) {
+	key, ok := keyFor(r)
+	if !ok || resp.Truncated {
+		return
+	}
+	ttl, ok := c.ttlFor(resp)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	entry := &cacheEntry{
+		key:     key,
+		msg:     resp.Copy(),
+		stored:  now,
+		expires: now.Add(time.Duration(ttl) * time.Second),
+	}
+
+	sh := c.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if elem, found := sh.items[key]; found {
+		elem.Value = entry
+		sh.lru.MoveToFront(elem)
+		return
+	}
+	sh.items[key] = sh.lru.PushFront(entry)
+	for sh.lru.Len() > sh.capacity {
+		oldest := sh.lru.Back()
+		sh.lru.Remove(oldest)
+		delete(sh.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// ttlFor returns how long resp may be cached, clamped to the configured bounds.
+func (c *answerCache) ttlFor(resp *dns.Msg) (uint32, bool) {
+	var ttl uint32
+	var found bool
+
+	switch {
+	case resp.Rcode == dns.RcodeSuccess && len(resp.Answer) > 0:
+		for _, rr := range resp.Answer {
+			if !found || rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+				found = true
+			}
+		}
+	case resp.Rcode == dns.RcodeNameError || resp.Rcode == dns.RcodeSuccess:
+		// Negative answer: without an SOA it must not be cached (RFC 2308 §5)
+		for _, rr := range resp.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				ttl = min(soa.Hdr.Ttl, soa.Minttl)
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return 0, false
+	}
+
+	if ttl < c.minTTL {
+		ttl = c.minTTL
+	}
+	if c.maxTTL > 0 && ttl > c.maxTTL {
+		ttl = c.maxTTL
+	}
+	return ttl, ttl > 0
+}
+
+// Stats returns hit, miss and entry counts.
+func (c *answerCache) Stats() (hits, misses, entries int) {
+	for _, sh := range c.shards {
+		sh.mu.Lock()
+		entries += sh.lru.Len()
+		sh.mu.Unlock()
+	}
+	return int(atomic.LoadUint64(&c.hits)), int(atomic.LoadUint64(&c.misses)), entries
+}
@@ -0,0 +1,131 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestAnswerCache_PositiveAndNegative(t *testing.T) {
+	c := newAnswerCache(100, 0, 3600)
+
+	// Positive answer: cached for the smallest answer TTL
+	q := new(dns.Msg)
+	q.SetQuestion("Example.com.", dns.TypeA)
+	resp := new(dns.Msg)
+	resp.SetReply(q)
+	rr, _ := dns.NewRR("example.com. 300 IN A 192.0.2.1")
+	resp.Answer = append(resp.Answer, rr)
+	c.Set(q, resp)
+
+	q2 := new(dns.Msg)
+	q2.SetQuestion("example.com.", dns.TypeA)
+	got, ok := c.Get(q2)
+	if !ok {
+		t.Fatal("Expected cache hit (names are case-insensitive)")
+	}
+	if got.Id != q2.Id {
+		t.Errorf("Expected ID %d, got %d", q2.Id, got.Id)
+	}
+	if ttl := got.Answer[0].Header().Ttl; ttl > 300 {
+		t.Errorf("TTL should not grow in cache, got %d", ttl)
+	}
+
+	// NXDOMAIN with SOA: cached using the SOA minimum
+	nx := new(dns.Msg)
+	nx.SetQuestion("missing.example.com.", dns.TypeA)
+	nxResp := new(dns.Msg)
+	nxResp.SetRcode(nx, dns.RcodeNameError)
+	soa, _ := dns.NewRR("example.com. 3600 IN SOA ns.example.com. admin.example.com. 1 7200 900 1209600 60")
+	nxResp.Ns = append(nxResp.Ns, soa)
+	c.Set(nx, nxResp)
+	if got, ok := c.Get(nx); !ok || got.Rcode != dns.RcodeNameError {
+		t.Error("Expected cached NXDOMAIN")
+	}
+	if ttl, _ := c.ttlFor(nxResp); ttl != 60 {
+		t.Errorf("Expected negative TTL 60 (SOA minimum), got %d", ttl)
+	}
+
+	// NODATA without SOA must not be cached
+	nodata := new(dns.Msg)
+	nodata.SetQuestion("example.com.", dns.TypeAAAA)
+	nodataResp := new(dns.Msg)
+	nodataResp.SetReply(nodata)
+	c.Set(nodata, nodataResp)
+	if _, ok := c.Get(nodata); ok {
+		t.Error("NODATA without SOA should not be cached")
+	}
+
+	// DO bit is part of the key
+	dnssec := new(dns.Msg)
+	dnssec.SetQuestion("example.com.", dns.TypeA)
+	dnssec.SetEdns0(1232, true)
+	if _, ok := c.Get(dnssec); ok {
+		t.Error("Query with DO bit should not hit the plain entry")
+	}
+
+	hits, misses, entries := c.Stats()
+	if hits != 2 || misses != 2 || entries != 2 {
+		t.Errorf("Unexpected stats: hits=%d misses=%d entries=%d", hits, misses, entries)
+	}
+}
+
+func TestAnswerCache_EDNS(t *testing.T) {
+	c := newAnswerCache(100, 0, 3600)
+
+	// An EDNS query caches an answer carrying the upstream OPT record
+	edns := new(dns.Msg)
+	edns.SetQuestion("example.com.", dns.TypeA)
+	edns.SetEdns0(1232, false)
+	resp := new(dns.Msg)
+	resp.SetReply(edns)
+	rr, _ := dns.NewRR("example.com. 300 IN A 192.0.2.1")
+	resp.Answer = append(resp.Answer, rr)
+	resp.SetEdns0(1232, false)
+	c.Set(edns, resp)
+
+	// A plain query must not be answered with it
+	plain := new(dns.Msg)
+	plain.SetQuestion("example.com.", dns.TypeA)
+	if got, ok := c.Get(plain); ok && got.IsEdns0() != nil {
+		t.Fatal("Plain query was answered with an OPT record")
+	}
+
+	if got, ok := c.Get(edns); !ok || got.IsEdns0() == nil {
+		t.Error("Expected cached EDNS answer for the EDNS query")
+	}
+}
+
+func TestAnswerCache_TTLClamp(t *testing.T) {
+	c := newAnswerCache(100, 30, 600)
+
+	resp := new(dns.Msg)
+	rr, _ := dns.NewRR("short.example. 5 IN A 192.0.2.1")
+	resp.Answer = []dns.RR{rr}
+	if ttl, _ := c.ttlFor(resp); ttl != 30 {
+		t.Errorf("Expected min clamp 30, got %d", ttl)
+	}
+
+	rr.Header().Ttl = 86400
+	if ttl, _ := c.ttlFor(resp); ttl != 600 {
+		t.Errorf("Expected max clamp 600, got %d", ttl)
+	}
+}
+
+func TestAnswerCache_Eviction(t *testing.T) {
+	c := newAnswerCache(cacheShards, 0, 0) // One entry per shard
+
+	for _, name := range []string{"a.example.", "b.example.", "c.example.", "d.example."} {
+		q := new(dns.Msg)
+		q.SetQuestion(name, dns.TypeA)
+		resp := new(dns.Msg)
+		resp.SetReply(q)
+		rr, _ := dns.NewRR(name + " 300 IN A 192.0.2.1")
+		resp.Answer = []dns.RR{rr}
+		c.Set(q, resp)
+	}
+
+	if _, _, entries := c.Stats(); entries > cacheShards {
+		t.Errorf("Cache exceeded its bound: %d entries", entries)
+	}
+}
@@ -0,0 +1,179 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"0x53/internal/config"
+)
+
+// clientTable finds the group of a client, compiled from cfg.ClientGroups.
+// An exact IP wins over a MAC, which wins over the longest matching CIDR;
+// a client listed by several groups belongs to the first one.
+type clientTable struct {
+	groups map[string]config.ClientGroup
+	ips    map[string]string // Canonical IP -> group
+	macs   map[string]string // Canonical MAC -> group
+	nets   []clientNet       // Longest prefix first
+}
+
+type clientNet struct {
+	net   *net.IPNet
+	group string
+}
+
+func newClientTable(groups []config.ClientGroup) *clientTable {
+	t := &clientTable{
+		groups: make(map[string]config.ClientGroup, len(groups)),
+		ips:    make(map[string]string),
+		macs:   make(map[string]string),
+	}
+	for _, g := range groups {
+		t.groups[g.Name] = g
+		for _, c := range g.Clients {
+			kind, canon, err := config.ParseClient(c)
+			if err != nil {
+				continue
+			}
+			switch kind {
+			case config.ClientIP:
+				if _, ok := t.ips[canon]; !ok {
+					t.ips[canon] = g.Name
+				}
+			case config.ClientMAC:
+				if _, ok := t.macs[canon]; !ok {
+					t.macs[canon] = g.Name
+				}
+			case config.ClientCIDR:
+				_, n, _ := net.ParseCIDR(canon)
+				t.nets = append(t.nets, clientNet{net: n, group: g.Name})
+			}
+		}
+	}
+	sort.SliceStable(t.nets, func(i, j int) bool {
+		a, _ := t.nets[i].net.Mask.Size()
+		b, _ := t.nets[j].net.Mask.Size()
+		return a > b
+	})
+	return t
+}
+
+// match returns the group of ip. lookupMAC may be nil when MACs cannot be resolved.
+func (t *clientTable) match(ip net.IP, lookupMAC func(net.IP) (net.HardwareAddr, bool)) (config.ClientGroup, bool) {
+	if len(t.groups) == 0 {
+		return config.ClientGroup{}, false
+	}
+	if name, ok := t.ips[ip.String()]; ok {
+		return t.groups[name], true
+	}
+	if len(t.macs) > 0 && lookupMAC != nil {
+		if mac, ok := lookupMAC(ip); ok {
+			if name, ok := t.macs[mac.String()]; ok {
+				return t.groups[name], true
+			}
+		}
+	}
+	for _, n := range t.nets {
+		if n.net.Contains(ip) {
+			return t.groups[n.group], true
+		}
+	}
+	return config.ClientGroup{}, false
+}
+
+// clientIP extracts the address of a client.
+func clientIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// clientGroup returns the group of the client at addr, or the zero group
+// (the default policy) if it belongs to none.
+func (s *Server) clientGroup(addr net.Addr) config.ClientGroup {
+	ip := clientIP(addr)
+	if ip == nil {
+		return config.ClientGroup{}
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4 // IPv4-mapped clients of a dual-stack socket
+	}
+
+	s.mu.RLock()
+	table, lookupMAC := s.clients, s.neighbors
+	s.mu.RUnlock()
+
+	group, _ := table.match(ip, lookupMAC)
+	return group
+}
+
+// --- Client Groups Management ---
+
+// AddClientGroup adds or replaces the group named g.Name. The blocklists
+// must be reloaded for changes to its sources and allowlist to apply.
+func (s *Server) AddClientGroup(g config.ClientGroup) error {
+	g.Normalize()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := g.Validate(s.cfg.Blocklists); err != nil {
+		return err
+	}
+
+	groups := make([]config.ClientGroup, 0, len(s.cfg.ClientGroups)+1)
+	replaced := false
+	for _, ex := range s.cfg.ClientGroups {
+		if ex.Name == g.Name {
+			ex, replaced = g, true
+		}
+		groups = append(groups, ex)
+	}
+	if !replaced {
+		groups = append(groups, g)
+	}
+
+	s.cfg.ClientGroups = groups
+	s.clients = newClientTable(groups)
+	return config.SaveCurrent(s.cfg)
+}
+
+// RemoveClientGroup deletes the group named name.
+func (s *Server) RemoveClientGroup(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups := make([]config.ClientGroup, 0, len(s.cfg.ClientGroups))
+	for _, g := range s.cfg.ClientGroups {
+		if g.Name != name {
+			groups = append(groups, g)
+		}
+	}
+	if len(groups) == len(s.cfg.ClientGroups) {
+		return fmt.Errorf("client group not found: %s", name)
+	}
+
+	s.cfg.ClientGroups = groups
+	s.clients = newClientTable(groups)
+	return config.SaveCurrent(s.cfg)
+}
+
+// ListClientGroups returns a copy of the configured groups.
+func (s *Server) ListClientGroups() []config.ClientGroup {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dst := make([]config.ClientGroup, len(s.cfg.ClientGroups))
+	for i, g := range s.cfg.ClientGroups {
+		g.Clients = append([]string(nil), g.Clients...)
+		g.Sources = append([]string(nil), g.Sources...)
+		g.Allowlist = append([]string(nil), g.Allowlist...)
+		dst[i] = g
+	}
+	return dst
+}
@@ -0,0 +1,115 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"0x53/internal/blocklist"
+	"0x53/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+// testWriter is a dns.ResponseWriter recording the answer sent to a client.
+type testWriter struct {
+	remote net.Addr
+	msg    *dns.Msg
+}
+
+func (w *testWriter) LocalAddr() net.Addr         { return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53} }
+func (w *testWriter) RemoteAddr() net.Addr        { return w.remote }
+func (w *testWriter) WriteMsg(m *dns.Msg) error   { w.msg = m; return nil }
+func (w *testWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *testWriter) Close() error                { return nil }
+func (w *testWriter) TsigStatus() error           { return nil }
+func (w *testWriter) TsigTimersOnly(bool)         {}
+func (w *testWriter) Hijack()                     {}
+
+func TestServer_ClientGroups(t *testing.T) {
+	upstream := startUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A 203.0.113.7")
+		m.Answer = append(m.Answer, rr)
+		w.WriteMsg(m)
+	})
+
+	cfg := config.Default()
+	cfg.ConfigDir = t.TempDir()
+	cfg.Upstream = config.UpstreamCustom
+	cfg.CustomUpstream = upstream
+	cfg.ClientGroups = []config.ClientGroup{
+		{Name: "kids", Clients: []string{"192.168.1.50", "AA-BB-CC-DD-EE-FF"}, BlockingMode: config.BlockNXDomain},
+		{Name: "iot", Clients: []string{"192.168.0.0/16"}},
+		{Name: "cameras", Clients: []string{"192.168.8.0/24"}},
+	}
+
+	bl := blocklist.NewMockManager()
+	bl.AddForGroup("kids", "games.example")
+	srv := NewServer(cfg, bl)
+	srv.SetNeighborLookup(func(ip net.IP) (net.HardwareAddr, bool) {
+		if ip.Equal(net.ParseIP("192.168.1.51")) {
+			mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+			return mac, true
+		}
+		return nil, false
+	})
+	if err := srv.configureUpstream(); err != nil {
+		t.Fatalf("configureUpstream: %v", err)
+	}
+
+	groups := map[string]string{
+		"192.168.1.50": "kids",    // Exact IP
+		"192.168.1.51": "kids",    // MAC via the neighbor table
+		"192.168.8.9":  "cameras", // Longest prefix
+		"192.168.2.1":  "iot",
+		"10.0.0.1":     "",
+	}
+	for ip, want := range groups {
+		got := srv.clientGroup(&net.UDPAddr{IP: net.ParseIP(ip), Port: 5000})
+		if got.Name != want {
+			t.Errorf("clientGroup(%s) = %q; want %q", ip, got.Name, want)
+		}
+	}
+
+	query := func(ip string) *dns.Msg {
+		w := &testWriter{remote: &net.UDPAddr{IP: net.ParseIP(ip), Port: 5000}}
+		r := new(dns.Msg)
+		r.SetQuestion("games.example.", dns.TypeA)
+		srv.handleRequest(w, r)
+		return w.msg
+	}
+
+	if m := query("192.168.1.50"); m == nil || m.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected NXDOMAIN (group blocking mode) for the kids' tablet, got %v", m)
+	}
+	if m := query("10.0.0.1"); m == nil || m.Rcode != dns.RcodeSuccess || len(m.Answer) != 1 {
+		t.Errorf("Expected the upstream answer for other clients, got %v", m)
+	}
+
+	// Management
+	if err := srv.AddClientGroup(config.ClientGroup{Name: "bad", Clients: []string{"not-a-client"}}); err == nil {
+		t.Error("Expected invalid client to be rejected")
+	}
+	if err := srv.AddClientGroup(config.ClientGroup{Name: "bad", Clients: []string{"10.0.0.1"}, Sources: []string{"Nope"}}); err == nil {
+		t.Error("Expected unknown source to be rejected")
+	}
+	if err := srv.AddClientGroup(config.ClientGroup{Name: "kids", Clients: []string{"10.0.0.1"}}); err != nil {
+		t.Fatalf("AddClientGroup: %v", err)
+	}
+	if got := srv.clientGroup(&net.UDPAddr{IP: net.ParseIP("10.0.0.1")}); got.Name != "kids" {
+		t.Errorf("Expected replaced group to match its new client, got %q", got.Name)
+	}
+	if got := srv.clientGroup(&net.UDPAddr{IP: net.ParseIP("192.168.1.50")}); got.Name != "iot" {
+		t.Errorf("Expected old client to fall back to the CIDR group, got %q", got.Name)
+	}
+	if err := srv.RemoveClientGroup("kids"); err != nil {
+		t.Fatalf("RemoveClientGroup: %v", err)
+	}
+	if n := len(srv.ListClientGroups()); n != 2 {
+		t.Errorf("Expected 2 groups left, got %d", n)
+	}
+	if err := srv.RemoveClientGroup("kids"); err == nil {
+		t.Error("Expected error removing a missing group")
+	}
+}
@@ -0,0 +1,169 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	dohMediaType = "application/dns-message"
+	// dohPadBlock is the query padding block size recommended by RFC 8467.
+	dohPadBlock = 128
+	// dohMaxResponse bounds how much of a response body we read.
+	dohMaxResponse = 64 * 1024
+)
+
+// dohUpstream forwards queries over DNS-over-HTTPS (RFC 8484).
+// A single http.Client is shared so HTTP/2 connections are reused.
+type dohUpstream struct {
+	url      string
+	endpoint *url.URL // Parsed url, GET queries are added to its query string
+	useGET   bool
+	client   *http.Client
+}
+
+func newDoHUpstream(rawURL string, opts UpstreamOptions) (*dohUpstream, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid DoH url %q", rawURL)
+	}
+
+	var useGET bool
+	switch strings.ToLower(opts.DoHMethod) {
+	case "", "post":
+	case "get":
+		useGET = true
+	default:
+		return nil, fmt.Errorf("invalid DoH method %q (want get or post)", opts.DoHMethod)
+	}
+
+	transport := &http.Transport{
+		DialContext:         bootstrapDialer(opts.BootstrapDNS).DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 5 * time.Second,
+	}
+
+	return &dohUpstream{
+		url:      rawURL,
+		endpoint: parsed,
+		useGET:   useGET,
+		client:   &http.Client{Transport: transport, Timeout: 5 * time.Second},
+	}, nil
+}
+
+func (u *dohUpstream) Exchange(ctx context.Context, r *dns.Msg) (*dns.Msg, error) {
+	// Work on a copy: the ID is zeroed for HTTP cache friendliness and
+	// padding is added, neither of which the client should see.
+	q := r.Copy()
+	q.Id = 0
+	clientEDNS := r.IsEdns0() != nil
+	padQuery(q)
+
+	wire, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	var req *http.Request
+	if u.useGET {
+		target := *u.endpoint
+		params := target.Query()
+		params.Set("dns", base64.RawURLEncoding.EncodeToString(wire))
+		target.RawQuery = params.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, u.url, bytes.NewReader(wire))
+		if err == nil {
+			req.Header.Set("Content-Type", dohMediaType)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", dohMediaType)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh %s: bad status: %d", u.url, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != dohMediaType {
+		return nil, fmt.Errorf("doh %s: unexpected content type %q", u.url, ct)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dohMaxResponse))
+	if err != nil {
+		return nil, err
+	}
+
+	answer := new(dns.Msg)
+	if err := answer.Unpack(body); err != nil {
+		return nil, fmt.Errorf("doh %s: %w", u.url, err)
+	}
+	answer.Id = r.Id
+	if !clientEDNS {
+		// The OPT came with our padding, the client does not speak EDNS
+		stripOPT(answer)
+	}
+	return answer, nil
+}
+
+func (u *dohUpstream) String() string {
+	return u.url
+}
+
+// Close closes the idle HTTP connections.
+func (u *dohUpstream) Close() error {
+	u.client.CloseIdleConnections()
+	return nil
+}
+
+// stripOPT removes the OPT record of m.
+func stripOPT(m *dns.Msg) {
+	extra := m.Extra[:0]
+	for _, rr := range m.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			extra = append(extra, rr)
+		}
+	}
+	m.Extra = extra
+}
+
+// padQuery adds an EDNS(0) padding option (RFC 7830) so the packed query
+// length is a multiple of dohPadBlock.
+func padQuery(m *dns.Msg) {
+	opt := m.IsEdns0()
+	if opt == nil {
+		m.SetEdns0(dns.DefaultMsgSize, false)
+		opt = m.IsEdns0()
+	}
+
+	// Drop any padding the client already sent, we recompute it.
+	options := opt.Option[:0]
+	for _, o := range opt.Option {
+		if o.Option() != dns.EDNS0PADDING {
+			options = append(options, o)
+		}
+	}
+	opt.Option = options
+
+	// The option itself costs 4 bytes (code + length).
+	size := m.Len() + 4
+	padding := (dohPadBlock - size%dohPadBlock) % dohPadBlock
+	opt.Option = append(opt.Option, &dns.EDNS0_PADDING{Padding: make([]byte, padding)})
+}
@@ -0,0 +1,135 @@
+package dns
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// newDoHStandIn runs a local HTTP/2 DoH server answering every A query with 192.0.2.53.
+func newDoHStandIn(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			http.Error(w, "http/2 required", http.StatusHTTPVersionNotSupported)
+			return
+		}
+
+		var wire []byte
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+			wire, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		case http.MethodPost:
+			if r.Header.Get("Content-Type") != dohMediaType {
+				http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+				return
+			}
+			wire, err = io.ReadAll(r.Body)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		q := new(dns.Msg)
+		if err := q.Unpack(wire); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if q.Len()%dohPadBlock != 0 {
+			http.Error(w, "query not padded", http.StatusBadRequest)
+			return
+		}
+
+		m := new(dns.Msg)
+		m.SetReply(q)
+		if opt := q.IsEdns0(); opt != nil {
+			m.SetEdns0(opt.UDPSize(), false)
+		}
+		rr, _ := dns.NewRR(q.Question[0].Name + " 60 IN A 192.0.2.53")
+		m.Answer = append(m.Answer, rr)
+		out, _ := m.Pack()
+
+		w.Header().Set("Content-Type", dohMediaType)
+		w.Write(out)
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestDoHUpstream_Exchange(t *testing.T) {
+	ts := newDoHStandIn(t)
+
+	for _, method := range []string{"post", "get"} {
+		// GET must add its parameter to an existing query string
+		up, err := NewUpstream(ts.URL+"/dns-query?profile=home", UpstreamOptions{DoHMethod: method})
+		if err != nil {
+			t.Fatalf("NewUpstream(%s) failed: %v", method, err)
+		}
+		doh := up.(*dohUpstream)
+		doh.client = ts.Client() // Trust the test certificate
+
+		q := new(dns.Msg)
+		q.SetQuestion("doh.example.", dns.TypeA)
+		resp, err := doh.Exchange(context.Background(), q)
+		if err != nil {
+			t.Fatalf("%s exchange failed: %v", method, err)
+		}
+		if resp.Id != q.Id {
+			t.Errorf("%s: expected ID %d restored, got %d", method, q.Id, resp.Id)
+		}
+		if len(resp.Answer) != 1 {
+			t.Fatalf("%s: expected 1 answer, got %d", method, len(resp.Answer))
+		}
+		if a := resp.Answer[0].(*dns.A); a.A.String() != "192.0.2.53" {
+			t.Errorf("%s: unexpected answer %v", method, a.A)
+		}
+		if q.IsEdns0() != nil {
+			t.Errorf("%s: client query must not be modified", method)
+		}
+		if resp.IsEdns0() != nil {
+			t.Errorf("%s: a client without EDNS must not get an OPT record back", method)
+		}
+
+		// A client speaking EDNS keeps the OPT of the answer
+		q.SetEdns0(1232, false)
+		if resp, err = doh.Exchange(context.Background(), q); err != nil || resp.IsEdns0() == nil {
+			t.Errorf("%s: expected the OPT record kept for an EDNS client, err %v", method, err)
+		}
+	}
+}
+
+func TestNewUpstream_Specs(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{"1.1.1.1", "1.1.1.1:53", false},
+		{"9.9.9.9:5353", "9.9.9.9:5353", false},
+		{"2606:4700:4700::1111", "[2606:4700:4700::1111]:53", false},
+		{"https://dns.example/dns-query", "https://dns.example/dns-query", false},
+		{"ftp://nope", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		up, err := NewUpstream(tt.spec, UpstreamOptions{})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewUpstream(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if err == nil && up.String() != tt.want {
+			t.Errorf("NewUpstream(%q) = %q; want %q", tt.spec, up.String(), tt.want)
+		}
+	}
+}
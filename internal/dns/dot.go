@@ -0,0 +1,254 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// dotIdleTimeout closes a DoT connection that has had no queries in flight for this long.
+	dotIdleTimeout = 30 * time.Second
+	// dotWriteTimeout bounds writing a single query to the connection.
+	dotWriteTimeout = 2 * time.Second
+)
+
+var errDoTClosed = errors.New("dot connection closed")
+
+// dotUpstream forwards queries over DNS-over-TLS (RFC 7858).
+// Queries are pipelined over one persistent connection which is
+// re-dialed on demand after an error, an idle timeout or a query that
+// timed out without the server answering anything in the meantime.
+type dotUpstream struct {
+	addr      string
+	tlsConfig *tls.Config
+	dialer    *net.Dialer
+	log       func(string)
+
+	mu   sync.Mutex
+	conn *dotConn
+}
+
+func newDoTUpstream(addr string, opts UpstreamOptions) (*dotUpstream, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DoT upstream %q: %w", addr, err)
+	}
+
+	serverName := opts.TLSServerName
+	if serverName == "" {
+		// An IP literal is verified against the certificate's IP SANs
+		serverName = host
+	}
+
+	return &dotUpstream{
+		addr: addr,
+		tlsConfig: &tls.Config{
+			ServerName: serverName,
+			MinVersion: tls.VersionTLS12,
+		},
+		dialer: bootstrapDialer(opts.BootstrapDNS),
+		log:    opts.Log,
+	}, nil
+}
+
+func (u *dotUpstream) Exchange(ctx context.Context, r *dns.Msg) (*dns.Msg, error) {
+	c, reused, err := u.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.exchange(ctx, r)
+	if err != nil && reused && ctx.Err() == nil {
+		// The server may have closed a reused connection; retry once on a fresh one
+		u.drop(c)
+		if c, _, err = u.getConn(ctx); err != nil {
+			return nil, err
+		}
+		resp, err = c.exchange(ctx, r)
+	}
+	if err != nil && ctx.Err() == nil {
+		u.drop(c)
+	}
+	return resp, err
+}
+
+func (u *dotUpstream) String() string {
+	return "tls://" + u.addr
+}
+
+// Close closes the current connection; a later query dials a new one.
+func (u *dotUpstream) Close() error {
+	u.mu.Lock()
+	c := u.conn
+	u.conn = nil
+	u.mu.Unlock()
+	if c != nil {
+		c.close()
+	}
+	return nil
+}
+
+// getConn returns the current connection, dialing a new one if needed.
+func (u *dotUpstream) getConn(ctx context.Context) (*dotConn, bool, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.conn != nil && !u.conn.isClosed() {
+		return u.conn, true, nil
+	}
+
+	td := &tls.Dialer{NetDialer: u.dialer, Config: u.tlsConfig}
+	raw, err := td.DialContext(ctx, "tcp", u.addr)
+	if err != nil {
+		if u.log != nil {
+			u.log(fmt.Sprintf("DoT handshake with %s (%s) failed: %v", u.addr, u.tlsConfig.ServerName, err))
+		}
+		return nil, false, err
+	}
+
+	u.conn = newDoTConn(raw)
+	return u.conn, false, nil
+}
+
+// drop closes c and forgets it if it is still the current connection.
+func (u *dotUpstream) drop(c *dotConn) {
+	c.close()
+	u.mu.Lock()
+	if u.conn == c {
+		u.conn = nil
+	}
+	u.mu.Unlock()
+}
+
+// dotConn multiplexes concurrent queries over one TLS connection,
+// matching answers to queries by message ID.
+type dotConn struct {
+	conn    *dns.Conn
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	pending  map[uint16]chan *dns.Msg
+	nextID   uint16
+	idle     *time.Timer
+	lastRead time.Time // When the last message arrived
+	closed   bool
+	done     chan struct{}
+}
+
+func newDoTConn(raw net.Conn) *dotConn {
+	c := &dotConn{
+		conn:    &dns.Conn{Conn: raw},
+		pending: make(map[uint16]chan *dns.Msg),
+		nextID:  dns.Id(),
+		done:    make(chan struct{}),
+	}
+	c.idle = time.AfterFunc(dotIdleTimeout, func() { c.close() })
+	go c.readLoop()
+	return c
+}
+
+func (c *dotConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func (c *dotConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.idle.Stop()
+	close(c.done)
+	c.conn.Close()
+}
+
+func (c *dotConn) readLoop() {
+	for {
+		msg, err := c.conn.ReadMsg()
+		if err != nil {
+			c.close()
+			return
+		}
+		c.mu.Lock()
+		c.lastRead = time.Now()
+		ch, ok := c.pending[msg.Id]
+		delete(c.pending, msg.Id)
+		c.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+}
+
+func (c *dotConn) exchange(ctx context.Context, r *dns.Msg) (*dns.Msg, error) {
+	ch := make(chan *dns.Msg, 1)
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, errDoTClosed
+	}
+	// Rewrite the ID so concurrent clients using the same ID do not collide
+	id := c.nextID
+	for _, used := c.pending[id]; used; _, used = c.pending[id] {
+		id++
+	}
+	c.nextID = id + 1
+	c.pending[id] = ch
+	c.idle.Stop()
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		if len(c.pending) == 0 && !c.closed {
+			c.idle.Reset(dotIdleTimeout)
+		}
+		c.mu.Unlock()
+	}()
+
+	q := r.Copy()
+	q.Id = id
+
+	c.writeMu.Lock()
+	sent := time.Now()
+	c.conn.SetWriteDeadline(sent.Add(dotWriteTimeout))
+	err := c.conn.WriteMsg(q)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		resp.Id = r.Id
+		return resp, nil
+	case <-c.done:
+		return nil, errDoTClosed
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && c.silentSince(sent) {
+			// Nothing came back while the query was pending: the session
+			// is likely black-holed, do not keep reusing it
+			c.close()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// silentSince reports whether no message has arrived since t.
+func (c *dotConn) silentSince(t time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastRead.Before(t)
+}
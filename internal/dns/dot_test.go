@@ -0,0 +1,200 @@
+package dns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// selfSignedCert returns a certificate valid for "dot.test" and 127.0.0.1.
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dot.test"},
+		DNSNames:     []string{"dot.test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+// startDoTServer runs a local DoT resolver and counts accepted connections.
+func startDoTServer(t *testing.T) (string, *x509.CertPool, *int32) {
+	t.Helper()
+
+	cert, pool := selfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	var conns int32
+	var seen sync.Map
+	srv := &dns.Server{
+		Listener: ln,
+		Net:      "tcp-tls",
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			if _, loaded := seen.LoadOrStore(w.RemoteAddr().String(), true); !loaded {
+				atomic.AddInt32(&conns, 1)
+			}
+			m := new(dns.Msg)
+			m.SetReply(r)
+			rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A 192.0.2.85")
+			m.Answer = append(m.Answer, rr)
+			w.WriteMsg(m)
+		}),
+	}
+	go srv.ActivateAndServe()
+	t.Cleanup(func() { srv.Shutdown() })
+
+	return ln.Addr().String(), pool, &conns
+}
+
+func TestDoTUpstream_Pipelining(t *testing.T) {
+	addr, pool, conns := startDoTServer(t)
+
+	up, err := NewUpstream("tls://"+addr, UpstreamOptions{TLSServerName: "dot.test"})
+	if err != nil {
+		t.Fatalf("NewUpstream failed: %v", err)
+	}
+	dot := up.(*dotUpstream)
+	dot.tlsConfig.RootCAs = pool
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q := new(dns.Msg)
+			q.SetQuestion("pipe.example.", dns.TypeA)
+			q.Id = 42 // Same client ID on purpose, the upstream must remap it
+			resp, err := dot.Exchange(context.Background(), q)
+			if err == nil && (resp.Id != 42 || len(resp.Answer) != 1) {
+				err = errUnexpected
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Exchange failed: %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(conns); n != 1 {
+		t.Errorf("Expected queries pipelined over 1 connection, got %d", n)
+	}
+}
+
+func TestDoTUpstream_HandshakeFailureIsLogged(t *testing.T) {
+	addr, pool, _ := startDoTServer(t)
+
+	var logged []string
+	up, _ := NewUpstream("tls://"+addr, UpstreamOptions{
+		TLSServerName: "wrong.name",
+		Log:           func(msg string) { logged = append(logged, msg) },
+	})
+	dot := up.(*dotUpstream)
+	dot.tlsConfig.RootCAs = pool
+
+	q := new(dns.Msg)
+	q.SetQuestion("fail.example.", dns.TypeA)
+	if _, err := dot.Exchange(context.Background(), q); err == nil {
+		t.Fatal("Expected certificate verification to fail")
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "handshake") {
+		t.Errorf("Expected handshake failure in log, got %v", logged)
+	}
+}
+
+func TestDoTUpstream_DropsSilentConnection(t *testing.T) {
+	cert, pool := selfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+
+	// The first connection swallows queries, later ones answer them
+	var accepted int32
+	go func() {
+		for {
+			raw, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn *dns.Conn, silent bool) {
+				defer conn.Close()
+				for {
+					r, err := conn.ReadMsg()
+					if err != nil {
+						return
+					}
+					if silent {
+						continue
+					}
+					m := new(dns.Msg)
+					m.SetReply(r)
+					conn.WriteMsg(m)
+				}
+			}(&dns.Conn{Conn: raw}, atomic.AddInt32(&accepted, 1) == 1)
+		}
+	}()
+
+	up, _ := NewUpstream("tls://"+ln.Addr().String(), UpstreamOptions{TLSServerName: "dot.test"})
+	dot := up.(*dotUpstream)
+	dot.tlsConfig.RootCAs = pool
+
+	q := new(dns.Msg)
+	q.SetQuestion("silent.example.", dns.TypeA)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := dot.Exchange(ctx, q); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected a timeout, got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := dot.Exchange(ctx, q); err != nil {
+		t.Fatalf("Expected the query to go over a new connection, got %v", err)
+	}
+	if n := atomic.LoadInt32(&accepted); n != 2 {
+		t.Errorf("Expected the silent connection to be replaced, got %d connections", n)
+	}
+}
+
+var errUnexpected = errors.New("unexpected response")
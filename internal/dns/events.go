@@ -0,0 +1,59 @@
+package dns
+
+import (
+	"time"
+
+	"0x53/internal/core"
+
+	"github.com/miekg/dns"
+)
+
+// AddQuerySink registers a sink receiving an event for every query.
+func (s *Server) AddQuerySink(sink core.QuerySink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sinks = append(s.sinks, sink)
+}
+
+// eventWriter records the response code of the answer sent for ev.
+type eventWriter struct {
+	dns.ResponseWriter
+	ev *core.QueryEvent
+}
+
+func (w *eventWriter) WriteMsg(m *dns.Msg) error {
+	w.ev.Rcode = dns.RcodeToString[m.Rcode]
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// newEvent starts the event of query r from the client at w.
+func newEvent(w dns.ResponseWriter, r *dns.Msg) *core.QueryEvent {
+	ev := &core.QueryEvent{Time: time.Now(), Status: core.StatusAllowed}
+	if ip := clientIP(w.RemoteAddr()); ip != nil {
+		ev.Client = ip.String()
+	}
+	if len(r.Question) > 0 {
+		ev.Domain = normalizeDomain(r.Question[0].Name)
+		ev.Type = dns.TypeToString[r.Question[0].Qtype]
+	}
+	return ev
+}
+
+// emit completes ev, records its latency and top counters and hands it to
+// the sinks.
+func (s *Server) emit(ev *core.QueryEvent) {
+	now := time.Now()
+	ev.Latency = now.Sub(ev.Time)
+	// Rejected clients are answered instantly, they would hide slowdowns
+	if ev.Status != core.StatusRefused && ev.Status != core.StatusThrottled {
+		s.queryLatency.observe(ev.Latency, now)
+		s.top.record(ev)
+	}
+
+	s.mu.RLock()
+	sinks := s.sinks
+	s.mu.RUnlock()
+	for _, sink := range sinks {
+		sink.Record(*ev)
+	}
+}
@@ -0,0 +1,73 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"0x53/internal/blocklist"
+	"0x53/internal/config"
+	"0x53/internal/core"
+	"0x53/internal/querylog"
+
+	"github.com/miekg/dns"
+)
+
+func TestServer_QueryEvents(t *testing.T) {
+	upstream := startUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A 203.0.113.7")
+		m.Answer = append(m.Answer, rr)
+		w.WriteMsg(m)
+	})
+
+	cfg := config.Default()
+	cfg.ConfigDir = t.TempDir()
+	cfg.Upstream = config.UpstreamCustom
+	cfg.CustomUpstream = upstream
+	cfg.BlockingMode = config.BlockNXDomain
+
+	bl := blocklist.NewMockManager()
+	bl.Add("ads.example")
+	srv := NewServer(cfg, bl)
+	if err := srv.configureUpstream(); err != nil {
+		t.Fatalf("configureUpstream: %v", err)
+	}
+	ring := querylog.NewRing(10)
+	srv.AddQuerySink(ring)
+
+	query := func(name string) {
+		w := &testWriter{remote: &net.UDPAddr{IP: net.ParseIP("10.0.0.5"), Port: 5000}}
+		r := new(dns.Msg)
+		r.SetQuestion(name, dns.TypeA)
+		srv.handleRequest(w, r)
+	}
+	query("ads.example.")
+	query("www.example.")
+	query("www.example.")
+
+	events := ring.Query(core.QueryFilter{})
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+
+	blocked := events[2]
+	if blocked.Status != core.StatusBlocked || blocked.Rule != "mock" || blocked.Rcode != "NXDOMAIN" {
+		t.Errorf("Unexpected blocked event: %+v", blocked)
+	}
+	if blocked.Client != "10.0.0.5" || blocked.Domain != "ads.example" || blocked.Type != "A" {
+		t.Errorf("Expected client, domain and type to be recorded, got %+v", blocked)
+	}
+
+	forwarded := events[1]
+	if forwarded.Status != core.StatusAllowed || forwarded.Cached || forwarded.Upstream == "" || forwarded.Rcode != "NOERROR" {
+		t.Errorf("Unexpected forwarded event: %+v", forwarded)
+	}
+	if cached := events[0]; !cached.Cached {
+		t.Errorf("Expected the repeated query to be answered from cache: %+v", cached)
+	}
+
+	if got := ring.Query(core.QueryFilter{Status: core.StatusBlocked}); len(got) != 1 {
+		t.Errorf("Expected 1 blocked event, got %d", len(got))
+	}
+}
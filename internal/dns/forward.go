@@ -0,0 +1,202 @@
+package dns
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"0x53/internal/config"
+	"0x53/internal/core"
+)
+
+// normalizeSuffix turns "*.Corp.Internal." into "corp.internal".
+func normalizeSuffix(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimPrefix(domain, "*.")
+	return strings.Trim(domain, ".")
+}
+
+// forwardOptions returns the upstream options forwarders are built with
+// under cfg. Callers hold s.mu when cfg is the server's.
+func (s *Server) forwardOptions(cfg *config.Config) UpstreamOptions {
+	return UpstreamOptions{
+		DoHMethod:     cfg.DoHMethod,
+		BootstrapDNS:  cfg.BootstrapDNS,
+		TLSServerName: cfg.TLSServerName,
+		Log:           s.log,
+	}
+}
+
+// buildForwarders compiles forwarding rules into one upstream pool per
+// suffix.
+func (s *Server) buildForwarders(opts UpstreamOptions, rules []config.ForwardRule) (map[string]*upstreamPool, error) {
+	forwarders := make(map[string]*upstreamPool, len(rules))
+	for _, rule := range rules {
+		domain := normalizeSuffix(rule.Domain)
+		if domain == "" {
+			return nil, fmt.Errorf("forward rule with empty domain")
+		}
+		if len(rule.Upstreams) == 0 {
+			return nil, fmt.Errorf("forward rule %s has no upstreams", domain)
+		}
+
+		ups := make([]Upstream, 0, len(rule.Upstreams))
+		for _, spec := range rule.Upstreams {
+			up, err := NewUpstream(spec, opts)
+			if err != nil {
+				return nil, fmt.Errorf("forward rule %s: %w", domain, err)
+			}
+			ups = append(ups, up)
+		}
+
+		pool := newUpstreamPool(config.PolicyFailover, ups, s.log)
+		pool.source = "forward: " + domain
+		pool.observe = s.observeExchange
+		forwarders[domain] = pool
+	}
+	return forwarders, nil
+}
+
+// configureForwarders (re)builds the conditional forwarding table from config.
+func (s *Server) configureForwarders() error {
+	s.mu.RLock()
+	rules := append([]config.ForwardRule(nil), s.cfg.ForwardRules...)
+	opts := s.forwardOptions(s.cfg)
+	s.mu.RUnlock()
+
+	forwarders, err := s.buildForwarders(opts, rules)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	old := s.forwarders
+	s.forwarders = forwarders
+	s.mu.Unlock()
+	retire(slices.Collect(maps.Values(old))...)
+	return nil
+}
+
+// poolFor returns the pool that should answer name: the forwarder of the
+// longest matching suffix, or the default upstreams.
+func (s *Server) poolFor(name string) *upstreamPool {
+	if pool := s.forwarderFor(name); pool != nil {
+		return pool
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.upstreams
+}
+
+// forwarderFor returns the forwarder of the longest suffix matching name, or nil.
+func (s *Server) forwarderFor(name string) *upstreamPool {
+	name = normalizeSuffix(name)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for len(s.forwarders) > 0 {
+		if pool, ok := s.forwarders[name]; ok {
+			return pool
+		}
+		idx := strings.IndexByte(name, '.')
+		if idx == -1 {
+			break
+		}
+		name = name[idx+1:]
+	}
+	return nil
+}
+
+// forwarderStats returns stats of the conditional forwarders, sorted by domain.
+func (s *Server) forwarderStats() []core.UpstreamStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	domains := make([]string, 0, len(s.forwarders))
+	for d := range s.forwarders {
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+
+	var stats []core.UpstreamStats
+	for _, d := range domains {
+		stats = append(stats, s.forwarders[d].Stats()...)
+	}
+	return stats
+}
+
+// --- Forward Rules Management ---
+
+// AddForwardRule adds or replaces the rule for rule.Domain. Rule changes
+// are serialized with reloads, so the rules read here are still current
+// once the new forwarders are built.
+func (s *Server) AddForwardRule(rule config.ForwardRule) error {
+	rule.Domain = normalizeSuffix(rule.Domain)
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	s.mu.RLock()
+	rules := make([]config.ForwardRule, 0, len(s.cfg.ForwardRules)+1)
+	for _, r := range s.cfg.ForwardRules {
+		if normalizeSuffix(r.Domain) != rule.Domain {
+			rules = append(rules, r)
+		}
+	}
+	opts := s.forwardOptions(s.cfg)
+	s.mu.RUnlock()
+	rules = append(rules, rule)
+
+	// Validate before touching the config
+	forwarders, err := s.buildForwarders(opts, rules)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg.ForwardRules = rules
+	retire(slices.Collect(maps.Values(s.forwarders))...)
+	s.forwarders = forwarders
+	return config.SaveCurrent(s.cfg)
+}
+
+// RemoveForwardRule deletes the rule for domain.
+func (s *Server) RemoveForwardRule(domain string) error {
+	domain = normalizeSuffix(domain)
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules := make([]config.ForwardRule, 0, len(s.cfg.ForwardRules))
+	for _, r := range s.cfg.ForwardRules {
+		if normalizeSuffix(r.Domain) != domain {
+			rules = append(rules, r)
+		}
+	}
+	if len(rules) == len(s.cfg.ForwardRules) {
+		return fmt.Errorf("forward rule not found: %s", domain)
+	}
+
+	s.cfg.ForwardRules = rules
+	retire(s.forwarders[domain])
+	delete(s.forwarders, domain)
+	return config.SaveCurrent(s.cfg)
+}
+
+// ListForwardRules returns a copy of the configured rules.
+func (s *Server) ListForwardRules() []config.ForwardRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dst := make([]config.ForwardRule, len(s.cfg.ForwardRules))
+	for i, r := range s.cfg.ForwardRules {
+		dst[i] = config.ForwardRule{Domain: r.Domain, Upstreams: append([]string(nil), r.Upstreams...)}
+	}
+	return dst
+}
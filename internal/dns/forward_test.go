@@ -0,0 +1,84 @@
+package dns
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"0x53/internal/blocklist"
+	"0x53/internal/config"
+)
+
+func TestServer_ForwardRules(t *testing.T) {
+	cfg := config.Default()
+	cfg.ConfigDir = t.TempDir()
+	cfg.Upstream = config.UpstreamCustom
+	cfg.CustomUpstream = "192.0.2.1"
+	cfg.ForwardRules = []config.ForwardRule{
+		{Domain: "corp.internal", Upstreams: []string{"10.0.0.1"}},
+		{Domain: "*.lan.", Upstreams: []string{"192.168.1.1", "192.168.1.2"}},
+		{Domain: "168.192.in-addr.arpa", Upstreams: []string{"192.168.1.1"}},
+	}
+
+	srv := NewServer(cfg, blocklist.NewMockManager())
+	if err := srv.configureUpstream(); err != nil {
+		t.Fatalf("configureUpstream: %v", err)
+	}
+	if err := srv.configureForwarders(); err != nil {
+		t.Fatalf("configureForwarders: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"git.corp.internal.", "10.0.0.1:53"},
+		{"CORP.INTERNAL.", "10.0.0.1:53"},
+		{"nas.lan.", "192.168.1.1:53, 192.168.1.2:53"},
+		{"10.1.168.192.in-addr.arpa.", "192.168.1.1:53"},
+		{"notcorp.internal.", "192.0.2.1:53"},
+		{"example.com.", "192.0.2.1:53"},
+	}
+	for _, tt := range tests {
+		if got := srv.poolFor(tt.name).String(); got != tt.want {
+			t.Errorf("poolFor(%q) = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Management API
+	if err := srv.AddForwardRule(config.ForwardRule{Domain: "lab.test", Upstreams: []string{"ftp://bad"}}); err == nil {
+		t.Error("Expected invalid upstream to be rejected")
+	}
+	if err := srv.AddForwardRule(config.ForwardRule{Domain: "corp.internal", Upstreams: []string{"10.0.0.9"}}); err != nil {
+		t.Fatalf("AddForwardRule: %v", err)
+	}
+	if got := srv.poolFor("a.corp.internal.").String(); got != "10.0.0.9:53" {
+		t.Errorf("Expected replaced rule, got %q", got)
+	}
+	if err := srv.RemoveForwardRule("lan"); err != nil {
+		t.Fatalf("RemoveForwardRule: %v", err)
+	}
+	if got := len(srv.ListForwardRules()); got != 2 {
+		t.Errorf("Expected 2 rules left, got %d", got)
+	}
+	if got := srv.poolFor("nas.lan.").String(); got != "192.0.2.1:53" {
+		t.Errorf("Removed rule still routes: %q", got)
+	}
+
+	// Concurrent adds must all survive
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rule := config.ForwardRule{Domain: fmt.Sprintf("site%d.test", i), Upstreams: []string{"10.0.1.1"}}
+			if err := srv.AddForwardRule(rule); err != nil {
+				t.Errorf("AddForwardRule: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := len(srv.ListForwardRules()); got != 10 {
+		t.Errorf("Expected 10 rules after concurrent adds, got %d", got)
+	}
+}
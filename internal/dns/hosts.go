@@ -0,0 +1,274 @@
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"0x53/internal/config"
+	"0x53/internal/core"
+)
+
+// defaultHostsPath is the system hosts file, imported when no path is given.
+func defaultHostsPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("SystemRoot"), "System32", "drivers", "etc", "hosts")
+	}
+	return "/etc/hosts"
+}
+
+const (
+	// maxHostsFileSize bounds the files read as hosts files.
+	maxHostsFileSize = 64 << 20
+	// hostsSniffSize is how much of a file is checked for hosts content
+	// before it is parsed.
+	hostsSniffSize = 4096
+)
+
+// readHostsFile parses path, tagging every record with it as Source.
+// Names listed twice with the same address are only returned once.
+//
+// Paths come from the control socket and the daemon usually runs as root,
+// so only regular files that look like hosts files are read, and errors
+// never quote their content.
+func readHostsFile(path string) ([]config.LocalRecord, int, error) {
+	// Stat first: opening a FIFO or a device could block or never end
+	if info, err := os.Stat(path); err != nil {
+		return nil, 0, err
+	} else if !info.Mode().IsRegular() {
+		return nil, 0, fmt.Errorf("not a regular file: %s", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, 0, fmt.Errorf("not a regular file: %s", path)
+	}
+	if info.Size() > maxHostsFileSize {
+		return nil, 0, fmt.Errorf("hosts file too large: %s", path)
+	}
+
+	r := bufio.NewReaderSize(f, hostsSniffSize)
+	head, _ := r.Peek(hostsSniffSize)
+	if !looksLikeHosts(head) {
+		return nil, 0, fmt.Errorf("not a hosts file: %s", path)
+	}
+	parsed, invalid, err := config.ParseHosts(r)
+	if err != nil {
+		return nil, invalid, fmt.Errorf("cannot parse hosts file %s", path)
+	}
+
+	seen := make(map[config.LocalRecord]bool, len(parsed))
+	recs := parsed[:0]
+	for _, rec := range parsed {
+		rec.Source = path
+		if !seen[rec] {
+			seen[rec] = true
+			recs = append(recs, rec)
+		}
+	}
+	return recs, invalid, nil
+}
+
+// looksLikeHosts reports whether head, the start of a file, is text whose
+// first entry is "IP name".
+func looksLikeHosts(head []byte) bool {
+	if bytes.IndexByte(head, 0) >= 0 {
+		return false // Binary
+	}
+	for _, line := range strings.Split(string(head), "\n") {
+		if idx := strings.IndexByte(line, '#'); idx != -1 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		return len(fields) >= 2 && net.ParseIP(fields[0]) != nil
+	}
+	return true // Only comments, or empty
+}
+
+// overlaps reports whether a and b compete for the same answers: the same
+// name and type, or the same name where either is a CNAME.
+func overlaps(a, b config.LocalRecord) bool {
+	return a.Domain == b.Domain &&
+		(a.Type == b.Type || a.Type == config.RecordCNAME || b.Type == config.RecordCNAME)
+}
+
+// ImportHosts imports a hosts-format file into the local records, see
+// core.HostsImportOptions. Records that overlap an existing local record with
+// a different value are reported as conflicts and skipped, unless Overwrite
+// is set. Linked files are not copied into the config: their records are
+// served alongside it, config records taking precedence on overlaps.
+func (s *Server) ImportHosts(opts core.HostsImportOptions) (core.HostsImportResult, error) {
+	if opts.Path == "" {
+		opts.Path = defaultHostsPath()
+	}
+	path, err := filepath.Abs(opts.Path)
+	if err != nil {
+		return core.HostsImportResult{}, err
+	}
+	res := core.HostsImportResult{Path: path}
+
+	if opts.Unlink {
+		return res, s.unlinkHosts(path, opts.DryRun)
+	}
+
+	imported, invalid, err := readHostsFile(path)
+	if err != nil {
+		return res, err
+	}
+	res.Invalid = invalid
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := s.cfg.LocalRecords
+	replaced := make(map[int]bool)
+	for _, rec := range imported {
+		present, conflicted := false, false
+		for i, ex := range existing {
+			if !overlaps(ex, rec) {
+				continue
+			}
+			if ex.Type == rec.Type && ex.Value == rec.Value {
+				present = true
+				continue
+			}
+			res.Conflicts = append(res.Conflicts, core.HostsConflict{Imported: rec, Existing: ex, Replaced: opts.Overwrite})
+			if opts.Overwrite {
+				replaced[i] = true
+			} else {
+				conflicted = true
+			}
+		}
+		switch {
+		case present:
+			res.Unchanged++
+		case !conflicted:
+			if !opts.Link {
+				rec.Source = ""
+			}
+			res.Added = append(res.Added, rec)
+		}
+	}
+
+	if opts.DryRun {
+		return res, nil
+	}
+
+	recs := make(config.LocalRecords, 0, len(existing)+len(res.Added))
+	for i, ex := range existing {
+		if !replaced[i] {
+			recs = append(recs, ex)
+		}
+	}
+	if opts.Link {
+		if s.hosts == nil {
+			s.hosts = make(map[string][]config.LocalRecord)
+		}
+		s.hosts[path] = imported
+		if !slices.Contains(s.cfg.LinkedHostsFiles, path) {
+			s.cfg.LinkedHostsFiles = append(s.cfg.LinkedHostsFiles, path)
+		}
+	} else {
+		recs = append(recs, res.Added...)
+	}
+
+	s.cfg.LocalRecords = recs
+	s.rebuildLocal()
+	return res, config.SaveCurrent(s.cfg)
+}
+
+// unlinkHosts stops serving the records of a linked hosts file. A dry run
+// only checks that the file is linked.
+func (s *Server) unlinkHosts(path string, dryRun bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := make([]string, 0, len(s.cfg.LinkedHostsFiles))
+	for _, f := range s.cfg.LinkedHostsFiles {
+		if f != path {
+			files = append(files, f)
+		}
+	}
+	if len(files) == len(s.cfg.LinkedHostsFiles) {
+		return fmt.Errorf("hosts file not linked: %s", path)
+	}
+	if dryRun {
+		return nil
+	}
+
+	s.cfg.LinkedHostsFiles = files
+	delete(s.hosts, path)
+	s.rebuildLocal()
+	return config.SaveCurrent(s.cfg)
+}
+
+// loadLinkedHosts re-reads every linked hosts file. A file that cannot be
+// read keeps the records of its last successful read.
+func (s *Server) loadLinkedHosts() {
+	s.mu.RLock()
+	files := append([]string(nil), s.cfg.LinkedHostsFiles...)
+	s.mu.RUnlock()
+
+	loaded := s.readLinkedHosts(files)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hosts = loaded
+	s.rebuildLocal()
+}
+
+// readLinkedHosts reads the records of files, by path, falling back to the
+// last successful read of a file that cannot be read.
+func (s *Server) readLinkedHosts(files []string) map[string][]config.LocalRecord {
+	loaded := make(map[string][]config.LocalRecord, len(files))
+	for _, path := range files {
+		recs, _, err := readHostsFile(path)
+		if err != nil {
+			s.log(fmt.Sprintf("Failed to read linked hosts file: %v", err))
+			s.mu.RLock()
+			recs = s.hosts[path]
+			s.mu.RUnlock()
+		}
+		loaded[path] = recs
+	}
+	return loaded
+}
+
+// servedRecords returns the config records followed by the linked ones they
+// do not overlap, in linking order. Callers must hold s.mu.
+func (s *Server) servedRecords() []config.LocalRecord {
+	recs := append([]config.LocalRecord(nil), s.cfg.LocalRecords...)
+	own := len(recs)
+	for _, path := range s.cfg.LinkedHostsFiles {
+	next:
+		for _, rec := range s.hosts[path] {
+			for _, ex := range recs[:own] {
+				if overlaps(ex, rec) {
+					continue next
+				}
+			}
+			recs = append(recs, rec)
+		}
+	}
+	return recs
+}
+
+// rebuildLocal refreshes the zone after a change. Callers must hold s.mu.
+func (s *Server) rebuildLocal() {
+	s.local = newLocalZone(s.servedRecords())
+}
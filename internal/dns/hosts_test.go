@@ -0,0 +1,139 @@
+package dns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"0x53/internal/blocklist"
+	"0x53/internal/config"
+	"0x53/internal/core"
+)
+
+func writeHosts(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestReadHostsFile_Rejects(t *testing.T) {
+	dir := t.TempDir()
+	for name, path := range map[string]string{
+		"directory": dir,
+		"device":    os.DevNull,
+		"passwd":    writeHosts(t, "root:x:0:0:root:/root:/bin/bash\n127.0.0.1 leaked.example\n"),
+		"binary":    writeHosts(t, "127.0.0.1 a.example\x00\x01\n"),
+	} {
+		recs, _, err := readHostsFile(path)
+		if err == nil || len(recs) != 0 {
+			t.Errorf("%s: expected a rejection, got %v records and %v", name, recs, err)
+		}
+	}
+
+	recs, _, err := readHostsFile(writeHosts(t, "# comment\n\n192.168.1.2 nas.lan\n"))
+	if err != nil || len(recs) != 1 {
+		t.Errorf("Expected a hosts file read, got %v, %v", recs, err)
+	}
+}
+
+func TestServer_ImportHosts(t *testing.T) {
+	cfg := config.Default()
+	cfg.ConfigDir = t.TempDir()
+	cfg.LocalRecords = config.LocalRecords{
+		{Domain: "nas.lan", Type: config.RecordA, Value: "192.168.1.10"},
+		{Domain: "printer.lan", Type: config.RecordA, Value: "192.168.1.20"},
+	}
+	srv := NewServer(cfg, blocklist.NewMockManager())
+
+	path := writeHosts(t, "192.168.1.10 nas.lan\n192.168.1.99 printer.lan\n192.168.1.30 pi.lan\n")
+
+	// Dry run reports without changing anything
+	res, err := srv.ImportHosts(core.HostsImportOptions{Path: path, DryRun: true})
+	if err != nil {
+		t.Fatalf("ImportHosts dry run: %v", err)
+	}
+	if len(res.Added) != 1 || res.Unchanged != 1 || len(res.Conflicts) != 1 {
+		t.Fatalf("Unexpected dry run result: %+v", res)
+	}
+	if got := len(srv.ListLocalRecords()); got != 2 {
+		t.Fatalf("Dry run changed the records: %d", got)
+	}
+
+	// Conflicts are kept by default
+	if _, err := srv.ImportHosts(core.HostsImportOptions{Path: path}); err != nil {
+		t.Fatalf("ImportHosts: %v", err)
+	}
+	if recs := srv.local.lookup("printer.lan"); len(recs) != 1 || recs[0].Value != "192.168.1.20" {
+		t.Errorf("Conflicting record should be kept, got %+v", recs)
+	}
+	if recs := srv.local.lookup("pi.lan"); len(recs) != 1 {
+		t.Errorf("Expected pi.lan imported, got %+v", recs)
+	}
+
+	// ... or replaced with Overwrite
+	res, err = srv.ImportHosts(core.HostsImportOptions{Path: path, Overwrite: true})
+	if err != nil {
+		t.Fatalf("ImportHosts overwrite: %v", err)
+	}
+	if len(res.Conflicts) != 1 || !res.Conflicts[0].Replaced {
+		t.Errorf("Expected a replaced conflict, got %+v", res.Conflicts)
+	}
+	if recs := srv.local.lookup("printer.lan"); len(recs) != 1 || recs[0].Value != "192.168.1.99" {
+		t.Errorf("Expected overwritten record, got %+v", recs)
+	}
+	if got := len(srv.cfg.LocalRecords); got != 3 {
+		t.Errorf("Expected 3 records in config, got %d", got)
+	}
+}
+
+func TestServer_LinkedHostsFile(t *testing.T) {
+	cfg := config.Default()
+	cfg.ConfigDir = t.TempDir()
+	cfg.LocalRecords = config.LocalRecords{{Domain: "nas.lan", Type: config.RecordA, Value: "192.168.1.10"}}
+	srv := NewServer(cfg, blocklist.NewMockManager())
+
+	path := writeHosts(t, "192.168.1.99 nas.lan\n192.168.1.30 pi.lan\n")
+	if _, err := srv.ImportHosts(core.HostsImportOptions{Path: path, Link: true}); err != nil {
+		t.Fatalf("ImportHosts link: %v", err)
+	}
+	if len(srv.cfg.LocalRecords) != 1 || len(srv.cfg.LinkedHostsFiles) != 1 {
+		t.Fatalf("Linked records must not be copied into the config: %+v", srv.cfg)
+	}
+	if recs := srv.local.lookup("nas.lan"); len(recs) != 1 || recs[0].Value != "192.168.1.10" {
+		t.Errorf("Config records take precedence, got %+v", recs)
+	}
+	if recs := srv.local.lookup("pi.lan"); len(recs) != 1 || recs[0].Source != path {
+		t.Errorf("Expected pi.lan from the linked file, got %+v", recs)
+	}
+	if err := srv.RemoveLocalRecord(config.LocalRecord{Domain: "pi.lan"}); err == nil {
+		t.Error("Removing a linked record should point at the file")
+	}
+
+	// Edits show up on reload
+	if err := os.WriteFile(path, []byte("192.168.1.31 pi.lan\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	srv.loadLinkedHosts()
+	if recs := srv.local.lookup("pi.lan"); len(recs) != 1 || recs[0].Value != "192.168.1.31" {
+		t.Errorf("Expected reloaded record, got %+v", recs)
+	}
+
+	if _, err := srv.ImportHosts(core.HostsImportOptions{Path: path, Unlink: true, DryRun: true}); err != nil {
+		t.Fatalf("Unlink dry run: %v", err)
+	}
+	if len(srv.cfg.LinkedHostsFiles) != 1 || len(srv.local.lookup("pi.lan")) != 1 {
+		t.Error("Dry run must not unlink the file")
+	}
+	if _, err := srv.ImportHosts(core.HostsImportOptions{Path: path + ".missing", Unlink: true, DryRun: true}); err == nil {
+		t.Error("Dry run of unlinking a file that is not linked should fail")
+	}
+	if _, err := srv.ImportHosts(core.HostsImportOptions{Path: path, Unlink: true}); err != nil {
+		t.Fatalf("Unlink: %v", err)
+	}
+	if recs := srv.local.lookup("pi.lan"); len(recs) != 0 {
+		t.Errorf("Unlinked records still served: %+v", recs)
+	}
+}
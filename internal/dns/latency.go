@@ -0,0 +1,150 @@
+package dns
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+
+	"0x53/internal/core"
+)
+
+const (
+	// subBucketBits splits every power of two of nanoseconds into 8 buckets,
+	// so reported percentiles are within 6.25% of the real value.
+	subBucketBits      = 3
+	subBuckets         = 1 << subBucketBits
+	latencyBucketCount = (64 - subBucketBits + 1) * subBuckets
+
+	// The recent window is made of recentSlots slots of recentSlotSpan.
+	recentSlots    = 5
+	recentSlotSpan = time.Minute
+)
+
+// latencyHistogram counts durations in log-linear buckets. It is lock-free:
+// observing is a few atomic adds.
+type latencyHistogram struct {
+	counts [latencyBucketCount]uint64
+}
+
+// latencyBucket returns the bucket of a duration of ns nanoseconds.
+func latencyBucket(ns uint64) int {
+	if ns < subBuckets {
+		return int(ns)
+	}
+	exp := bits.Len64(ns) - 1 - subBucketBits
+	sub := (ns >> exp) & (subBuckets - 1)
+	return (exp+1)<<subBucketBits + int(sub)
+}
+
+// latencyBucketBounds returns the range [lo, hi) of bucket i, in nanoseconds.
+func latencyBucketBounds(i int) (lo, hi uint64) {
+	if i < subBuckets {
+		return uint64(i), uint64(i) + 1
+	}
+	exp := i>>subBucketBits - 1
+	sub := uint64(i & (subBuckets - 1))
+	lo = (subBuckets | sub) << exp
+	return lo, lo + 1<<exp
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	atomic.AddUint64(&h.counts[latencyBucket(uint64(d))], 1)
+}
+
+// addTo adds the counts of h to counts.
+func (h *latencyHistogram) addTo(counts *[latencyBucketCount]uint64) {
+	for i := range h.counts {
+		counts[i] += atomic.LoadUint64(&h.counts[i])
+	}
+}
+
+func (h *latencyHistogram) reset() {
+	for i := range h.counts {
+		atomic.StoreUint64(&h.counts[i], 0)
+	}
+}
+
+// percentiles summarizes bucket counts, reporting the middle of the bucket
+// holding each percentile.
+func percentiles(counts *[latencyBucketCount]uint64) core.Percentiles {
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	p := core.Percentiles{Count: int(total)}
+	if total == 0 {
+		return p
+	}
+
+	targets := []struct {
+		q   float64
+		out *time.Duration
+	}{{0.50, &p.P50}, {0.90, &p.P90}, {0.99, &p.P99}}
+	var seen uint64
+	t := 0
+	for i, c := range counts {
+		seen += c
+		for t < len(targets) && float64(seen) >= targets[t].q*float64(total) {
+			lo, hi := latencyBucketBounds(i)
+			*targets[t].out = time.Duration(lo + (hi-lo)/2)
+			t++
+		}
+		if t == len(targets) {
+			break
+		}
+	}
+	return p
+}
+
+// latencyRecorder keeps the distribution of one latency since startup and
+// over the last few minutes.
+type latencyRecorder struct {
+	total  latencyHistogram
+	slots  [recentSlots]latencyHistogram
+	epochs [recentSlots]int64 // Slot number each slot currently holds
+}
+
+func (r *latencyRecorder) observe(d time.Duration, now time.Time) {
+	r.total.observe(d)
+
+	epoch := now.UnixNano() / int64(recentSlotSpan)
+	i := epoch % recentSlots
+	if old := atomic.LoadInt64(&r.epochs[i]); old != epoch {
+		// The first query of a new slot recycles it. Concurrent queries may
+		// land before the reset and be lost, which does not skew percentiles.
+		if atomic.CompareAndSwapInt64(&r.epochs[i], old, epoch) {
+			r.slots[i].reset()
+		}
+	}
+	r.slots[i].observe(d)
+}
+
+// snapshot returns the percentiles since startup and over the recent window.
+func (r *latencyRecorder) snapshot(now time.Time) (total, recent core.Percentiles) {
+	var counts [latencyBucketCount]uint64
+	r.total.addTo(&counts)
+	total = percentiles(&counts)
+
+	counts = [latencyBucketCount]uint64{}
+	epoch := now.UnixNano() / int64(recentSlotSpan)
+	for i := range r.slots {
+		if epoch-atomic.LoadInt64(&r.epochs[i]) < recentSlots {
+			r.slots[i].addTo(&counts)
+		}
+	}
+	recent = percentiles(&counts)
+	return total, recent
+}
+
+// LatencyStats returns the percentiles of query and upstream latency.
+func (s *Server) LatencyStats() core.LatencyStats {
+	now := time.Now()
+	var st core.LatencyStats
+	st.Query, st.RecentQuery = s.queryLatency.snapshot(now)
+	st.Upstream, st.RecentUpstream = s.upstreamLatency.snapshot(now)
+	st.Window = recentSlots * recentSlotSpan
+	return st
+}
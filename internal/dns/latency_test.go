@@ -0,0 +1,61 @@
+package dns
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLatencyBuckets(t *testing.T) {
+	prev := -1
+	for _, ns := range []uint64{0, 1, 7, 8, 9, 15, 16, 17, 1000, 123456789, 1 << 40, math.MaxInt64} {
+		i := latencyBucket(ns)
+		if i < prev || i >= latencyBucketCount {
+			t.Fatalf("latencyBucket(%d) = %d out of order or range", ns, i)
+		}
+		prev = i
+		if lo, hi := latencyBucketBounds(i); ns < lo || ns >= hi {
+			t.Errorf("latencyBucket(%d) = %d holding [%d, %d)", ns, i, lo, hi)
+		}
+	}
+}
+
+func TestLatencyRecorder(t *testing.T) {
+	var r latencyRecorder
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	// 1..100ms, ten minutes ago
+	for i := 1; i <= 100; i++ {
+		r.observe(time.Duration(i)*time.Millisecond, start)
+	}
+	total, _ := r.snapshot(start)
+	checks := []struct {
+		name      string
+		got, want time.Duration
+	}{
+		{"p50", total.P50, 50 * time.Millisecond},
+		{"p90", total.P90, 90 * time.Millisecond},
+		{"p99", total.P99, 99 * time.Millisecond},
+	}
+	for _, c := range checks {
+		if diff := math.Abs(float64(c.got-c.want)) / float64(c.want); diff > 0.0625 {
+			t.Errorf("%s = %s; want %s within 6.25%%", c.name, c.got, c.want)
+		}
+	}
+	if total.Count != 100 {
+		t.Errorf("Expected 100 samples, got %d", total.Count)
+	}
+
+	// A slowdown now only shows in the recent window
+	now := start.Add(10 * time.Minute)
+	for i := 0; i < 10; i++ {
+		r.observe(2*time.Second, now)
+	}
+	total, recent := r.snapshot(now)
+	if total.Count != 110 || recent.Count != 10 {
+		t.Fatalf("Expected 110 samples in total and 10 recent ones, got %d and %d", total.Count, recent.Count)
+	}
+	if recent.P50 < 1900*time.Millisecond || total.P50 > 60*time.Millisecond {
+		t.Errorf("Unexpected percentiles: total %+v, recent %+v", total, recent)
+	}
+}
@@ -0,0 +1,319 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"0x53/internal/config"
+	"0x53/internal/core"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// maxCNAMEChain bounds how many CNAMEs are followed for one answer.
+	maxCNAMEChain = 8
+	// localNegativeTTL is the SOA minimum of NODATA answers for local names.
+	localNegativeTTL = 60
+)
+
+// localZone indexes local records by name for lookups on the query path.
+// It is rebuilt on every change and never mutated afterwards.
+type localZone struct {
+	names map[string][]config.LocalRecord
+	nodes map[string]bool                 // Names with records and all their parents
+	ptr   map[string][]config.LocalRecord // Reverse name -> A/AAAA records, see buildPTR
+	above map[string]bool                 // Parents of the reverse names in ptr
+}
+
+func newLocalZone(recs []config.LocalRecord) *localZone {
+	z := &localZone{
+		names: make(map[string][]config.LocalRecord, len(recs)),
+		nodes: make(map[string]bool, len(recs)),
+		ptr:   buildPTR(recs),
+		above: make(map[string]bool),
+	}
+	for _, rec := range recs {
+		z.names[rec.Domain] = append(z.names[rec.Domain], rec)
+		for name := rec.Domain; name != ""; {
+			z.nodes[name] = true
+			_, name, _ = strings.Cut(name, ".")
+		}
+	}
+	for rev := range z.ptr {
+		for _, name, _ := strings.Cut(rev, "."); name != ""; _, name, _ = strings.Cut(name, ".") {
+			z.above[name] = true
+		}
+	}
+	return z
+}
+
+// lookup returns the records of name (lowercase, without trailing dot).
+// Without an exact match, the wildcard of the closest encloser is used
+// (RFC 4592): the nearest parent of name that exists, so "*.b.lan" wins
+// over "*.lan" for "a.b.lan", and "*.lan" does not cover "a.b.lan" when
+// "b.lan" or a name below it has records.
+func (z *localZone) lookup(name string) []config.LocalRecord {
+	if z == nil {
+		return nil
+	}
+	if recs, ok := z.names[name]; ok {
+		return recs
+	}
+	for {
+		idx := strings.IndexByte(name, '.')
+		if idx == -1 {
+			return nil
+		}
+		name = name[idx+1:]
+		if recs, ok := z.names["*."+name]; ok {
+			return recs
+		}
+		if z.nodes[name] {
+			return nil // Closest encloser without a wildcard
+		}
+	}
+}
+
+// reverse returns the records whose addresses have the reverse name name.
+func (z *localZone) reverse(name string) []config.LocalRecord {
+	if z == nil {
+		return nil
+	}
+	return z.ptr[name]
+}
+
+// reverseParent reports whether name is a parent of a reverse name with
+// records, i.e. an empty non-terminal that must not be NXDOMAIN (RFC 8020).
+func (z *localZone) reverseParent(name string) bool {
+	return z != nil && z.above[name]
+}
+
+// localRR converts rec to a resource record owned by owner (a FQDN).
+func localRR(rec config.LocalRecord, owner string) dns.RR {
+	hdr := dns.RR_Header{Name: owner, Class: dns.ClassINET, Ttl: rec.TTLOrDefault()}
+	switch rec.Type {
+	case config.RecordA:
+		hdr.Rrtype = dns.TypeA
+		return &dns.A{Hdr: hdr, A: net.ParseIP(rec.Value).To4()}
+	case config.RecordAAAA:
+		hdr.Rrtype = dns.TypeAAAA
+		return &dns.AAAA{Hdr: hdr, AAAA: net.ParseIP(rec.Value)}
+	case config.RecordCNAME:
+		hdr.Rrtype = dns.TypeCNAME
+		return &dns.CNAME{Hdr: hdr, Target: dns.Fqdn(rec.Value)}
+	case config.RecordTXT:
+		hdr.Rrtype = dns.TypeTXT
+		return &dns.TXT{Hdr: hdr, Txt: splitTXT(rec.Value)}
+	case config.RecordMX:
+		hdr.Rrtype = dns.TypeMX
+		return &dns.MX{Hdr: hdr, Preference: rec.Priority, Mx: dns.Fqdn(rec.Value)}
+	case config.RecordSRV:
+		hdr.Rrtype = dns.TypeSRV
+		return &dns.SRV{Hdr: hdr, Priority: rec.Priority, Weight: rec.Weight, Port: rec.Port, Target: dns.Fqdn(rec.Value)}
+	}
+	return nil
+}
+
+// splitTXT cuts text into the 255-byte character strings a TXT record holds.
+func splitTXT(text string) []string {
+	var parts []string
+	for len(text) > 255 {
+		parts = append(parts, text[:255])
+		text = text[255:]
+	}
+	return append(parts, text)
+}
+
+// answerLocal answers q from the local zone. It returns false if the name has
+// no local records, in which case the query takes the normal blocklist and
+// upstream path. CNAMEs are followed through the zone, and a target that is
+// not local is resolved upstream. A name with records but none of the asked
+// type gets NODATA. Reverse lookups are handled by answerReverse.
+func (s *Server) answerLocal(r *dns.Msg, q dns.Question, zone *localZone) (*dns.Msg, bool) {
+	recs := zone.lookup(normalizeDomain(q.Name))
+	if len(recs) == 0 {
+		return s.answerReverse(r, q, zone)
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	m.RecursionAvailable = true
+
+	owner := q.Name
+	for hop := 0; ; hop++ {
+		cname, isAlias := findRecord(recs, config.RecordCNAME)
+		if !isAlias || q.Qtype == dns.TypeCNAME || q.Qtype == dns.TypeANY {
+			for _, rec := range recs {
+				if q.Qtype == dns.TypeANY || dns.StringToType[rec.Type] == q.Qtype {
+					m.Answer = append(m.Answer, localRR(rec, owner))
+				}
+			}
+			break
+		}
+
+		m.Answer = append(m.Answer, localRR(cname, owner))
+		owner = dns.Fqdn(cname.Value)
+		if hop == maxCNAMEChain {
+			break
+		}
+		if recs = zone.lookup(cname.Value); len(recs) == 0 {
+			m.Answer = append(m.Answer, s.chaseCNAME(owner, q.Qtype)...)
+			break
+		}
+	}
+
+	if len(m.Answer) == 0 {
+		m.Ns = negativeSOA(r, localNegativeTTL)
+	}
+	return m, true
+}
+
+// chaseCNAME resolves the non-local target of a local CNAME upstream.
+// Failures are not fatal: the client still gets the CNAME and may retry it.
+func (s *Server) chaseCNAME(target string, qtype uint16) []dns.RR {
+	q := new(dns.Msg)
+	q.SetQuestion(target, qtype)
+
+	resp, err := s.resolve(q, nil)
+	if err != nil {
+		s.log(fmt.Sprintf("Failed to resolve CNAME target %s: %v", target, err))
+		return nil
+	}
+	return resp.Answer
+}
+
+// resolve answers r from the cache or the upstream responsible for its name,
+// noting which one in ev if it is not nil.
+func (s *Server) resolve(r *dns.Msg, ev *core.QueryEvent) (*dns.Msg, error) {
+	s.mu.RLock()
+	cache := s.cache
+	s.mu.RUnlock()
+	cacheable := cache != nil && r.Opcode == dns.OpcodeQuery
+	if cacheable {
+		if resp, ok := cache.Get(r); ok {
+			if ev != nil {
+				ev.Cached = true
+			}
+			return resp, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), upstreamTimeout)
+	defer cancel()
+	name := ""
+	if len(r.Question) > 0 {
+		name = r.Question[0].Name
+	}
+	start := time.Now()
+	resp, up, err := s.poolFor(name).Exchange(ctx, r)
+	s.upstreamLatency.observe(time.Since(start), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if ev != nil {
+		ev.Upstream = up.String()
+	}
+
+	if cacheable {
+		cache.Set(r, resp)
+	}
+	return resp, nil
+}
+
+func findRecord(recs []config.LocalRecord, typ string) (config.LocalRecord, bool) {
+	for _, rec := range recs {
+		if rec.Type == typ {
+			return rec, true
+		}
+	}
+	return config.LocalRecord{}, false
+}
+
+// sameRecord reports whether rec is selected by filter. Empty filter
+// fields match anything, so a domain alone selects all its records.
+func sameRecord(rec, filter config.LocalRecord) bool {
+	return rec.Domain == filter.Domain &&
+		(filter.Type == "" || rec.Type == filter.Type) &&
+		(filter.Value == "" || strings.EqualFold(rec.Value, filter.Value))
+}
+
+// --- Local Records Management ---
+
+// AddLocalRecord validates and stores rec, replacing an identical record.
+// A CNAME cannot share its name with any other record.
+func (s *Server) AddLocalRecord(rec config.LocalRecord) error {
+	rec.Normalize()
+	if err := rec.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recs := make(config.LocalRecords, 0, len(s.cfg.LocalRecords)+1)
+	for _, existing := range s.cfg.LocalRecords {
+		if existing.Domain == rec.Domain {
+			if sameRecord(existing, config.LocalRecord{Domain: rec.Domain, Type: rec.Type, Value: rec.Value}) {
+				continue // Replaced below
+			}
+			if existing.Type == config.RecordCNAME || rec.Type == config.RecordCNAME {
+				return fmt.Errorf("%s already has a %s record; a CNAME cannot coexist with other records", rec.Domain, existing.Type)
+			}
+		}
+		recs = append(recs, existing)
+	}
+	recs = append(recs, rec)
+
+	s.cfg.LocalRecords = recs
+	s.rebuildLocal()
+	return config.SaveCurrent(s.cfg)
+}
+
+// RemoveLocalRecord deletes the records selected by filter (see sameRecord).
+func (s *Server) RemoveLocalRecord(filter config.LocalRecord) error {
+	typed := strings.TrimSpace(filter.Type) != ""
+	filter.Normalize()
+	if !typed {
+		filter.Type = "" // Normalize defaults the type, but no type means any
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recs := make(config.LocalRecords, 0, len(s.cfg.LocalRecords))
+	for _, rec := range s.cfg.LocalRecords {
+		if !sameRecord(rec, filter) {
+			recs = append(recs, rec)
+		}
+	}
+	if len(recs) == len(s.cfg.LocalRecords) {
+		for _, rec := range s.servedRecords() {
+			if rec.Source != "" && sameRecord(rec, filter) {
+				return fmt.Errorf("%s comes from the linked hosts file %s, edit or unlink the file instead", filter.Domain, rec.Source)
+			}
+		}
+		return fmt.Errorf("local record not found: %s", filter.Domain)
+	}
+
+	s.cfg.LocalRecords = recs
+	s.rebuildLocal()
+	return config.SaveCurrent(s.cfg)
+}
+
+// ListLocalRecords returns a copy of the served local records, including
+// those of linked hosts files (see config.LocalRecord.Source).
+func (s *Server) ListLocalRecords() []config.LocalRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.servedRecords()
+}
+
+// normalizeDomain lowercases d and strips its trailing dot.
+func normalizeDomain(d string) string {
+	return strings.TrimSuffix(strings.ToLower(d), ".")
+}
@@ -0,0 +1,278 @@
+package dns
+
+import (
+	"testing"
+
+	"0x53/internal/blocklist"
+	"0x53/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+func TestServer_LocalRecords(t *testing.T) {
+	upstream := startUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A 203.0.113.7")
+		m.Answer = append(m.Answer, rr)
+		w.WriteMsg(m)
+	})
+
+	cfg := config.Default()
+	cfg.ConfigDir = t.TempDir()
+	cfg.Upstream = config.UpstreamCustom
+	cfg.CustomUpstream = upstream
+	cfg.LocalRecords = config.LocalRecords{
+		{Domain: "nas.lan", Type: config.RecordA, Value: "192.168.1.10"},
+		{Domain: "nas.lan", Type: config.RecordAAAA, Value: "fd00::10", TTL: 60},
+		{Domain: "files.lan", Type: config.RecordCNAME, Value: "nas.lan"},
+		{Domain: "status.lan", Type: config.RecordCNAME, Value: "status.example.com"},
+		{Domain: "lan", Type: config.RecordMX, Value: "mail.lan", Priority: 10},
+		{Domain: "_sip._tcp.lan", Type: config.RecordSRV, Value: "pbx.lan", Priority: 1, Weight: 5, Port: 5060},
+		{Domain: "lan", Type: config.RecordTXT, Value: "v=spf1 -all"},
+	}
+
+	srv := NewServer(cfg, blocklist.NewMockManager())
+	if err := srv.configureUpstream(); err != nil {
+		t.Fatalf("configureUpstream: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		qtype  uint16
+		answer []string // Expected answer data, in order
+		nodata bool
+	}{
+		{"NAS.lan.", dns.TypeA, []string{"192.168.1.10"}, false},
+		{"nas.lan.", dns.TypeAAAA, []string{"fd00::10"}, false},
+		{"nas.lan.", dns.TypeTXT, nil, true},
+		{"files.lan.", dns.TypeA, []string{"nas.lan.", "192.168.1.10"}, false},
+		{"files.lan.", dns.TypeCNAME, []string{"nas.lan."}, false},
+		{"status.lan.", dns.TypeA, []string{"status.example.com.", "203.0.113.7"}, false},
+		{"lan.", dns.TypeMX, []string{"10 mail.lan."}, false},
+		{"_sip._tcp.lan.", dns.TypeSRV, []string{"1 5 5060 pbx.lan."}, false},
+		{"lan.", dns.TypeTXT, []string{"\"v=spf1 -all\""}, false},
+	}
+	for _, tt := range tests {
+		q := new(dns.Msg)
+		q.SetQuestion(tt.name, tt.qtype)
+		m, ok := srv.answerLocal(q, q.Question[0], srv.local)
+		if !ok {
+			t.Errorf("%s %s: not answered locally", tt.name, dns.TypeToString[tt.qtype])
+			continue
+		}
+
+		var got []string
+		for _, rr := range m.Answer {
+			h := rr.Header().String()
+			got = append(got, rr.String()[len(h):])
+		}
+		if len(got) != len(tt.answer) {
+			t.Errorf("%s %s: answer = %v; want %v", tt.name, dns.TypeToString[tt.qtype], got, tt.answer)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.answer[i] {
+				t.Errorf("%s %s: answer = %v; want %v", tt.name, dns.TypeToString[tt.qtype], got, tt.answer)
+				break
+			}
+		}
+		if tt.nodata && (m.Rcode != dns.RcodeSuccess || len(m.Ns) != 1) {
+			t.Errorf("%s %s: expected NODATA with SOA, got %v", tt.name, dns.TypeToString[tt.qtype], m)
+		}
+	}
+
+	q := new(dns.Msg)
+	q.SetQuestion("other.lan.", dns.TypeA)
+	if _, ok := srv.answerLocal(q, q.Question[0], srv.local); ok {
+		t.Error("Names without local records must not be answered locally")
+	}
+}
+
+func TestServer_LocalRecordsManagement(t *testing.T) {
+	cfg := config.Default()
+	cfg.ConfigDir = t.TempDir()
+	srv := NewServer(cfg, blocklist.NewMockManager())
+
+	if err := srv.AddLocalRecord(config.LocalRecord{Domain: "Router.LAN.", Value: "192.168.1.1"}); err != nil {
+		t.Fatalf("AddLocalRecord: %v", err)
+	}
+	if err := srv.AddLocalRecord(config.LocalRecord{Domain: "router.lan", Type: "aaaa", Value: "fd00::1"}); err != nil {
+		t.Fatalf("AddLocalRecord AAAA: %v", err)
+	}
+	if err := srv.AddLocalRecord(config.LocalRecord{Domain: "router.lan", Type: "CNAME", Value: "gw.lan"}); err == nil {
+		t.Error("Expected CNAME next to other records to be rejected")
+	}
+	if err := srv.AddLocalRecord(config.LocalRecord{Domain: "bad.lan", Type: "A", Value: "fd00::1"}); err == nil {
+		t.Error("Expected IPv6 value in an A record to be rejected")
+	}
+	if err := srv.AddLocalRecord(config.LocalRecord{Domain: "sip.lan", Type: "SRV", Value: "pbx.lan"}); err == nil {
+		t.Error("Expected SRV record without port to be rejected")
+	}
+
+	recs := srv.ListLocalRecords()
+	if len(recs) != 2 || recs[0].Domain != "router.lan" || recs[0].Type != config.RecordA {
+		t.Fatalf("Unexpected records: %+v", recs)
+	}
+
+	if err := srv.RemoveLocalRecord(config.LocalRecord{Domain: "router.lan", Type: "AAAA"}); err != nil {
+		t.Fatalf("RemoveLocalRecord: %v", err)
+	}
+	if recs := srv.ListLocalRecords(); len(recs) != 1 || recs[0].Type != config.RecordA {
+		t.Errorf("Expected only the A record left, got %+v", recs)
+	}
+	if err := srv.RemoveLocalRecord(config.LocalRecord{Domain: "router.lan"}); err != nil {
+		t.Fatalf("RemoveLocalRecord: %v", err)
+	}
+	if err := srv.RemoveLocalRecord(config.LocalRecord{Domain: "router.lan"}); err == nil {
+		t.Error("Expected error removing a missing record")
+	}
+}
+
+func TestServer_ReverseLookups(t *testing.T) {
+	cfg := config.Default()
+	cfg.Upstream = config.UpstreamCustom
+	cfg.CustomUpstream = "192.0.2.1"
+	cfg.LocalRecords = config.LocalRecords{
+		{Domain: "nas.lan", Type: config.RecordA, Value: "192.168.1.10"},
+		{Domain: "files.lan", Type: config.RecordA, Value: "192.168.1.10", TTL: 600},
+		{Domain: "nas.lan", Type: config.RecordAAAA, Value: "fd00::10"},
+	}
+	cfg.ForwardRules = []config.ForwardRule{{Domain: "10.in-addr.arpa", Upstreams: []string{"10.0.0.1"}}}
+
+	srv := NewServer(cfg, blocklist.NewMockManager())
+	if err := srv.configureForwarders(); err != nil {
+		t.Fatalf("configureForwarders: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		local  bool
+		rcode  int
+		answer []string
+	}{
+		{"10.1.168.192.in-addr.arpa.", true, dns.RcodeSuccess, []string{"files.lan.", "nas.lan."}},
+		{"0.1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa.", true, dns.RcodeSuccess, []string{"nas.lan."}},
+		{"99.1.168.192.in-addr.arpa.", true, dns.RcodeNameError, nil},
+		{"1.168.192.in-addr.arpa.", true, dns.RcodeSuccess, nil}, // Empty non-terminal
+		{"168.192.in-addr.arpa.", true, dns.RcodeSuccess, nil},   // Zone apex
+		{"2.168.192.in-addr.arpa.", true, dns.RcodeNameError, nil},
+		{"1.0.20.172.in-addr.arpa.", true, dns.RcodeNameError, nil},
+		{"5.0.0.10.in-addr.arpa.", false, 0, nil}, // Forwarded by rule
+		{"8.8.8.8.in-addr.arpa.", false, 0, nil},  // Public space
+		{"1.0.32.172.in-addr.arpa.", false, 0, nil},
+	}
+	for _, tt := range tests {
+		q := new(dns.Msg)
+		q.SetQuestion(tt.name, dns.TypePTR)
+		m, ok := srv.answerLocal(q, q.Question[0], srv.local)
+		if ok != tt.local {
+			t.Errorf("%s: answered locally = %v; want %v", tt.name, ok, tt.local)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if m.Rcode != tt.rcode {
+			t.Errorf("%s: rcode = %d; want %d", tt.name, m.Rcode, tt.rcode)
+		}
+		if len(m.Answer) == 0 && len(m.Ns) != 1 {
+			t.Errorf("%s: expected an SOA with the negative answer, got %v", tt.name, m.Ns)
+		}
+		if len(m.Answer) != len(tt.answer) {
+			t.Errorf("%s: answer = %v; want %v", tt.name, m.Answer, tt.answer)
+			continue
+		}
+		for i, rr := range m.Answer {
+			if ptr := rr.(*dns.PTR).Ptr; ptr != tt.answer[i] {
+				t.Errorf("%s: answer %d = %s; want %s", tt.name, i, ptr, tt.answer[i])
+			}
+		}
+	}
+
+	// PTR records take the TTL of the address record they come from
+	q := new(dns.Msg)
+	q.SetQuestion("10.1.168.192.in-addr.arpa.", dns.TypePTR)
+	m, _ := srv.answerLocal(q, q.Question[0], srv.local)
+	if ttl := m.Answer[0].Header().Ttl; ttl != 600 {
+		t.Errorf("files.lan PTR TTL = %d; want 600", ttl)
+	}
+	if ttl := m.Answer[1].Header().Ttl; ttl != config.DefaultLocalTTL {
+		t.Errorf("nas.lan PTR TTL = %d; want %d", ttl, config.DefaultLocalTTL)
+	}
+}
+
+func TestServer_WildcardLocalRecords(t *testing.T) {
+	cfg := config.Default()
+	cfg.LocalRecords = config.LocalRecords{
+		{Domain: "*.dev.lan", Type: config.RecordA, Value: "192.168.1.50"},
+		{Domain: "*.api.dev.lan", Type: config.RecordA, Value: "192.168.1.60"},
+		{Domain: "db.dev.lan", Type: config.RecordA, Value: "192.168.1.70"},
+		{Domain: "docs.lan", Type: config.RecordCNAME, Value: "pr-7.dev.lan"},
+	}
+	srv := NewServer(cfg, blocklist.NewMockManager())
+
+	tests := []struct {
+		name   string
+		qtype  uint16
+		answer string // Last answer, "" for NODATA
+	}{
+		{"pr-123.dev.lan.", dns.TypeA, "192.168.1.50"},
+		{"a.b.dev.lan.", dns.TypeA, "192.168.1.50"},
+		{"v2.api.dev.lan.", dns.TypeA, "192.168.1.60"},
+		{"db.dev.lan.", dns.TypeA, "192.168.1.70"},
+		{"docs.lan.", dns.TypeA, "192.168.1.50"},
+		{"pr-123.dev.lan.", dns.TypeAAAA, ""},
+	}
+	for _, tt := range tests {
+		q := new(dns.Msg)
+		q.SetQuestion(tt.name, tt.qtype)
+		m, ok := srv.answerLocal(q, q.Question[0], srv.local)
+		if !ok {
+			t.Errorf("%s: not answered locally", tt.name)
+			continue
+		}
+		if tt.answer == "" {
+			if len(m.Answer) != 0 || len(m.Ns) != 1 || m.Rcode != dns.RcodeSuccess {
+				t.Errorf("%s %s: expected NODATA, got %v", tt.name, dns.TypeToString[tt.qtype], m)
+			}
+			continue
+		}
+		if len(m.Answer) == 0 {
+			t.Errorf("%s: no answer", tt.name)
+			continue
+		}
+		last := m.Answer[len(m.Answer)-1].(*dns.A)
+		if last.A.String() != tt.answer {
+			t.Errorf("%s: answer = %s; want %s", tt.name, last.A, tt.answer)
+		}
+		if m.Answer[0].Header().Name != tt.name {
+			t.Errorf("%s: answer owner = %s", tt.name, m.Answer[0].Header().Name)
+		}
+	}
+
+	for _, name := range []string{"dev.lan.", "other.lan."} {
+		q := new(dns.Msg)
+		q.SetQuestion(name, dns.TypeA)
+		if _, ok := srv.answerLocal(q, q.Question[0], srv.local); ok {
+			t.Errorf("%s: wildcard must only cover names below it", name)
+		}
+	}
+
+	// db.dev.lan exists, so it is the closest encloser of x.db.dev.lan and
+	// *.dev.lan does not apply below it (RFC 4592)
+	for _, name := range []string{"x.db.dev.lan.", "a.x.db.dev.lan."} {
+		q := new(dns.Msg)
+		q.SetQuestion(name, dns.TypeA)
+		if m, ok := srv.answerLocal(q, q.Question[0], srv.local); ok {
+			t.Errorf("%s: the wildcard above an existing name must not apply, got %v", name, m.Answer)
+		}
+	}
+
+	for _, bad := range []string{"a.*.lan", "*", "**.lan"} {
+		rec := config.LocalRecord{Domain: bad, Type: config.RecordA, Value: "192.168.1.1"}
+		if err := rec.Validate(); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"0x53/internal/config"
+	"0x53/internal/core"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// attemptTimeout bounds a single upstream attempt so failover has time to kick in.
+	attemptTimeout = 2 * time.Second
+	// maxFailures is how many consecutive errors sideline an upstream.
+	maxFailures = 3
+	// sidelineDuration is how long a failing upstream is skipped.
+	sidelineDuration = 30 * time.Second
+	// latencyWeight is the weight of a new sample in the moving latency average.
+	latencyWeight = 0.2
+)
+
+var errNoUpstreams = errors.New("no upstreams configured")
+
+// poolMember tracks the health and performance of one upstream.
+type poolMember struct {
+	up Upstream
+
+	queries uint64
+	errors  uint64
+
+	mu         sync.Mutex
+	avgLatency time.Duration // Exponentially weighted moving average
+	failures   int           // Consecutive failures
+	downUntil  time.Time
+}
+
+func (m *poolMember) healthy(now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !now.Before(m.downUntil)
+}
+
+func (m *poolMember) latency() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.avgLatency
+}
+
+func (m *poolMember) recordSuccess(rtt time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures = 0
+	m.downUntil = time.Time{}
+	if m.avgLatency == 0 {
+		m.avgLatency = rtt
+	} else {
+		m.avgLatency = time.Duration(latencyWeight*float64(rtt) + (1-latencyWeight)*float64(m.avgLatency))
+	}
+}
+
+// recordFailure counts an error and reports whether the upstream got sidelined.
+func (m *poolMember) recordFailure(now time.Time) bool {
+	atomic.AddUint64(&m.errors, 1)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures++
+	if m.failures >= maxFailures && !now.Before(m.downUntil) {
+		m.downUntil = now.Add(sidelineDuration)
+		return true
+	}
+	return false
+}
+
+// upstreamPool spreads queries over several upstreams according to a policy,
+// failing over to the next candidate on errors.
+type upstreamPool struct {
+	policy  config.UpstreamPolicy
+	members []*poolMember
+	next    uint32 // Round-robin cursor
+	source  string // Reported in stats, see core.UpstreamStats
+	log     func(string)
+	observe func(upstream string, rtt time.Duration, ok bool) // Optional, called after every attempt
+}
+
+func newUpstreamPool(policy config.UpstreamPolicy, ups []Upstream, log func(string)) *upstreamPool {
+	p := &upstreamPool{policy: policy, source: string(policy), log: log}
+	for _, up := range ups {
+		p.members = append(p.members, &poolMember{up: up})
+	}
+	return p
+}
+
+// order returns the members in the order they should be tried.
+// Sidelined upstreams are only used once every healthy one failed.
+func (p *upstreamPool) order(now time.Time) []*poolMember {
+	n := len(p.members)
+	ordered := make([]*poolMember, 0, n)
+
+	switch p.policy {
+	case config.PolicyRoundRobin:
+		start := int(atomic.AddUint32(&p.next, 1)-1) % n
+		for i := 0; i < n; i++ {
+			ordered = append(ordered, p.members[(start+i)%n])
+		}
+	case config.PolicyRandom:
+		for _, i := range rand.Perm(n) {
+			ordered = append(ordered, p.members[i])
+		}
+	case config.PolicyFastest:
+		ordered = append(ordered, p.members...)
+		// Untried upstreams have no latency yet and sort first, so they get measured
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ordered[i].latency() < ordered[j].latency()
+		})
+	default: // config.PolicyFailover
+		ordered = append(ordered, p.members...)
+	}
+
+	healthy := ordered[:0:0]
+	var down []*poolMember
+	for _, m := range ordered {
+		if m.healthy(now) {
+			healthy = append(healthy, m)
+		} else {
+			down = append(down, m)
+		}
+	}
+	return append(healthy, down...)
+}
+
+// Exchange forwards r to the pool, returning the answer and the upstream that gave it.
+// SERVFAIL/REFUSED answers count as failures and move on to the next upstream,
+// but are returned if no upstream did better.
+func (p *upstreamPool) Exchange(ctx context.Context, r *dns.Msg) (*dns.Msg, Upstream, error) {
+	if len(p.members) == 0 {
+		return nil, nil, errNoUpstreams
+	}
+
+	var lastResp *dns.Msg
+	var lastUp Upstream
+	var lastErr error
+
+	for _, m := range p.order(time.Now()) {
+		if ctx.Err() != nil {
+			break
+		}
+		atomic.AddUint64(&m.queries, 1)
+
+		actx, cancel := context.WithTimeout(ctx, attemptTimeout)
+		start := time.Now()
+		resp, err := m.up.Exchange(actx, r)
+		rtt := time.Since(start)
+		cancel()
+
+		ok := err == nil && resp.Rcode != dns.RcodeServerFailure && resp.Rcode != dns.RcodeRefused
+		if p.observe != nil {
+			p.observe(m.up.String(), rtt, ok)
+		}
+		if ok {
+			m.recordSuccess(rtt)
+			return resp, m.up, nil
+		}
+
+		if m.recordFailure(time.Now()) && p.log != nil {
+			p.log(fmt.Sprintf("Upstream %s is failing, sidelined for %s", m.up, sidelineDuration))
+		}
+		if err == nil {
+			lastResp, lastUp = resp, m.up
+		} else {
+			lastErr = err
+		}
+	}
+
+	if lastResp != nil {
+		return lastResp, lastUp, nil
+	}
+	if lastErr == nil {
+		lastErr = ctx.Err()
+	}
+	return nil, nil, lastErr
+}
+
+// String lists the upstream addresses in configured order.
+func (p *upstreamPool) String() string {
+	addrs := make([]string, len(p.members))
+	for i, m := range p.members {
+		addrs[i] = m.up.String()
+	}
+	return strings.Join(addrs, ", ")
+}
+
+// Stats returns a snapshot of every upstream's counters.
+func (p *upstreamPool) Stats() []core.UpstreamStats {
+	now := time.Now()
+	stats := make([]core.UpstreamStats, 0, len(p.members))
+	for _, m := range p.members {
+		stats = append(stats, core.UpstreamStats{
+			Address:    m.up.String(),
+			Queries:    int(atomic.LoadUint64(&m.queries)),
+			Errors:     int(atomic.LoadUint64(&m.errors)),
+			AvgLatency: m.latency(),
+			Healthy:    m.healthy(now),
+			Source:     p.source,
+		})
+	}
+	return stats
+}
+
+// close releases the connections the members keep open between queries.
+func (p *upstreamPool) close() {
+	for _, m := range p.members {
+		if c, ok := m.up.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// retire closes pools that were replaced, once the queries still using them
+// have had upstreamTimeout to finish. Nil pools are skipped.
+func retire(pools ...*upstreamPool) {
+	time.AfterFunc(upstreamTimeout, func() {
+		for _, p := range pools {
+			if p != nil {
+				p.close()
+			}
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"0x53/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+// fakeUpstream answers with a fixed rcode or fails with err.
+type fakeUpstream struct {
+	name   string
+	rcode  int
+	err    error
+	delay  time.Duration
+	calls  int
+	closed bool
+}
+
+func (f *fakeUpstream) Exchange(ctx context.Context, r *dns.Msg) (*dns.Msg, error) {
+	f.calls++
+	time.Sleep(f.delay)
+	if f.err != nil {
+		return nil, f.err
+	}
+	m := new(dns.Msg)
+	m.SetRcode(r, f.rcode)
+	return m, nil
+}
+
+func (f *fakeUpstream) String() string { return f.name }
+
+func (f *fakeUpstream) Close() error {
+	f.closed = true
+	return nil
+}
+
+func testQuery() *dns.Msg {
+	q := new(dns.Msg)
+	q.SetQuestion("pool.example.", dns.TypeA)
+	return q
+}
+
+func TestUpstreamPool_Failover(t *testing.T) {
+	broken := &fakeUpstream{name: "broken", err: errors.New("timeout")}
+	servfail := &fakeUpstream{name: "servfail", rcode: dns.RcodeServerFailure}
+	good := &fakeUpstream{name: "good", rcode: dns.RcodeSuccess}
+
+	pool := newUpstreamPool(config.PolicyFailover, []Upstream{broken, servfail, good}, nil)
+	var attempts []string
+	pool.observe = func(upstream string, rtt time.Duration, ok bool) {
+		attempts = append(attempts, fmt.Sprintf("%s:%v", upstream, ok))
+	}
+
+	resp, up, err := pool.Exchange(context.Background(), testQuery())
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if up != good || resp.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected answer from good upstream, got %v (rcode %d)", up, resp.Rcode)
+	}
+	if got := strings.Join(attempts, " "); got != "broken:false servfail:false good:true" {
+		t.Errorf("Unexpected observed attempts: %s", got)
+	}
+
+	// After maxFailures the broken upstreams are sidelined and tried last
+	for i := 1; i < maxFailures; i++ {
+		pool.Exchange(context.Background(), testQuery())
+	}
+	brokenCalls := broken.calls
+	pool.Exchange(context.Background(), testQuery())
+	if broken.calls != brokenCalls {
+		t.Error("Sidelined upstream should not be tried while a healthy one answers")
+	}
+
+	stats := pool.Stats()
+	if stats[0].Healthy || stats[1].Healthy || !stats[2].Healthy {
+		t.Errorf("Unexpected health: %+v", stats)
+	}
+	if stats[0].Errors != maxFailures {
+		t.Errorf("Expected %d errors for broken upstream, got %d", maxFailures, stats[0].Errors)
+	}
+}
+
+func TestUpstreamPool_AllFailReturnsLastAnswer(t *testing.T) {
+	servfail := &fakeUpstream{name: "servfail", rcode: dns.RcodeServerFailure}
+	broken := &fakeUpstream{name: "broken", err: errors.New("timeout")}
+
+	pool := newUpstreamPool(config.PolicyFailover, []Upstream{servfail, broken}, nil)
+	resp, _, err := pool.Exchange(context.Background(), testQuery())
+	if err != nil || resp.Rcode != dns.RcodeServerFailure {
+		t.Errorf("Expected the SERVFAIL answer back, got resp=%v err=%v", resp, err)
+	}
+}
+
+func TestUpstreamPool_RoundRobin(t *testing.T) {
+	a := &fakeUpstream{name: "a"}
+	b := &fakeUpstream{name: "b"}
+	pool := newUpstreamPool(config.PolicyRoundRobin, []Upstream{a, b}, nil)
+
+	for i := 0; i < 10; i++ {
+		pool.Exchange(context.Background(), testQuery())
+	}
+	if a.calls != 5 || b.calls != 5 {
+		t.Errorf("Expected even spread, got a=%d b=%d", a.calls, b.calls)
+	}
+}
+
+func TestUpstreamPool_Fastest(t *testing.T) {
+	slow := &fakeUpstream{name: "slow", delay: 20 * time.Millisecond}
+	fast := &fakeUpstream{name: "fast"}
+	pool := newUpstreamPool(config.PolicyFastest, []Upstream{slow, fast}, nil)
+
+	// Seed both latencies
+	pool.members[0].recordSuccess(20 * time.Millisecond)
+	pool.members[1].recordSuccess(time.Millisecond)
+
+	_, up, _ := pool.Exchange(context.Background(), testQuery())
+	if up != fast {
+		t.Errorf("Expected fastest upstream, got %v", up)
+	}
+}
+
+func TestPool_Close(t *testing.T) {
+	a, b := &fakeUpstream{name: "a"}, &fakeUpstream{name: "b"}
+	p := newUpstreamPool(config.PolicyFailover, []Upstream{a, b}, nil)
+	p.close()
+	if !a.closed || !b.closed {
+		t.Errorf("Expected every member closed, got a=%v b=%v", a.closed, b.closed)
+	}
+}
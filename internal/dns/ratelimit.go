@@ -0,0 +1,170 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"0x53/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+// rateSweepInterval is how often idle buckets are forgotten.
+const rateSweepInterval = time.Minute
+
+// rateLimiter is a token bucket per client prefix, compiled from the
+// cfg.RateLimit* settings. Loopback clients are never limited: every local
+// application shares that address.
+type rateLimiter struct {
+	rate   float64 // Tokens per second
+	burst  float64
+	slip   int // Every slip-th throttled UDP query gets a truncated reply, 0 never
+	v4Bits int
+	v6Bits int
+
+	mu        sync.Mutex
+	buckets   map[netip.Prefix]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens    float64
+	last      time.Time
+	throttled int // Queries throttled since the bucket last had a token
+}
+
+// newRateLimiter returns nil (no limiting) when the rate is 0.
+func newRateLimiter(cfg *config.Config) (*rateLimiter, error) {
+	if cfg.RateLimit <= 0 {
+		return nil, nil
+	}
+	if cfg.RateLimitIPv4Prefix < 0 || cfg.RateLimitIPv4Prefix > 32 {
+		return nil, fmt.Errorf("invalid rate_limit_ipv4_prefix: %d", cfg.RateLimitIPv4Prefix)
+	}
+	if cfg.RateLimitIPv6Prefix < 0 || cfg.RateLimitIPv6Prefix > 128 {
+		return nil, fmt.Errorf("invalid rate_limit_ipv6_prefix: %d", cfg.RateLimitIPv6Prefix)
+	}
+	burst := cfg.RateLimitBurst
+	if burst < cfg.RateLimit {
+		burst = cfg.RateLimit
+	}
+	return &rateLimiter{
+		rate:    float64(cfg.RateLimit),
+		burst:   float64(burst),
+		slip:    cfg.RateLimitSlip,
+		v4Bits:  cfg.RateLimitIPv4Prefix,
+		v6Bits:  cfg.RateLimitIPv6Prefix,
+		buckets: make(map[netip.Prefix]*bucket),
+		now:     time.Now,
+	}, nil
+}
+
+// take spends a token of ip's bucket. When none is left it returns false
+// and how many queries of the client have been throttled in a row.
+func (l *rateLimiter) take(ip net.IP) (bool, int) {
+	if l == nil || ip == nil || ip.IsLoopback() {
+		return true, 0
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return true, 0
+	}
+	addr = addr.Unmap()
+	bits := l.v6Bits
+	if addr.Is4() {
+		bits = l.v4Bits
+	}
+	key, _ := addr.Prefix(bits)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > rateSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		b.throttled++
+		return false, b.throttled
+	}
+	b.tokens--
+	b.throttled = 0
+	return true, 0
+}
+
+// sweep forgets buckets that have refilled, they hold no state. Caller must hold l.mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// configureRateLimit (re)builds the per-client rate limiter from config.
+func (s *Server) configureRateLimit() error {
+	s.mu.RLock()
+	limiter, err := newRateLimiter(s.cfg)
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.limiter = limiter
+	s.mu.Unlock()
+	return nil
+}
+
+// throttle applies the client's rate limit, returning false if the query
+// was throttled. Throttled UDP queries are dropped, except every slip-th
+// one which gets an empty truncated reply so real clients retry over TCP.
+// Throttled TCP queries are refused.
+func (s *Server) throttle(w dns.ResponseWriter, r *dns.Msg) bool {
+	s.mu.RLock()
+	limiter := s.limiter
+	s.mu.RUnlock()
+
+	ip := clientIP(w.RemoteAddr())
+	ok, throttled := limiter.take(ip)
+	if ok {
+		return true
+	}
+
+	atomic.AddUint64(&s.statsThrottled, 1)
+	if throttled == 1 {
+		s.log(fmt.Sprintf("[THROTTLED] %s exceeded %g queries/s", ip, limiter.rate))
+	}
+
+	m := new(dns.Msg)
+	if _, isUDP := w.RemoteAddr().(*net.UDPAddr); !isUDP {
+		m.SetRcode(r, dns.RcodeRefused)
+		w.WriteMsg(m)
+		return false
+	}
+	if limiter.slip > 0 && throttled%limiter.slip == 0 {
+		m.SetReply(r)
+		m.Truncated = true
+		w.WriteMsg(m)
+	}
+	return false
+}
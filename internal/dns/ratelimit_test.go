@@ -0,0 +1,108 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"0x53/internal/blocklist"
+	"0x53/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+func TestRateLimiter_TokenBucket(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit = 10
+	cfg.RateLimitBurst = 20
+	cfg.RateLimitIPv6Prefix = 64
+
+	l, err := newRateLimiter(cfg)
+	if err != nil {
+		t.Fatalf("newRateLimiter: %v", err)
+	}
+	now := time.Unix(1000, 0)
+	l.now = func() time.Time { return now }
+
+	client := net.ParseIP("192.168.1.7")
+	for i := 0; i < 20; i++ {
+		if ok, _ := l.take(client); !ok {
+			t.Fatalf("Query %d throttled within the burst", i)
+		}
+	}
+	if ok, n := l.take(client); ok || n != 1 {
+		t.Errorf("Expected first throttled query, got ok=%v n=%d", ok, n)
+	}
+	if ok, _ := l.take(net.ParseIP("192.168.1.8")); !ok {
+		t.Error("Other clients must have their own bucket")
+	}
+	if ok, _ := l.take(net.ParseIP("127.0.0.1")); !ok {
+		t.Error("Loopback must never be limited")
+	}
+
+	// 10 tokens per second
+	now = now.Add(500 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		if ok, _ := l.take(client); !ok {
+			t.Fatalf("Query %d throttled after refill", i)
+		}
+	}
+	if ok, n := l.take(client); ok || n != 1 {
+		t.Errorf("Expected throttling to start over after a refill, got ok=%v n=%d", ok, n)
+	}
+
+	// IPv6 clients of the same /64 share a bucket
+	for i := 0; i < 20; i++ {
+		l.take(net.ParseIP("2001:db8:1:2::1"))
+	}
+	if ok, _ := l.take(net.ParseIP("2001:db8:1:2::99")); ok {
+		t.Error("Expected the /64 to share its bucket")
+	}
+
+	// Idle buckets are swept once full again
+	now = now.Add(2 * rateSweepInterval)
+	l.take(client)
+	if len(l.buckets) != 1 {
+		t.Errorf("Expected idle buckets to be swept, %d left", len(l.buckets))
+	}
+}
+
+func TestServer_ThrottleSlip(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit = 1
+	cfg.RateLimitBurst = 1
+	cfg.RateLimitSlip = 2
+	srv := NewServer(cfg, blocklist.NewMockManager())
+
+	send := func(addr net.Addr) *dns.Msg {
+		w := &testWriter{remote: addr}
+		r := new(dns.Msg)
+		r.SetQuestion("example.com.", dns.TypeA)
+		if srv.throttle(w, r) {
+			return nil
+		}
+		if w.msg == nil {
+			return new(dns.Msg) // Dropped
+		}
+		return w.msg
+	}
+
+	udp := &net.UDPAddr{IP: net.ParseIP("192.168.1.7"), Port: 4000}
+	if m := send(udp); m != nil {
+		t.Fatalf("First query must pass, got %v", m)
+	}
+	if m := send(udp); m == nil || m.Truncated {
+		t.Errorf("Expected the first throttled query dropped, got %v", m)
+	}
+	if m := send(udp); m == nil || !m.Truncated {
+		t.Errorf("Expected a truncated slip reply, got %v", m)
+	}
+
+	tcp := &net.TCPAddr{IP: net.ParseIP("192.168.1.7"), Port: 4000}
+	if m := send(tcp); m == nil || m.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED over TCP, got %v", m)
+	}
+	if got := srv.Stats().Throttled; got != 3 {
+		t.Errorf("Expected 3 throttled queries, got %d", got)
+	}
+}
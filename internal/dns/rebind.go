@@ -0,0 +1,77 @@
+package dns
+
+import (
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// cgnatNet is the shared address space of carrier-grade NAT (RFC 6598).
+var cgnatNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isRebindAddress reports whether ip is private, loopback, link-local or
+// CGNAT: addresses a public name has no business resolving to. 0.0.0.0 and
+// :: are left alone, blocking upstreams answer with them.
+func isRebindAddress(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		cgnatNet.Contains(ip)
+}
+
+// rebindExempt reports whether name may resolve to internal addresses:
+// it is allowlisted for group, under a configured exemption, or sent to an
+// internal resolver by a forward rule.
+func (s *Server) rebindExempt(name, group string) bool {
+	name = normalizeSuffix(name)
+	if s.forwarderFor(name) != nil {
+		return true
+	}
+	if s.blocklists != nil && s.blocklists.IsAllowed(name, group) {
+		return true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, exempt := range s.cfg.RebindExempt {
+		exempt = normalizeSuffix(exempt)
+		if name == exempt || strings.HasSuffix(name, "."+exempt) {
+			return true
+		}
+	}
+	return false
+}
+
+// guardRebinding removes internal addresses from the answer of a public name,
+// to stop DNS rebinding attacks against the LAN and localhost. It returns the
+// first removed address, and whether nothing usable is left so the whole
+// answer must be refused.
+func (s *Server) guardRebinding(resp *dns.Msg) (net.IP, bool) {
+	var removed net.IP
+	kept := resp.Answer[:0:0]
+	addresses := 0
+	for _, rr := range resp.Answer {
+		var ip net.IP
+		switch rr := rr.(type) {
+		case *dns.A:
+			ip = rr.A
+		case *dns.AAAA:
+			ip = rr.AAAA
+		}
+		if ip != nil && isRebindAddress(ip) {
+			if removed == nil {
+				removed = ip
+			}
+			continue
+		}
+		if ip != nil {
+			addresses++
+		}
+		kept = append(kept, rr)
+	}
+
+	if removed == nil {
+		return nil, false
+	}
+	resp.Answer = kept
+	return removed, addresses == 0
+}
@@ -0,0 +1,93 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"0x53/internal/blocklist"
+	"0x53/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+func TestIsRebindAddress(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"192.168.1.1", true},
+		{"10.0.0.5", true},
+		{"172.16.0.1", true},
+		{"127.0.0.1", true},
+		{"169.254.10.1", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", false}, // Sink answer of blocking upstreams
+		{"::", false},
+		{"::1", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"::ffff:192.168.1.1", true},
+		{"8.8.8.8", false},
+		{"100.128.0.1", false},
+		{"2001:4860::8888", false},
+	}
+	for _, tt := range tests {
+		if got := isRebindAddress(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isRebindAddress(%s) = %v; want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestServer_GuardRebinding(t *testing.T) {
+	cfg := config.Default()
+	cfg.RebindExempt = []string{"plex.direct", "*.corp.example"}
+	cfg.ForwardRules = []config.ForwardRule{{Domain: "home.lan", Upstreams: []string{"192.168.1.1"}}}
+	bl := blocklist.NewMockManager()
+	bl.AddAllowed("printer.example")
+	srv := NewServer(cfg, bl)
+	if err := srv.configureForwarders(); err != nil {
+		t.Fatalf("configureForwarders: %v", err)
+	}
+
+	answer := func(records ...string) *dns.Msg {
+		m := new(dns.Msg)
+		for _, s := range records {
+			rr, _ := dns.NewRR(s)
+			m.Answer = append(m.Answer, rr)
+		}
+		return m
+	}
+
+	// Mixed answer: the internal address is removed
+	resp := answer("evil.example. 60 IN A 203.0.113.5", "evil.example. 60 IN A 192.168.1.1")
+	ip, refuse := srv.guardRebinding(resp)
+	if ip.String() != "192.168.1.1" || refuse || len(resp.Answer) != 1 {
+		t.Errorf("Expected the private address stripped, got %v refuse=%v answer=%v", ip, refuse, resp.Answer)
+	}
+
+	// Only internal addresses: refused
+	resp = answer("evil.example. 60 IN CNAME lo.example.", "lo.example. 60 IN A 127.0.0.1")
+	if ip, refuse := srv.guardRebinding(resp); ip == nil || !refuse {
+		t.Errorf("Expected refusal, got %v refuse=%v", ip, refuse)
+	}
+
+	// Public answers pass untouched
+	resp = answer("good.example. 60 IN AAAA 2001:db8::1")
+	if ip, _ := srv.guardRebinding(resp); ip != nil || len(resp.Answer) != 1 {
+		t.Errorf("Expected public answer untouched, got %v", ip)
+	}
+
+	for name, want := range map[string]bool{
+		"abc.plex.direct.":  true,
+		"plex.direct.":      true,
+		"git.corp.example.": true,
+		"nas.home.lan.":     true,
+		"printer.example.":  true,
+		"notplex.direct.":   false,
+		"evil.example.":     false,
+	} {
+		if got := srv.rebindExempt(name, ""); got != want {
+			t.Errorf("rebindExempt(%s) = %v; want %v", name, got, want)
+		}
+	}
+}
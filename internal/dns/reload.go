@@ -0,0 +1,237 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"0x53/internal/config"
+	"0x53/internal/core"
+
+	"github.com/miekg/dns"
+)
+
+// drainTimeout bounds how long replaced listeners may take to finish the
+// queries in flight.
+const drainTimeout = 5 * time.Second
+
+// cacheKeys are the settings the answer cache is built from; changing one
+// of them empties the cache.
+var cacheKeys = []string{"cache_size", "cache_min_ttl", "cache_max_ttl"}
+
+// bindAddr returns the address the listeners of cfg bind to.
+func bindAddr(cfg *config.Config) string {
+	return net.JoinHostPort(cfg.BindIP, strconv.Itoa(cfg.BindPort))
+}
+
+// listen binds a UDP and a TCP listener on addr, which serve must start.
+func (s *Server) listen(addr string) (*dns.Server, *dns.Server, error) {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		pc.Close()
+		return nil, nil, err
+	}
+
+	handler := dns.HandlerFunc(s.handleRequest)
+	udp := &dns.Server{Addr: addr, Net: "udp", PacketConn: pc, Handler: handler}
+	tcp := &dns.Server{Addr: addr, Net: "tcp", Listener: ln, Handler: handler}
+	return udp, tcp, nil
+}
+
+// serve makes udp and tcp the server's listeners and starts them. started,
+// if not nil, is called once both of them are accepting queries.
+func (s *Server) serve(udp, tcp *dns.Server, started func()) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	udp.NotifyStartedFunc = wg.Done
+	tcp.NotifyStartedFunc = wg.Done
+
+	s.mu.Lock()
+	s.udpServer, s.tcpServer = udp, tcp
+	s.mu.Unlock()
+
+	for _, srv := range []*dns.Server{udp, tcp} {
+		go func(srv *dns.Server) {
+			if err := srv.ActivateAndServe(); err != nil {
+				fmt.Printf("DNS %s server on %s stopped: %v\n", srv.Net, srv.Addr, err)
+			}
+		}(srv)
+	}
+	if started != nil {
+		go func() {
+			wg.Wait()
+			started()
+		}()
+	}
+}
+
+// shutdown stops udp and tcp, waiting for the queries in flight until ctx
+// is done. Either may be nil.
+func shutdown(ctx context.Context, udp, tcp *dns.Server) error {
+	var errs []error
+	if udp != nil {
+		if err := udp.ShutdownContext(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("udp: %w", err))
+		}
+	}
+	if tcp != nil {
+		if err := tcp.ShutdownContext(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("tcp: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// drain shuts down replaced listeners, letting their queries finish.
+func (s *Server) drain(udp, tcp *dns.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if err := shutdown(ctx, udp, tcp); err != nil {
+		s.log(fmt.Sprintf("Closing old listeners: %v", err))
+	}
+}
+
+// rebind moves the listeners from old to addr. The new ones are bound first
+// so no query goes unanswered; when addr overlaps old (e.g. 0.0.0.0:53 to
+// 192.168.1.2:53) the old ones must be closed first, and are restored if
+// addr still cannot be bound.
+func (s *Server) rebind(old, addr string) error {
+	s.mu.RLock()
+	oldUDP, oldTCP := s.udpServer, s.tcpServer
+	s.mu.RUnlock()
+
+	udp, tcp, err := s.listen(addr)
+	if err == nil {
+		s.serve(udp, tcp, nil)
+		s.drain(oldUDP, oldTCP)
+		return nil
+	}
+
+	s.drain(oldUDP, oldTCP)
+	if udp, tcp, err = s.listen(addr); err == nil {
+		s.serve(udp, tcp, nil)
+		return nil
+	}
+	if udp, tcp, rerr := s.listen(old); rerr == nil {
+		s.serve(udp, tcp, nil)
+	} else {
+		s.log(fmt.Sprintf("Cannot listen on %s again: %v", old, rerr))
+	}
+	return err
+}
+
+// serverKeys returns the settings the server applies on reload.
+func serverKeys() []string {
+	var keys []string
+	for _, key := range config.Keys() {
+		if !slices.Contains(config.ListKeys, key) && !slices.Contains(config.RestartKeys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Reload re-reads the configuration file and applies it: upstreams (re-running
+// detection in auto mode), forwarding rules, local records and linked hosts
+// files, client groups, access lists, rate limits, blocking settings, and the
+// listen address, rebound without dropping queries in flight. The blocklist
+// manager takes the sources, allowlist and denylist.
+//
+// Everything is built before anything is swapped in, so an invalid file
+// changes nothing. Without a configuration file the current settings are
+// re-applied.
+func (s *Server) Reload() (core.ReloadResult, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	s.mu.RLock()
+	path := config.CurrentPath(s.cfg)
+	res := core.ReloadResult{Path: path}
+	next, err := config.LoadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && s.cfg.Path == "":
+		res.Path = ""
+		next = &config.Config{}
+		config.Copy(next, s.cfg, serverKeys())
+		err = nil
+	case err == nil:
+		err = next.Validate()
+	}
+	s.mu.RUnlock()
+	if err != nil {
+		return res, err
+	}
+
+	s.mu.RLock()
+	changed := config.Diff(s.cfg, next, serverKeys())
+	if res.Path != "" {
+		res.Restart = config.Diff(s.cfg, next, config.RestartKeys)
+	}
+	resetCache := len(config.Diff(s.cfg, next, cacheKeys)) > 0
+	old, started := bindAddr(s.cfg), s.udpServer != nil
+	s.mu.RUnlock()
+
+	acl, err := newClientACL(next)
+	if err != nil {
+		return res, err
+	}
+	limiter, err := newRateLimiter(next)
+	if err != nil {
+		return res, err
+	}
+	upstreams, err := s.buildUpstreams(next)
+	if err != nil {
+		return res, err
+	}
+	forwarders, err := s.buildForwarders(s.forwardOptions(next), next.ForwardRules)
+	if err != nil {
+		return res, err
+	}
+	hosts := s.readLinkedHosts(next.LinkedHostsFiles)
+	clients := newClientTable(next.ClientGroups)
+
+	if addr := bindAddr(next); addr != old && started {
+		if err := s.rebind(old, addr); err != nil {
+			return res, err
+		}
+		res.Rebound = true
+		s.log(fmt.Sprintf("DNS server moved from %s to %s", old, addr))
+	}
+
+	s.mu.Lock()
+	retire(append(slices.Collect(maps.Values(s.forwarders)), s.upstreams)...)
+	config.Copy(s.cfg, next, changed)
+	s.acl = acl
+	s.limiter = limiter
+	s.upstreams = upstreams
+	s.forwarders = forwarders
+	s.hosts = hosts
+	s.clients = clients
+	if resetCache {
+		s.cache = newAnswerCache(next.CacheSize, next.CacheMinTTL, next.CacheMaxTTL)
+	}
+	s.rebuildLocal()
+	s.mu.Unlock()
+
+	if res.Path != "" && s.blocklists != nil {
+		changed = append(changed, s.blocklists.ApplyConfig(next)...)
+	}
+	changed = append(changed, res.Restart...)
+	for _, key := range config.Keys() {
+		if slices.Contains(changed, key) {
+			res.Changed = append(res.Changed, key)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,123 @@
+package dns
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"0x53/internal/blocklist"
+	"0x53/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+// answering returns an upstream answering every A query with ip.
+func answering(t *testing.T, ip string) string {
+	return startUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A " + ip)
+		m.Answer = append(m.Answer, rr)
+		w.WriteMsg(m)
+	})
+}
+
+func TestServer_Reload(t *testing.T) {
+	first, second := answering(t, "192.0.2.1"), answering(t, "192.0.2.2")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	cfg := config.Default()
+	cfg.BindIP = "127.0.0.1"
+	cfg.BindPort = 5358
+	cfg.Upstream = config.UpstreamCustom
+	cfg.CustomUpstream = first
+	if err := config.Save(cfg, path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+
+	srv := NewServer(cfg, blocklist.NewMockManager())
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer srv.Stop()
+	<-srv.Ready
+
+	query := func(addr, name string) string {
+		c := &dns.Client{Timeout: 300 * time.Millisecond}
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeA)
+		r, _, err := c.Exchange(m, addr)
+		if err != nil || len(r.Answer) == 0 {
+			return ""
+		}
+		return r.Answer[0].(*dns.A).A.String()
+	}
+	if got := query("127.0.0.1:5358", "a.example."); got != "192.0.2.1" {
+		t.Fatalf("Expected 192.0.2.1 before reload, got %q", got)
+	}
+
+	// Edit the file: new upstream, a local record, a new port, and a
+	// setting that needs a restart
+	next, _ := config.LoadFile(path)
+	next.CustomUpstream = second
+	next.LocalRecords = config.LocalRecords{{Domain: "nas.lan", Type: config.RecordA, Value: "192.168.1.10"}}
+	next.BindPort = 5359
+	next.LogPath = "/tmp/elsewhere.log"
+	if err := config.Save(next, path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	res, err := srv.Reload()
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	want := []string{"bind_port", "custom_upstream", "local_records", "log_path"}
+	for _, key := range want {
+		if !strings.Contains(strings.Join(res.Changed, " "), key) {
+			t.Errorf("Changed = %v; missing %s", res.Changed, key)
+		}
+	}
+	if len(res.Changed) != len(want) {
+		t.Errorf("Changed = %v; want %v", res.Changed, want)
+	}
+	if len(res.Restart) != 1 || res.Restart[0] != "log_path" {
+		t.Errorf("Restart = %v; want [log_path]", res.Restart)
+	}
+	if !res.Rebound || res.Path != path {
+		t.Errorf("Expected %s to rebind the listeners, got %+v", path, res)
+	}
+	if cfg.LogPath == next.LogPath {
+		t.Errorf("A restart-only setting was applied")
+	}
+
+	if got := query("127.0.0.1:5359", "b.example."); got != "192.0.2.2" {
+		t.Errorf("Expected the new upstream on the new port, got %q", got)
+	}
+	if got := query("127.0.0.1:5359", "nas.lan."); got != "192.168.1.10" {
+		t.Errorf("Expected the new local record, got %q", got)
+	}
+	if got := query("127.0.0.1:5358", "c.example."); got != "" {
+		t.Errorf("The old port still answers: %q", got)
+	}
+
+	// An invalid file changes nothing
+	if err := os.WriteFile(path, []byte("bind_port: 5360\nupstream_policy: bogus\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.Reload(); err == nil {
+		t.Errorf("Expected an invalid configuration to be rejected")
+	}
+	if cfg.BindPort != 5359 {
+		t.Errorf("A rejected reload changed bind_port to %d", cfg.BindPort)
+	}
+	if got := query("127.0.0.1:5359", "nas.lan."); got != "192.168.1.10" {
+		t.Errorf("Expected the server to keep serving after a rejected reload, got %q", got)
+	}
+}
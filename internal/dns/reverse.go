@@ -0,0 +1,134 @@
+package dns
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"0x53/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+// privateReverseZones are the reverse zones of address space that is never
+// delegated on the public Internet (RFC 6303, plus 100.64.0.0/10 from RFC 7793).
+// Queries for them are answered locally instead of leaking upstream.
+var privateReverseZones = func() map[string]bool {
+	zones := map[string]bool{
+		"0.in-addr.arpa":               true, // 0.0.0.0/8
+		"10.in-addr.arpa":              true, // 10.0.0.0/8
+		"127.in-addr.arpa":             true, // 127.0.0.0/8
+		"254.169.in-addr.arpa":         true, // 169.254.0.0/16
+		"168.192.in-addr.arpa":         true, // 192.168.0.0/16
+		"2.0.192.in-addr.arpa":         true, // TEST-NET-1
+		"100.51.198.in-addr.arpa":      true, // TEST-NET-2
+		"113.0.203.in-addr.arpa":       true, // TEST-NET-3
+		"255.255.255.255.in-addr.arpa": true, // Broadcast
+		"c.f.ip6.arpa":                 true, // fc00::/8
+		"d.f.ip6.arpa":                 true, // fd00::/8
+		"8.e.f.ip6.arpa":               true, // fe80::/10
+		"9.e.f.ip6.arpa":               true,
+		"a.e.f.ip6.arpa":               true,
+		"b.e.f.ip6.arpa":               true,
+		"8.b.d.0.1.0.0.2.ip6.arpa":     true, // 2001:db8::/32
+	}
+	for i := 16; i <= 31; i++ {
+		zones[fmt.Sprintf("%d.172.in-addr.arpa", i)] = true // 172.16.0.0/12
+	}
+	for i := 64; i <= 127; i++ {
+		zones[fmt.Sprintf("%d.100.in-addr.arpa", i)] = true // 100.64.0.0/10
+	}
+	zones[strings.Repeat("0.", 32)+"ip6.arpa"] = true      // ::
+	zones["1."+strings.Repeat("0.", 31)+"ip6.arpa"] = true // ::1
+	return zones
+}()
+
+// isPrivateReverse reports whether name lies in one of privateReverseZones.
+func isPrivateReverse(name string) bool {
+	if !strings.HasSuffix(name, ".in-addr.arpa") && !strings.HasSuffix(name, ".ip6.arpa") {
+		return false
+	}
+	for {
+		if privateReverseZones[name] {
+			return true
+		}
+		idx := strings.IndexByte(name, '.')
+		if idx == -1 {
+			return false
+		}
+		name = name[idx+1:]
+	}
+}
+
+// buildPTR maps the reverse name of every local A/AAAA address to the records
+// pointing at it, sorted by name so answers with several names are
+// deterministic.
+func buildPTR(recs []config.LocalRecord) map[string][]config.LocalRecord {
+	ptr := make(map[string][]config.LocalRecord)
+	for _, rec := range recs {
+		if rec.Type != config.RecordA && rec.Type != config.RecordAAAA || rec.IsWildcard() {
+			continue
+		}
+		rev, err := dns.ReverseAddr(rec.Value)
+		if err != nil {
+			continue
+		}
+		rev = normalizeDomain(rev)
+		ptr[rev] = append(ptr[rev], rec)
+	}
+	for rev, list := range ptr {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Domain != list[j].Domain {
+				return list[i].Domain < list[j].Domain
+			}
+			return list[i].TTLOrDefault() < list[j].TTLOrDefault()
+		})
+		// Drop duplicates, e.g. a name listed in both the config and a hosts
+		// file, keeping the shortest TTL
+		uniq := list[:1]
+		for _, rec := range list[1:] {
+			if rec.Domain != uniq[len(uniq)-1].Domain {
+				uniq = append(uniq, rec)
+			}
+		}
+		ptr[rev] = uniq
+	}
+	return ptr
+}
+
+// answerReverse answers reverse lookups from the local A/AAAA records, and
+// NXDOMAIN for unknown names in private reverse zones, unless a forward rule
+// sends that zone to a resolver that knows it. The apex of such a zone and
+// the parents of local reverse names exist, and get NODATA instead.
+func (s *Server) answerReverse(r *dns.Msg, q dns.Question, zone *localZone) (*dns.Msg, bool) {
+	name := normalizeDomain(q.Name)
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	m.RecursionAvailable = true
+
+	if recs := zone.reverse(name); len(recs) > 0 {
+		if q.Qtype == dns.TypePTR || q.Qtype == dns.TypeANY {
+			for _, rec := range recs {
+				m.Answer = append(m.Answer, &dns.PTR{
+					Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: rec.TTLOrDefault()},
+					Ptr: dns.Fqdn(rec.Domain),
+				})
+			}
+		}
+		if len(m.Answer) == 0 {
+			m.Ns = negativeSOA(r, localNegativeTTL)
+		}
+		return m, true
+	}
+
+	if !isPrivateReverse(name) || s.forwarderFor(name) != nil {
+		return nil, false
+	}
+	if !privateReverseZones[name] && !zone.reverseParent(name) {
+		m.Rcode = dns.RcodeNameError
+	}
+	m.Ns = negativeSOA(r, localNegativeTTL)
+	return m, true
+}
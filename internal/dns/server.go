@@ -3,7 +3,8 @@ package dns
 import (
 	"context"
 	"fmt"
-	"path/filepath"
+	"net"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -14,22 +15,45 @@ import (
 	"github.com/miekg/dns"
 )
 
+// upstreamTimeout bounds a single forwarded query, including TCP/HTTPS retries.
+const upstreamTimeout = 5 * time.Second
+
 // Server implements the core.Engine interface for DNS handling.
 type Server struct {
 	cfg        *config.Config
 	blocklists core.BlocklistManager
 	
 	udpServer *dns.Server
+	tcpServer *dns.Server
 	
-	upstreamClient *dns.Client
-	upstreamAddr   string
+	upstreams  *upstreamPool
+	forwarders map[string]*upstreamPool // Conditional forwarding, keyed by domain suffix
+	detector  func() ([]string, string, error) // Finds system resolvers for UpstreamAuto
+
+	cache *answerCache // nil when caching is disabled
+	local *localZone   // Index of cfg.LocalRecords and the linked hosts files
+	hosts map[string][]config.LocalRecord // Records of linked hosts files, by path
+
+	clients   *clientTable                          // Index of cfg.ClientGroups
+	neighbors func(net.IP) (net.HardwareAddr, bool) // Resolves client MACs, nil if unsupported
+	acl       *clientACL
+	limiter   *rateLimiter // nil when rate limiting is disabled
+	sinks     []core.QuerySink
 	
-	statsQueries uint64
-	statsBlocked uint64
+	statsQueries   uint64
+	statsBlocked   uint64
+	statsRefused   uint64
+	statsThrottled uint64
+
+	queryLatency    latencyRecorder // End to end
+	upstreamLatency latencyRecorder // Upstream exchanges
+	top             topCounters     // Top domains and clients
 	
-	logFunc func(string) // Optional logger callback
+	logFunc  func(string) // Optional logger callback
+	observer func(upstream string, rtt time.Duration, ok bool) // Optional upstream exchange callback
 	
-	mu sync.RWMutex
+	mu       sync.RWMutex
+	reloadMu sync.Mutex // Serializes reloads and forward rule changes
 	
 	Ready chan struct{} // Closed when server is listening
 }
@@ -41,132 +65,283 @@ func (s *Server) SetLogger(fn func(string)) {
 	s.logFunc = fn
 }
 
+func (s *Server) log(msg string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.logFunc != nil {
+		s.logFunc(msg)
+	}
+}
+
+// SetUpstreamDetector sets how the "auto" upstream strategy finds the
+// system's original resolvers (see core.DNSConfigurator.DetectUpstreams).
+func (s *Server) SetUpstreamDetector(fn func() ([]string, string, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.detector = fn
+}
+
+// SetNeighborLookup sets how client MAC addresses are resolved for client
+// groups listing MACs (usually the OS neighbor table).
+func (s *Server) SetNeighborLookup(fn func(net.IP) (net.HardwareAddr, bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.neighbors = fn
+}
+
+// SetExchangeObserver sets a callback receiving the round-trip time and
+// outcome of every upstream attempt, e.g. for metrics.
+func (s *Server) SetExchangeObserver(fn func(upstream string, rtt time.Duration, ok bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observer = fn
+}
+
+func (s *Server) observeExchange(upstream string, rtt time.Duration, ok bool) {
+	s.mu.RLock()
+	fn := s.observer
+	s.mu.RUnlock()
+	if fn != nil {
+		fn(upstream, rtt, ok)
+	}
+}
+
 // Stats returns atomic snapshots of counters.
-func (s *Server) Stats() (int, int) {
-	return int(atomic.LoadUint64(&s.statsQueries)), int(atomic.LoadUint64(&s.statsBlocked))
+func (s *Server) Stats() core.Stats {
+	st := core.Stats{
+		Queries:   int(atomic.LoadUint64(&s.statsQueries)),
+		Blocked:   int(atomic.LoadUint64(&s.statsBlocked)),
+		Refused:   int(atomic.LoadUint64(&s.statsRefused)),
+		Throttled: int(atomic.LoadUint64(&s.statsThrottled)),
+	}
+	s.mu.RLock()
+	cache := s.cache
+	s.mu.RUnlock()
+	if cache != nil {
+		st.CacheHits, st.CacheMisses, st.CacheEntries = cache.Stats()
+	}
+	return st
 }
 
 // NewServer creates a new DNS server instance.
 func NewServer(cfg *config.Config, bl core.BlocklistManager) *Server {
+	acl, _ := newClientACL(cfg) // Start reports invalid settings
+	limiter, _ := newRateLimiter(cfg)
 	return &Server{
 		cfg:        cfg,
 		blocklists: bl,
-		upstreamClient: &dns.Client{
-			Timeout: 2 * time.Second,
-			Net:     "udp",
-			SingleInflight: true,
-		},
-		upstreamAddr: "8.8.8.8:53", // Default, will be overriden by config
-		Ready:        make(chan struct{}),
+		cache: newAnswerCache(cfg.CacheSize, cfg.CacheMinTTL, cfg.CacheMaxTTL),
+		local: newLocalZone(cfg.LocalRecords),
+		clients: newClientTable(cfg.ClientGroups),
+		acl:     acl,
+		limiter: limiter,
+		Ready: make(chan struct{}),
 	}
 }
 
 // Start begins listening on the configured port.
+// Both a UDP and a TCP listener are started on the same address; Ready is
+// closed once both of them are accepting queries.
 func (s *Server) Start(ctx context.Context) error {
-	addr := fmt.Sprintf("%s:%d", s.cfg.BindIP, s.cfg.BindPort)
-	
-	s.udpServer = &dns.Server{
-		Addr: addr, 
-		Net: "udp",
-		NotifyStartedFunc: func() {
-			close(s.Ready)
-		},
+	addr := bindAddr(s.cfg)
+
+	if err := s.configureACL(); err != nil {
+		return err
 	}
-	s.udpServer.Handler = dns.HandlerFunc(s.handleRequest)
-	
+	if err := s.configureRateLimit(); err != nil {
+		return err
+	}
+
 	// Handle Upstream Configuration
-	s.configureUpstream()
+	if err := s.configureUpstream(); err != nil {
+		return err
+	}
+	if err := s.configureForwarders(); err != nil {
+		return err
+	}
+	s.loadLinkedHosts()
 
-	fmt.Printf("Starting DNS Server on %s (Upstream: %s)\n", addr, s.upstreamAddr)
+	// Bind before returning, so a busy port is reported
+	udp, tcp, err := s.listen(addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Starting DNS Server on %s (udp+tcp, Upstreams: %s, Policy: %s)\n", addr, s.upstreams, s.cfg.UpstreamPolicy)
+	s.serve(udp, tcp, func() { close(s.Ready) })
+	return nil
+}
 
-	// Run in goroutine to allow non-blocking start
-	go func() {
-		if err := s.udpServer.ListenAndServe(); err != nil {
-			fmt.Printf("Failed to start UDP server: %v\n", err)
-		}
-	}()
-	
+// configureUpstream builds the upstream pool based on config.
+func (s *Server) configureUpstream() error {
+	pool, err := s.buildUpstreams(s.cfg)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	old := s.upstreams
+	s.upstreams = pool
+	s.mu.Unlock()
+	retire(old)
 	return nil
 }
 
-// configureUpstream sets the upstream resolver based on config.
-func (s *Server) configureUpstream() {
-	switch s.cfg.Upstream {
+// buildUpstreams returns the upstream pool selected by cfg.
+func (s *Server) buildUpstreams(cfg *config.Config) (*upstreamPool, error) {
+	specs, serverName := upstreamSpecs(cfg)
+	source := string(cfg.Upstream)
+	if cfg.Upstream == config.UpstreamAuto {
+		specs, source = s.detectUpstreams()
+	}
+	opts := UpstreamOptions{
+		DoHMethod:     cfg.DoHMethod,
+		BootstrapDNS:  cfg.BootstrapDNS,
+		TLSServerName: serverName,
+		Log:           s.log,
+	}
+
+	ups := make([]Upstream, 0, len(specs))
+	for _, spec := range specs {
+		up, err := NewUpstream(spec, opts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream: %w", err)
+		}
+		ups = append(ups, up)
+	}
+	if len(ups) == 0 {
+		return nil, errNoUpstreams
+	}
+
+	pool := newUpstreamPool(cfg.UpstreamPolicy, ups, s.log)
+	pool.source = source
+	pool.observe = s.observeExchange
+	return pool, nil
+}
+
+// upstreamSpecs returns the upstreams selected by the strategy, primary first,
+// and the certificate name to verify for DoT presets.
+func upstreamSpecs(cfg *config.Config) ([]string, string) {
+	switch cfg.Upstream {
 	case config.UpstreamCloudflare:
-		s.upstreamAddr = "1.1.1.1:53"
-	case config.UpstreamGoogle:
-		s.upstreamAddr = "8.8.8.8:53"
+		return []string{"1.1.1.1:53", "1.0.0.1:53"}, ""
+	case config.UpstreamCloudflareDoH:
+		return []string{"https://1.1.1.1/dns-query", "https://1.0.0.1/dns-query"}, ""
+	case config.UpstreamGoogleDoH:
+		return []string{"https://8.8.8.8/dns-query", "https://8.8.4.4/dns-query"}, ""
+	case config.UpstreamCloudflareDoT:
+		return []string{"tls://1.1.1.1:853", "tls://1.0.0.1:853"}, "cloudflare-dns.com"
+	case config.UpstreamGoogleDoT:
+		return []string{"tls://8.8.8.8:853", "tls://8.8.4.4:853"}, "dns.google"
+	case config.UpstreamQuad9DoT:
+		return []string{"tls://9.9.9.9:853", "tls://149.112.112.112:853"}, "dns.quad9.net"
 	case config.UpstreamCustom:
-		s.upstreamAddr = s.cfg.CustomUpstream
-	case config.UpstreamAuto:
-		// TODO: Implement autodetection from /etc/resolv.conf
-		s.upstreamAddr = "8.8.8.8:53" 
+		var specs []string
+		if cfg.CustomUpstream != "" {
+			specs = append(specs, cfg.CustomUpstream)
+		}
+		return append(specs, cfg.CustomUpstreams...), cfg.TLSServerName
 	}
+	// UpstreamGoogle, and the fallback when UpstreamAuto detects nothing
+	return []string{"8.8.8.8:53", "8.8.4.4:53"}, ""
 }
 
-// Stop shuts down the server.
-func (s *Server) Stop() error {
-	if s.udpServer != nil {
-		return s.udpServer.Shutdown()
+// detectUpstreams runs the upstream detector for UpstreamAuto,
+// falling back to Google if it is unset or finds nothing.
+func (s *Server) detectUpstreams() ([]string, string) {
+	s.mu.RLock()
+	detect := s.detector
+	s.mu.RUnlock()
+
+	if detect != nil {
+		servers, from, err := detect()
+		if err == nil && len(servers) > 0 {
+			s.log(fmt.Sprintf("Auto-detected upstreams via %s: %s", from, strings.Join(servers, ", ")))
+			return servers, "auto: " + from
+		}
+		s.log(fmt.Sprintf("Upstream auto-detection failed: %v. Falling back to Google.", err))
 	}
-	return nil
+
+	fallback, _ := upstreamSpecs(&config.Config{Upstream: config.UpstreamGoogle})
+	return fallback, "auto: fallback"
 }
 
-// Reload re-reads configuration (stub).
-func (s *Server) Reload() error {
-	return nil
+// UpstreamStats returns per-upstream counters and health.
+func (s *Server) UpstreamStats() []core.UpstreamStats {
+	s.mu.RLock()
+	pool := s.upstreams
+	s.mu.RUnlock()
+	if pool == nil {
+		return nil
+	}
+	return append(pool.Stats(), s.forwarderStats()...)
+}
+
+// Stop shuts down both listeners.
+func (s *Server) Stop() error {
+	s.mu.RLock()
+	udp, tcp := s.udpServer, s.tcpServer
+	s.mu.RUnlock()
+	return shutdown(context.Background(), udp, tcp)
 }
 
 // handleRequest is the main DNS query entry point.
+// Every query produces a core.QueryEvent for the query sinks.
 func (s *Server) handleRequest(w dns.ResponseWriter, r *dns.Msg) {
+	ev := newEvent(w, r)
+	defer s.emit(ev)
+	w = &eventWriter{ResponseWriter: w, ev: ev}
+
+	if !s.admit(w, r) {
+		ev.Status = core.StatusRefused
+		return
+	}
+	if !s.throttle(w, r) {
+		ev.Status = core.StatusThrottled
+		return
+	}
+
 	m := new(dns.Msg)
 	m.SetReply(r)
 	m.Compress = true
 	m.Authoritative = true
 
+	group := s.clientGroup(w.RemoteAddr())
+	ev.Group = group.Name
+
 	// We only handle standard queries (OpcodeQuery)
 	if r.Opcode != dns.OpcodeQuery {
-		s.forward(w, r)
+		s.forward(w, r, group, ev)
 		return
 	}
 	
 	atomic.AddUint64(&s.statsQueries, 1)
 
 	for _, q := range r.Question {
-		name := q.Name
-		lookupName := name
-		if len(name) > 0 && name[len(name)-1] == '.' {
-			lookupName = name[:len(name)-1]
-		}
+		lookupName := normalizeDomain(q.Name)
 
 		s.mu.RLock()
-		if s.cfg.LocalRecords != nil {
-			if ip, ok := s.cfg.LocalRecords[lookupName]; ok {
-				s.mu.RUnlock() // Unlock before responding/logging which might re-lock or take time
-				
-				atomic.AddUint64(&s.statsQueries, 1)
-				
-				s.mu.RLock() // Relock for logging check
-				if s.logFunc != nil {
-					s.logFunc(fmt.Sprintf("[LOCAL] %s -> %s", lookupName, ip))
-				}
-				s.mu.RUnlock()
-				s.respondA(w, r, ip)
-				return
-			}
-		}
+		zone := s.local
 		s.mu.RUnlock()
+		if resp, ok := s.answerLocal(r, q, zone); ok {
+			s.log(fmt.Sprintf("[LOCAL] %s %s", lookupName, dns.TypeToString[q.Qtype]))
+			ev.Status = core.StatusLocal
+			s.writeResponse(w, r, resp)
+			return
+		}
 
-		if s.blocklists != nil && s.blocklists.IsBlocked(lookupName) {
+		if s.blocklists == nil {
+			continue
+		}
+		if src, blocked := s.blocklists.MatchGroup(lookupName, group.Name); blocked {
 			atomic.AddUint64(&s.statsBlocked, 1)
 			
 			s.mu.RLock()
 			if s.logFunc != nil {
-				s.logFunc(fmt.Sprintf("[BLOCKED] %s", lookupName))
+				s.logFunc(fmt.Sprintf("[BLOCKED] %s (%s)", lookupName, src.Name))
 			}
 			s.mu.RUnlock()
 			
-			s.sinkhole(w, r)
+			ev.Status, ev.Rule = core.StatusBlocked, src.Name
+			s.sinkhole(w, r, src, group)
 			return
 		}
 		
@@ -178,107 +353,86 @@ func (s *Server) handleRequest(w dns.ResponseWriter, r *dns.Msg) {
 		s.mu.RUnlock()
 	}
 
-	s.forward(w, r)
-}
-
-// sinkhole responds with 0.0.0.0 (A) or :: (AAAA).
-func (s *Server) sinkhole(w dns.ResponseWriter, r *dns.Msg) {
-	m := new(dns.Msg)
-	m.SetReply(r)
-	
-	// Create NXDOMAIN or 0.0.0.0 response
-	// Adblockers usually prefer 0.0.0.0 for speed, some use NXDOMAIN.
-	// We'll use 0.0.0.0 A Record.
-	
-	for _, q := range r.Question {
-		switch q.Qtype {
-		case dns.TypeA:
-			rr, _ := dns.NewRR(fmt.Sprintf("%s 3600 IN A 0.0.0.0", q.Name))
-			m.Answer = append(m.Answer, rr)
-		case dns.TypeAAAA:
-			rr, _ := dns.NewRR(fmt.Sprintf("%s 3600 IN AAAA ::", q.Name))
-			m.Answer = append(m.Answer, rr)
-		}
-	}
-
-	w.WriteMsg(m)
+	s.forward(w, r, group, ev)
 }
 
 // forward sends the query to the upstream resolver.
-func (s *Server) forward(w dns.ResponseWriter, r *dns.Msg) {
-	resp, _, err := s.upstreamClient.Exchange(r, s.upstreamAddr)
+// The answer is truncated if it does not fit the client's UDP buffer.
+func (s *Server) forward(w dns.ResponseWriter, r *dns.Msg, group config.ClientGroup, ev *core.QueryEvent) {
+	resp, err := s.resolve(r, ev)
 	if err != nil {
 		// On error, return SERVFAIL
+		ev.Status = core.StatusError
 		m := new(dns.Msg)
 		m.SetReply(r)
 		m.Rcode = dns.RcodeServerFailure
 		w.WriteMsg(m)
 		return
 	}
-	
-	w.WriteMsg(resp)
-}
 
-// respondA sends a specific A record response.
-func (s *Server) respondA(w dns.ResponseWriter, r *dns.Msg, ip string) {
-	m := new(dns.Msg)
-	m.SetReply(r)
-
-	for _, q := range r.Question {
-		if q.Qtype == dns.TypeA {
-			rr, err := dns.NewRR(fmt.Sprintf("%s 3600 IN A %s", q.Name, ip))
-			if err == nil {
-				m.Answer = append(m.Answer, rr)
-			}
-		}
+	if r.Opcode == dns.OpcodeQuery && len(r.Question) > 0 && s.screen(w, r, resp, group, ev) {
+		return
 	}
-	w.WriteMsg(m)
+	s.writeResponse(w, r, resp)
 }
 
-// --- Local Records Implementation ---
+// screen checks an upstream answer against the answer-based protections:
+// CNAME cloaking, IP blocklists and DNS rebinding. It returns true if it
+// already answered the client; otherwise resp may have been filtered.
+// The blocklists checks apply the policy of the client's group.
+func (s *Server) screen(w dns.ResponseWriter, r, resp *dns.Msg, group config.ClientGroup, ev *core.QueryEvent) bool {
+	name := normalizeDomain(r.Question[0].Name)
 
-func (s *Server) AddLocalRecord(domain, ip string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if s.cfg.LocalRecords == nil {
-		s.cfg.LocalRecords = make(map[string]string)
+	if hop, src, blocked := s.cloakedBy(resp, group.Name); blocked {
+		atomic.AddUint64(&s.statsBlocked, 1)
+		s.log(fmt.Sprintf("[BLOCKED] %s (%s, via CNAME %s)", name, src.Name, hop))
+		ev.Status, ev.Rule = core.StatusBlocked, fmt.Sprintf("%s, via CNAME %s", src.Name, hop)
+		s.sinkhole(w, r, src, group)
+		return true
+	}
+	if ip, src, blocked := s.blockedAddress(resp, group.Name); blocked {
+		atomic.AddUint64(&s.statsBlocked, 1)
+		s.log(fmt.Sprintf("[BLOCKED] %s (%s, resolves to %s)", name, src.Name, ip))
+		ev.Status, ev.Rule = core.StatusBlocked, fmt.Sprintf("%s, resolves to %s", src.Name, ip)
+		s.sinkhole(w, r, src, group)
+		return true
 	}
 
-	// Basic Validation
-	domain = s.normalizeDomain(domain)
-	s.cfg.LocalRecords[domain] = ip
-	return config.Save(s.cfg, filepath.Join(s.cfg.ConfigDir, "config.yaml"))
-}
-
-func (s *Server) RemoveLocalRecord(domain string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	
-	if s.cfg.LocalRecords == nil {
-		return nil
+	s.mu.RLock()
+	guard := s.cfg.RebindProtection
+	s.mu.RUnlock()
+	if !guard || s.rebindExempt(name, group.Name) {
+		return false
 	}
-	
-	domain = s.normalizeDomain(domain)
-	delete(s.cfg.LocalRecords, domain)
-	return config.Save(s.cfg, filepath.Join(s.cfg.ConfigDir, "config.yaml"))
+	ip, refuse := s.guardRebinding(resp)
+	switch {
+	case ip == nil:
+		return false
+	case refuse:
+		s.log(fmt.Sprintf("[REBIND] %s resolves to %s, refused", name, ip))
+		ev.Status, ev.Rule = core.StatusRebind, fmt.Sprintf("resolves to %s", ip)
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		w.WriteMsg(m)
+		return true
+	}
+	s.log(fmt.Sprintf("[REBIND] %s resolves to %s, address removed", name, ip))
+	ev.Rule = fmt.Sprintf("rebind: %s removed", ip)
+	return false
 }
 
-func (s *Server) ListLocalRecords() map[string]string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	
-	// Copy
-	dst := make(map[string]string)
-	for k, v := range s.cfg.LocalRecords {
-		dst[k] = v
+// writeResponse sends resp, truncating it to the client's UDP buffer if needed.
+func (s *Server) writeResponse(w dns.ResponseWriter, r, resp *dns.Msg) {
+	if _, isUDP := w.RemoteAddr().(*net.UDPAddr); isUDP {
+		resp.Truncate(udpSize(r))
 	}
-	return dst
+	w.WriteMsg(resp)
 }
 
-func (s *Server) normalizeDomain(d string) string {
-	if len(d) > 0 && d[len(d)-1] == '.' {
-		return d[:len(d)-1]
+// udpSize returns the largest UDP response the client advertised it can take.
+func udpSize(r *dns.Msg) int {
+	if opt := r.IsEdns0(); opt != nil && opt.UDPSize() > dns.MinMsgSize {
+		return int(opt.UDPSize())
 	}
-	return d
+	return dns.MinMsgSize
 }
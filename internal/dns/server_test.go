@@ -69,3 +69,100 @@ func TestServer_Blocking(t *testing.T) {
 		}
 	}
 }
+
+// startUpstream runs a fake resolver on a random local port, serving both
+// UDP and TCP with the given handler. It returns the "IP:Port" address.
+func startUpstream(t *testing.T, handler dns.HandlerFunc) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen udp: %v", err)
+	}
+	addr := pc.LocalAddr().String()
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		pc.Close()
+		t.Fatalf("Failed to listen tcp: %v", err)
+	}
+
+	udp := &dns.Server{PacketConn: pc, Handler: handler}
+	tcp := &dns.Server{Listener: ln, Handler: handler}
+	go udp.ActivateAndServe()
+	go tcp.ActivateAndServe()
+	t.Cleanup(func() {
+		udp.Shutdown()
+		tcp.Shutdown()
+	})
+	return addr
+}
+
+func TestServer_TCPListener(t *testing.T) {
+	cfg := config.Default()
+	cfg.BindIP = "127.0.0.1"
+	cfg.BindPort = 5355
+
+	bl := blocklist.NewMockManager()
+	bl.Add("example.com")
+
+	srv := NewServer(cfg, bl)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer srv.Stop()
+
+	select {
+	case <-srv.Ready:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Server did not become ready")
+	}
+
+	c := &dns.Client{Net: "tcp", Timeout: time.Second}
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	r, _, err := c.Exchange(m, "127.0.0.1:5355")
+	if err != nil {
+		t.Fatalf("TCP exchange failed: %v", err)
+	}
+	if len(r.Answer) != 1 {
+		t.Fatalf("Expected 1 answer over TCP, got %d", len(r.Answer))
+	}
+}
+
+func TestServer_TruncatedFallsBackToTCP(t *testing.T) {
+	upstream := startUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if _, isUDP := w.RemoteAddr().(*net.UDPAddr); isUDP {
+			m.Truncated = true
+		} else {
+			rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN TXT \"full answer\"")
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})
+
+	cfg := config.Default()
+	cfg.BindIP = "127.0.0.1"
+	cfg.BindPort = 5356
+	cfg.Upstream = config.UpstreamCustom
+	cfg.CustomUpstream = upstream
+
+	srv := NewServer(cfg, blocklist.NewMockManager())
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer srv.Stop()
+	<-srv.Ready
+
+	c := &dns.Client{Timeout: time.Second}
+	m := new(dns.Msg)
+	m.SetQuestion("big.example.", dns.TypeTXT)
+	r, _, err := c.Exchange(m, "127.0.0.1:5356")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if r.Truncated || len(r.Answer) != 1 {
+		t.Fatalf("Expected full answer from TCP retry, got tc=%v answers=%d", r.Truncated, len(r.Answer))
+	}
+}
@@ -0,0 +1,214 @@
+package dns
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+
+	"0x53/internal/core"
+)
+
+const (
+	topCapacity = 100 // Keys tracked per tracker and slot
+
+	// Trackers keep topSlots slots of topSlotSpan: the window goes up to a day.
+	topSlots    = 144
+	topSlotSpan = 10 * time.Minute
+
+	defaultTopN = 10
+)
+
+// spaceSaving counts the most frequent keys of a stream in bounded memory
+// (the Space-Saving algorithm): once full, a new key evicts the least
+// counted one and inherits its count, recording it as the error.
+type spaceSaving struct {
+	items map[string]*topItem
+	heap  topHeap
+}
+
+type topItem struct {
+	key   string
+	count uint64
+	err   uint64 // count overestimates the real count by at most err
+	index int    // Position in the heap
+}
+
+// topHeap is a min-heap of items by count.
+type topHeap []*topItem
+
+func (h topHeap) Len() int           { return len(h) }
+func (h topHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h topHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *topHeap) Push(x any) {
+	it := x.(*topItem)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+func (h *topHeap) Pop() any {
+	old := *h
+	it := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return it
+}
+
+func newSpaceSaving() *spaceSaving {
+	return &spaceSaving{items: make(map[string]*topItem, topCapacity)}
+}
+
+func (s *spaceSaving) add(key string) {
+	if it, ok := s.items[key]; ok {
+		it.count++
+		heap.Fix(&s.heap, it.index)
+		return
+	}
+	if len(s.heap) < topCapacity {
+		it := &topItem{key: key, count: 1}
+		s.items[key] = it
+		heap.Push(&s.heap, it)
+		return
+	}
+	it := s.heap[0]
+	delete(s.items, it.key)
+	it.key, it.err = key, it.count
+	it.count++
+	s.items[key] = it
+	heap.Fix(&s.heap, 0)
+}
+
+// min returns the count a key missing from s may have reached.
+func (s *spaceSaving) min() uint64 {
+	if len(s.heap) < topCapacity {
+		return 0 // Nothing was ever evicted
+	}
+	return s.heap[0].count
+}
+
+func (s *spaceSaving) reset() {
+	clear(s.items)
+	s.heap = s.heap[:0]
+}
+
+// rollingTop is a spaceSaving per time slot, merged over a window.
+type rollingTop struct {
+	slots  [topSlots]*spaceSaving // Allocated on first use
+	epochs [topSlots]int64        // Slot number each slot currently holds
+}
+
+func (r *rollingTop) add(key string, epoch int64) {
+	i := epoch % topSlots
+	sl := r.slots[i]
+	switch {
+	case sl == nil:
+		sl = newSpaceSaving()
+		r.slots[i] = sl
+	case r.epochs[i] != epoch:
+		sl.reset()
+	}
+	r.epochs[i] = epoch
+	sl.add(key)
+}
+
+// top merges the last slots slots up to epoch and returns the n most
+// counted keys, ranked by their tracked counts. A key missing from a slot
+// may still have been seen there up to the slot's minimum count, which only
+// widens its error: adding it to the count would let a key seen once
+// outrank frequent ones over a long window.
+func (r *rollingTop) top(epoch, slots int64, n int) []core.TopEntry {
+	type merged struct {
+		count, err, mins uint64
+	}
+	keys := make(map[string]*merged)
+	var mins uint64
+	for i, sl := range r.slots {
+		if sl == nil || epoch-r.epochs[i] >= slots || r.epochs[i] > epoch {
+			continue
+		}
+		floor := sl.min()
+		mins += floor
+		for _, it := range sl.heap {
+			m := keys[it.key]
+			if m == nil {
+				m = &merged{}
+				keys[it.key] = m
+			}
+			m.count += it.count
+			m.err += it.err
+			m.mins += floor
+		}
+	}
+
+	entries := make([]core.TopEntry, 0, len(keys))
+	for key, m := range keys {
+		missed := mins - m.mins
+		entries = append(entries, core.TopEntry{Key: key, Count: int(m.count), Error: int(m.err + missed)})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// topCounters tracks the top domains and clients of the served queries.
+type topCounters struct {
+	mu             sync.Mutex
+	domains        rollingTop
+	blocked        rollingTop
+	clients        rollingTop
+	blockedClients rollingTop
+}
+
+func (t *topCounters) record(ev *core.QueryEvent) {
+	epoch := ev.Time.UnixNano() / int64(topSlotSpan)
+	blocked := ev.Status == core.StatusBlocked
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ev.Domain != "" {
+		t.domains.add(ev.Domain, epoch)
+		if blocked {
+			t.blocked.add(ev.Domain, epoch)
+		}
+	}
+	if ev.Client != "" {
+		t.clients.add(ev.Client, epoch)
+		if blocked {
+			t.blockedClients.add(ev.Client, epoch)
+		}
+	}
+}
+
+// snapshot returns the n top keys of every tracker over window.
+func (t *topCounters) snapshot(window time.Duration, n int, now time.Time) core.TopStats {
+	if n <= 0 {
+		n = defaultTopN
+	}
+	slots := int64((window + topSlotSpan - 1) / topSlotSpan)
+	slots = max(1, min(slots, topSlots))
+	epoch := now.UnixNano() / int64(topSlotSpan)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return core.TopStats{
+		Window:         time.Duration(slots) * topSlotSpan,
+		Domains:        t.domains.top(epoch, slots, n),
+		Blocked:        t.blocked.top(epoch, slots, n),
+		Clients:        t.clients.top(epoch, slots, n),
+		BlockedClients: t.blockedClients.top(epoch, slots, n),
+	}
+}
+
+// TopStats returns the most queried and blocked domains and the busiest
+// clients over window.
+func (s *Server) TopStats(window time.Duration, n int) core.TopStats {
+	return s.top.snapshot(window, n, time.Now())
+}
@@ -0,0 +1,115 @@
+package dns
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"0x53/internal/core"
+)
+
+func TestSpaceSaving(t *testing.T) {
+	s := newSpaceSaving()
+	// Ten heavy hitters among many more one-off keys than the capacity
+	for i := 0; i < 5000; i++ {
+		s.add(fmt.Sprintf("heavy%d", i%10))
+		s.add(fmt.Sprintf("rare%d", i))
+	}
+	if len(s.heap) != topCapacity || len(s.items) != topCapacity {
+		t.Fatalf("Expected %d tracked keys, got %d", topCapacity, len(s.heap))
+	}
+
+	var r rollingTop
+	r.slots[0], r.epochs[0] = s, 0
+	top := r.top(0, 1, 10)
+	for _, e := range top {
+		if e.Count-e.Error > 500 || e.Count < 500 {
+			t.Errorf("%s: count %d error %d does not bound the real count 500", e.Key, e.Count, e.Error)
+		}
+		if e.Key[:5] != "heavy" {
+			t.Errorf("Unexpected top key %s", e.Key)
+		}
+	}
+	if len(top) != 10 {
+		t.Errorf("Expected 10 entries, got %d", len(top))
+	}
+}
+
+func TestRollingTop_RareKey(t *testing.T) {
+	var r rollingTop
+	// Slot 0 sees a key once; every other slot is full, so keys missing
+	// from them may have been seen up to 5 times each
+	r.add("rare.example", 0)
+	for epoch := int64(0); epoch < topSlots; epoch++ {
+		for i := 0; i < 6; i++ {
+			r.add("heavy.example", epoch)
+		}
+		if epoch == 0 {
+			continue
+		}
+		for i := 0; i < topCapacity-1; i++ {
+			for j := 0; j < 5; j++ {
+				r.add(fmt.Sprintf("filler%d-%d", epoch, i), epoch)
+			}
+		}
+	}
+
+	top := r.top(topSlots-1, topSlots, 3)
+	if top[0] != (core.TopEntry{Key: "heavy.example", Count: 6 * topSlots}) {
+		t.Errorf("Expected heavy.example on top with an exact count, got %+v", top[0])
+	}
+	for _, e := range top {
+		if e.Key == "rare.example" {
+			t.Errorf("A key seen once outranks frequent ones: %+v", top)
+		}
+	}
+	for _, e := range r.top(topSlots-1, topSlots, 1<<20) {
+		if e.Key == "rare.example" && (e.Count != 1 || e.Error < 5*(topSlots-1)) {
+			t.Errorf("Expected rare.example counted once with the floors as error, got %+v", e)
+		}
+	}
+}
+
+func TestTopCounters(t *testing.T) {
+	var top topCounters
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	record := func(at time.Time, client, domain string, status core.QueryStatus, times int) {
+		for i := 0; i < times; i++ {
+			top.record(&core.QueryEvent{Time: at, Client: client, Domain: domain, Status: status})
+		}
+	}
+	record(now.Add(-2*time.Hour), "10.0.0.9", "old.example", core.StatusAllowed, 50)
+	record(now, "10.0.0.1", "a.example", core.StatusAllowed, 5)
+	record(now, "10.0.0.2", "ads.example", core.StatusBlocked, 3)
+	record(now.Add(-30*time.Minute), "10.0.0.2", "a.example", core.StatusAllowed, 2)
+
+	st := top.snapshot(time.Hour, 5, now)
+	if st.Window != time.Hour {
+		t.Errorf("Expected a 1h window, got %s", st.Window)
+	}
+	want := []core.TopEntry{{Key: "a.example", Count: 7}, {Key: "ads.example", Count: 3}}
+	if fmt.Sprint(st.Domains) != fmt.Sprint(want) {
+		t.Errorf("Domains = %v, want %v", st.Domains, want)
+	}
+	if len(st.Blocked) != 1 || st.Blocked[0].Key != "ads.example" {
+		t.Errorf("Unexpected blocked domains %v", st.Blocked)
+	}
+	if len(st.Clients) != 2 || st.Clients[0] != (core.TopEntry{Key: "10.0.0.1", Count: 5}) {
+		t.Errorf("Unexpected clients %v", st.Clients)
+	}
+	if len(st.BlockedClients) != 1 || st.BlockedClients[0].Count != 3 {
+		t.Errorf("Unexpected blocked clients %v", st.BlockedClients)
+	}
+
+	// Older slots are only merged into longer windows
+	st = top.snapshot(24*time.Hour, 1, now)
+	if len(st.Domains) != 1 || st.Domains[0].Key != "old.example" {
+		t.Errorf("Expected old.example on top of the day, got %v", st.Domains)
+	}
+	// A day later the slot of "now" is recycled
+	record(now.Add(24*time.Hour), "10.0.0.1", "b.example", core.StatusAllowed, 1)
+	st = top.snapshot(10*time.Minute, 5, now.Add(24*time.Hour))
+	if len(st.Domains) != 1 || st.Domains[0].Key != "b.example" {
+		t.Errorf("Expected the recycled slot to hold b.example only, got %v", st.Domains)
+	}
+}
@@ -0,0 +1,111 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Upstream is a resolver that queries can be forwarded to.
+type Upstream interface {
+	// Exchange sends r and waits for the answer.
+	Exchange(ctx context.Context, r *dns.Msg) (*dns.Msg, error)
+	// String returns the address used in logs and stats.
+	String() string
+}
+
+// UpstreamOptions tunes how upstream specs are turned into resolvers.
+type UpstreamOptions struct {
+	DoHMethod     string       // "get" or "post"
+	BootstrapDNS  string       // Plain "IP:Port" resolver used to look up DoH/DoT hostnames
+	TLSServerName string       // Certificate name to verify for DoT, defaults to the host
+	Log           func(string) // Receives connection/handshake failures
+}
+
+// NewUpstream parses an upstream spec:
+//   - "IP" or "IP:Port" for plain DNS over UDP (with TCP fallback)
+//   - "https://host/dns-query" for DNS-over-HTTPS (RFC 8484)
+//   - "tls://host" or "tls://host:853" for DNS-over-TLS (RFC 7858)
+func NewUpstream(spec string, opts UpstreamOptions) (Upstream, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == "":
+		return nil, fmt.Errorf("empty upstream")
+	case strings.HasPrefix(spec, "https://"):
+		return newDoHUpstream(spec, opts)
+	case strings.HasPrefix(spec, "tls://"):
+		return newDoTUpstream(withDefaultPort(strings.TrimPrefix(spec, "tls://"), "853"), opts)
+	case strings.Contains(spec, "://"):
+		return nil, fmt.Errorf("unsupported upstream scheme: %s", spec)
+	}
+	return newPlainUpstream(withDefaultPort(spec, "53"))
+}
+
+// withDefaultPort appends port to addr unless it already has one.
+func withDefaultPort(addr, port string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(strings.Trim(addr, "[]"), port)
+}
+
+// bootstrapDialer returns a dialer whose hostname lookups go to the bootstrap
+// resolver instead of the system one, which is usually ourselves.
+func bootstrapDialer(bootstrap string) *net.Dialer {
+	d := &net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}
+	if bootstrap == "" {
+		return d
+	}
+	bootstrap = withDefaultPort(bootstrap, "53")
+	d.Resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var bd net.Dialer
+			return bd.DialContext(ctx, network, bootstrap)
+		},
+	}
+	return d
+}
+
+// --- Plain DNS ---
+
+// plainUpstream forwards over UDP and retries over TCP on truncation.
+type plainUpstream struct {
+	addr string
+	udp  *dns.Client
+	tcp  *dns.Client
+}
+
+func newPlainUpstream(addr string) (*plainUpstream, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid upstream %q: %w", addr, err)
+	}
+	return &plainUpstream{
+		addr: addr,
+		udp: &dns.Client{
+			Timeout:        2 * time.Second,
+			Net:            "udp",
+			SingleInflight: true,
+		},
+		tcp: &dns.Client{
+			Timeout: 4 * time.Second,
+			Net:     "tcp",
+		},
+	}, nil
+}
+
+func (u *plainUpstream) Exchange(ctx context.Context, r *dns.Msg) (*dns.Msg, error) {
+	resp, _, err := u.udp.ExchangeContext(ctx, r, u.addr)
+	if err == nil && resp.Truncated {
+		resp, _, err = u.tcp.ExchangeContext(ctx, r, u.addr)
+	}
+	return resp, err
+}
+
+func (u *plainUpstream) String() string {
+	return u.addr
+}
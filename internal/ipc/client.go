@@ -2,6 +2,7 @@ package ipc
 
 import (
 	"net/rpc"
+	"time"
 
 	"0x53/internal/config"
 	"0x53/internal/core"
@@ -27,10 +28,34 @@ func (c *Client) Close() error {
 
 // --- Service Implementation ---
 
-func (c *Client) GetStats() (int, int, int, error) {
-	var reply StatsReply
+func (c *Client) GetStats() (core.Stats, error) {
+	var reply core.Stats
 	err := c.client.Call("Sinkhole.GetStats", &Void{}, &reply)
-	return reply.QueriesTotal, reply.QueriesBlocked, reply.ActiveRules, err
+	return reply, err
+}
+
+func (c *Client) GetUpstreamStats() ([]core.UpstreamStats, error) {
+	var reply []core.UpstreamStats
+	err := c.client.Call("Sinkhole.GetUpstreamStats", &Void{}, &reply)
+	return reply, err
+}
+
+func (c *Client) GetLatencyStats() (core.LatencyStats, error) {
+	var reply core.LatencyStats
+	err := c.client.Call("Sinkhole.GetLatencyStats", &Void{}, &reply)
+	return reply, err
+}
+
+func (c *Client) GetStatsSeries(from, to time.Time, step time.Duration) (core.StatsSeries, error) {
+	var reply core.StatsSeries
+	err := c.client.Call("Sinkhole.GetStatsSeries", &SeriesArgs{From: from, To: to, Step: step}, &reply)
+	return reply, err
+}
+
+func (c *Client) GetTopStats(window time.Duration, n int) (core.TopStats, error) {
+	var reply core.TopStats
+	err := c.client.Call("Sinkhole.GetTopStats", &TopArgs{Window: window, N: n}, &reply)
+	return reply, err
 }
 
 func (c *Client) ListSources() ([]config.BlocklistSource, error) {
@@ -44,8 +69,10 @@ func (c *Client) ToggleSource(name string, enabled bool) error {
 	return c.client.Call("Sinkhole.ToggleSource", &args, &Void{})
 }
 
-func (c *Client) Reload() error {
-	return c.client.Call("Sinkhole.Reload", &Void{}, &Void{})
+func (c *Client) Reload() (core.ReloadResult, error) {
+	var reply core.ReloadResult
+	err := c.client.Call("Sinkhole.Reload", &Void{}, &reply)
+	return reply, err
 }
 
 func (c *Client) GetRecentLogs(count int) ([]string, error) {
@@ -55,6 +82,18 @@ func (c *Client) GetRecentLogs(count int) ([]string, error) {
 	return reply.Lines, err
 }
 
+func (c *Client) GetQueryEvents(filter core.QueryFilter) ([]core.QueryEvent, error) {
+	var reply []core.QueryEvent
+	err := c.client.Call("Sinkhole.GetQueryEvents", &QueryEventsArgs{Filter: filter}, &reply)
+	return reply, err
+}
+
+func (c *Client) QueryHistory(q core.HistoryQuery) (core.HistoryPage, error) {
+	var reply core.HistoryPage
+	err := c.client.Call("Sinkhole.QueryHistory", &HistoryArgs{Query: q}, &reply)
+	return reply, err
+}
+
 func (c *Client) AddAllowed(domain string) error {
 	args := AllowlistArgs{Domain: domain}
 	return c.client.Call("Sinkhole.AddAllowed", &args, &Void{})
@@ -71,22 +110,78 @@ func (c *Client) ListAllowed() ([]string, error) {
 	return reply, err
 }
 
+func (c *Client) AddBlocked(domain string) error {
+	args := AllowlistArgs{Domain: domain}
+	return c.client.Call("Sinkhole.AddBlocked", &args, &Void{})
+}
+
+func (c *Client) RemoveBlocked(domain string) error {
+	args := AllowlistArgs{Domain: domain}
+	return c.client.Call("Sinkhole.RemoveBlocked", &args, &Void{})
+}
+
+func (c *Client) ListBlocked() ([]string, error) {
+	var reply []string
+	err := c.client.Call("Sinkhole.ListBlocked", &Void{}, &reply)
+	return reply, err
+}
+
 // Local Records
-func (c *Client) AddLocalRecord(domain, ip string) error {
-	args := LocalRecordArgs{Domain: domain, IP: ip}
+func (c *Client) AddLocalRecord(rec config.LocalRecord) error {
+	args := LocalRecordArgs{Record: rec}
 	return c.client.Call("Sinkhole.AddLocalRecord", &args, &Void{})
 }
 
-func (c *Client) RemoveLocalRecord(domain string) error {
-	args := LocalRecordArgs{Domain: domain}
+func (c *Client) RemoveLocalRecord(rec config.LocalRecord) error {
+	args := LocalRecordArgs{Record: rec}
 	return c.client.Call("Sinkhole.RemoveLocalRecord", &args, &Void{})
 }
 
-func (c *Client) ListLocalRecords() (map[string]string, error) {
-	var reply map[string]string
+func (c *Client) ListLocalRecords() ([]config.LocalRecord, error) {
+	var reply []config.LocalRecord
 	err := c.client.Call("Sinkhole.ListLocalRecords", &Void{}, &reply)
 	return reply, err
 }
 
+func (c *Client) ImportHosts(opts core.HostsImportOptions) (core.HostsImportResult, error) {
+	args := HostsImportArgs{Options: opts}
+	var reply core.HostsImportResult
+	err := c.client.Call("Sinkhole.ImportHosts", &args, &reply)
+	return reply, err
+}
+
+// Conditional Forwarding
+func (c *Client) AddForwardRule(rule config.ForwardRule) error {
+	args := ForwardRuleArgs{Rule: rule}
+	return c.client.Call("Sinkhole.AddForwardRule", &args, &Void{})
+}
+
+func (c *Client) RemoveForwardRule(domain string) error {
+	args := ForwardRuleArgs{Rule: config.ForwardRule{Domain: domain}}
+	return c.client.Call("Sinkhole.RemoveForwardRule", &args, &Void{})
+}
+
+func (c *Client) ListForwardRules() ([]config.ForwardRule, error) {
+	var reply []config.ForwardRule
+	err := c.client.Call("Sinkhole.ListForwardRules", &Void{}, &reply)
+	return reply, err
+}
+
+func (c *Client) AddClientGroup(group config.ClientGroup) error {
+	args := ClientGroupArgs{Group: group}
+	return c.client.Call("Sinkhole.AddClientGroup", &args, &Void{})
+}
+
+func (c *Client) RemoveClientGroup(name string) error {
+	args := ClientGroupArgs{Group: config.ClientGroup{Name: name}}
+	return c.client.Call("Sinkhole.RemoveClientGroup", &args, &Void{})
+}
+
+func (c *Client) ListClientGroups() ([]config.ClientGroup, error) {
+	var reply []config.ClientGroup
+	err := c.client.Call("Sinkhole.ListClientGroups", &Void{}, &reply)
+	return reply, err
+}
+
 // Ensure interface compliance
 var _ core.Service = (*Client)(nil)
@@ -0,0 +1,72 @@
+package ipc
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"net/rpc"
+)
+
+// gobServerCodec is the wire format of net/rpc's ServeConn, reimplemented
+// so each request can be observed before it is dispatched.
+type gobServerCodec struct {
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	onCall func(method string) // Optional
+	closed bool
+}
+
+func newServerCodec(conn io.ReadWriteCloser, onCall func(string)) *gobServerCodec {
+	buf := bufio.NewWriter(conn)
+	return &gobServerCodec{
+		rwc:    conn,
+		dec:    gob.NewDecoder(conn),
+		enc:    gob.NewEncoder(buf),
+		encBuf: buf,
+		onCall: onCall,
+	}
+}
+
+func (c *gobServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	if err := c.dec.Decode(r); err != nil {
+		return err
+	}
+	if c.onCall != nil {
+		c.onCall(r.ServiceMethod)
+	}
+	return nil
+}
+
+func (c *gobServerCodec) ReadRequestBody(body any) error {
+	return c.dec.Decode(body)
+}
+
+func (c *gobServerCodec) WriteResponse(r *rpc.Response, body any) error {
+	if err := c.enc.Encode(r); err != nil {
+		if c.encBuf.Flush() == nil {
+			// Gob couldn't encode the header, should not happen
+			c.Close()
+		}
+		return err
+	}
+	if err := c.enc.Encode(body); err != nil {
+		if c.encBuf.Flush() == nil {
+			// Was a gob problem encoding the body but the header has been
+			// written: close the connection so the client doesn't hang
+			c.Close()
+		}
+		return err
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *gobServerCodec) Close() error {
+	if c.closed {
+		// Only call c.rwc.Close once; otherwise the semantics are undefined
+		return nil
+	}
+	c.closed = true
+	return c.rwc.Close()
+}
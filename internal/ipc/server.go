@@ -5,6 +5,7 @@ import (
 	"net"
 	"net/rpc"
 	"os"
+	"time"
 
 	"0x53/internal/config"
 	"0x53/internal/core"
@@ -14,12 +15,6 @@ import (
 
 type Void struct{}
 
-type StatsReply struct {
-	QueriesTotal   int
-	QueriesBlocked int
-	ActiveRules    int
-}
-
 type ToggleArgs struct {
 	Name    string
 	Enabled bool
@@ -33,9 +28,38 @@ type LogReply struct {
 	Lines []string
 }
 
+type QueryEventsArgs struct {
+	Filter core.QueryFilter
+}
+
+type HistoryArgs struct {
+	Query core.HistoryQuery
+}
+
+type SeriesArgs struct {
+	From, To time.Time
+	Step     time.Duration
+}
+
+type TopArgs struct {
+	Window time.Duration
+	N      int
+}
+
 type LocalRecordArgs struct {
-	Domain string
-	IP     string
+	Record config.LocalRecord
+}
+
+type HostsImportArgs struct {
+	Options core.HostsImportOptions
+}
+
+type ForwardRuleArgs struct {
+	Rule config.ForwardRule
+}
+
+type ClientGroupArgs struct {
+	Group config.ClientGroup
 }
 
 // --- RPC Server Adapter ---
@@ -45,11 +69,33 @@ type RPCServer struct {
 	svc core.Service
 }
 
-func (s *RPCServer) GetStats(args *Void, reply *StatsReply) error {
-	q, b, r, err := s.svc.GetStats()
-	reply.QueriesTotal = q
-	reply.QueriesBlocked = b
-	reply.ActiveRules = r
+func (s *RPCServer) GetStats(args *Void, reply *core.Stats) error {
+	st, err := s.svc.GetStats()
+	*reply = st
+	return err
+}
+
+func (s *RPCServer) GetUpstreamStats(args *Void, reply *[]core.UpstreamStats) error {
+	stats, err := s.svc.GetUpstreamStats()
+	*reply = stats
+	return err
+}
+
+func (s *RPCServer) GetLatencyStats(args *Void, reply *core.LatencyStats) error {
+	stats, err := s.svc.GetLatencyStats()
+	*reply = stats
+	return err
+}
+
+func (s *RPCServer) GetStatsSeries(args *SeriesArgs, reply *core.StatsSeries) error {
+	series, err := s.svc.GetStatsSeries(args.From, args.To, args.Step)
+	*reply = series
+	return err
+}
+
+func (s *RPCServer) GetTopStats(args *TopArgs, reply *core.TopStats) error {
+	stats, err := s.svc.GetTopStats(args.Window, args.N)
+	*reply = stats
 	return err
 }
 
@@ -63,8 +109,10 @@ func (s *RPCServer) ToggleSource(args *ToggleArgs, reply *Void) error {
 	return s.svc.ToggleSource(args.Name, args.Enabled)
 }
 
-func (s *RPCServer) Reload(args *Void, reply *Void) error {
-	return s.svc.Reload()
+func (s *RPCServer) Reload(args *Void, reply *core.ReloadResult) error {
+	res, err := s.svc.Reload()
+	*reply = res
+	return err
 }
 
 func (s *RPCServer) GetRecentLogs(args *LogArgs, reply *LogReply) error {
@@ -74,6 +122,18 @@ func (s *RPCServer) GetRecentLogs(args *LogArgs, reply *LogReply) error {
 	return err
 }
 
+func (s *RPCServer) GetQueryEvents(args *QueryEventsArgs, reply *[]core.QueryEvent) error {
+	events, err := s.svc.GetQueryEvents(args.Filter)
+	*reply = events
+	return err
+}
+
+func (s *RPCServer) QueryHistory(args *HistoryArgs, reply *core.HistoryPage) error {
+	page, err := s.svc.QueryHistory(args.Query)
+	*reply = page
+	return err
+}
+
 type AllowlistArgs struct {
 	Domain string
 }
@@ -92,24 +152,73 @@ func (s *RPCServer) ListAllowed(args *Void, reply *[]string) error {
 	return err
 }
 
+func (s *RPCServer) AddBlocked(args *AllowlistArgs, reply *Void) error {
+	return s.svc.AddBlocked(args.Domain)
+}
+
+func (s *RPCServer) RemoveBlocked(args *AllowlistArgs, reply *Void) error {
+	return s.svc.RemoveBlocked(args.Domain)
+}
+
+func (s *RPCServer) ListBlocked(args *Void, reply *[]string) error {
+	list, err := s.svc.ListBlocked()
+	*reply = list
+	return err
+}
+
 func (s *RPCServer) AddLocalRecord(args *LocalRecordArgs, reply *Void) error {
-	return s.svc.AddLocalRecord(args.Domain, args.IP)
+	return s.svc.AddLocalRecord(args.Record)
 }
 
 func (s *RPCServer) RemoveLocalRecord(args *LocalRecordArgs, reply *Void) error {
-	return s.svc.RemoveLocalRecord(args.Domain) // Use struct, ignore IP
+	return s.svc.RemoveLocalRecord(args.Record)
 }
 
-func (s *RPCServer) ListLocalRecords(args *Void, reply *map[string]string) error {
+func (s *RPCServer) ListLocalRecords(args *Void, reply *[]config.LocalRecord) error {
 	m, err := s.svc.ListLocalRecords()
 	*reply = m
 	return err
 }
 
+func (s *RPCServer) ImportHosts(args *HostsImportArgs, reply *core.HostsImportResult) error {
+	res, err := s.svc.ImportHosts(args.Options)
+	*reply = res
+	return err
+}
+
+func (s *RPCServer) AddForwardRule(args *ForwardRuleArgs, reply *Void) error {
+	return s.svc.AddForwardRule(args.Rule)
+}
+
+func (s *RPCServer) RemoveForwardRule(args *ForwardRuleArgs, reply *Void) error {
+	return s.svc.RemoveForwardRule(args.Rule.Domain) // Upstreams are ignored
+}
+
+func (s *RPCServer) ListForwardRules(args *Void, reply *[]config.ForwardRule) error {
+	rules, err := s.svc.ListForwardRules()
+	*reply = rules
+	return err
+}
+
+func (s *RPCServer) AddClientGroup(args *ClientGroupArgs, reply *Void) error {
+	return s.svc.AddClientGroup(args.Group)
+}
+
+func (s *RPCServer) RemoveClientGroup(args *ClientGroupArgs, reply *Void) error {
+	return s.svc.RemoveClientGroup(args.Group.Name)
+}
+
+func (s *RPCServer) ListClientGroups(args *Void, reply *[]config.ClientGroup) error {
+	groups, err := s.svc.ListClientGroups()
+	*reply = groups
+	return err
+}
+
 // StartServer starts the Unix Domain Socket listener.
 // It runs in a goroutine until context is cancelled or listener closed.
 // returns the listener so it can be closed on shutdown.
-func StartServer(svc core.Service, socketPath string) (net.Listener, error) {
+// onCall, if not nil, is called with the method name of every request.
+func StartServer(svc core.Service, socketPath string, onCall func(method string)) (net.Listener, error) {
 	rpcObj := &RPCServer{svc: svc}
 	server := rpc.NewServer()
 	if err := server.RegisterName("Sinkhole", rpcObj); err != nil {
@@ -139,7 +248,7 @@ func StartServer(svc core.Service, socketPath string) (net.Listener, error) {
 			if err != nil {
 				return
 			}
-			go server.ServeConn(conn)
+			go server.ServeCodec(newServerCodec(conn, onCall))
 		}
 	}()
 
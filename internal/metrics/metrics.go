@@ -0,0 +1,184 @@
+// Package metrics exposes the daemon's counters and histograms in the
+// Prometheus text exposition format, without the client library.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the latency histograms, in seconds:
+// cache and local answers fall in the first ones, upstreams in the middle.
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// counterVec is a counter per combination of label values.
+type counterVec struct {
+	name, help string
+	labels     []string
+	series     sync.Map // Joined label values -> *uint64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels}
+}
+
+// inc adds one to the series of values, given in label order.
+func (c *counterVec) inc(values ...string) {
+	key := strings.Join(values, "\xff")
+	v, ok := c.series.Load(key)
+	if !ok {
+		v, _ = c.series.LoadOrStore(key, new(uint64))
+	}
+	atomic.AddUint64(v.(*uint64), 1)
+}
+
+func (c *counterVec) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(&c.series) {
+		v, _ := c.series.Load(key)
+		fmt.Fprintf(w, "%s%s %d\n", c.name, labelString(c.labels, strings.Split(key, "\xff")), atomic.LoadUint64(v.(*uint64)))
+	}
+}
+
+// histogram counts observations into latencyBuckets. Observe is lock-free.
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative; the last one is +Inf
+	count  uint64
+	sum    uint64 // Nanoseconds
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(latencyBuckets)+1)}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := sort.SearchFloat64s(latencyBuckets, d.Seconds())
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddUint64(&h.sum, uint64(d))
+}
+
+// histogramVec is a histogram per combination of label values.
+type histogramVec struct {
+	name, help string
+	labels     []string
+	series     sync.Map // Joined label values -> *histogram
+}
+
+func newHistogramVec(name, help string, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels}
+}
+
+func (h *histogramVec) observe(d time.Duration, values ...string) {
+	key := strings.Join(values, "\xff")
+	v, ok := h.series.Load(key)
+	if !ok {
+		v, _ = h.series.LoadOrStore(key, newHistogram())
+	}
+	v.(*histogram).observe(d)
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, key := range sortedKeys(&h.series) {
+		v, _ := h.series.Load(key)
+		hist := v.(*histogram)
+		values := strings.Split(key, "\xff")
+		if len(h.labels) == 0 {
+			values = nil
+		}
+		// Bucket series carry an extra "le" label
+		names := append(h.labels[:len(h.labels):len(h.labels)], "le")
+		bucket := func(le string) string {
+			return labelString(names, append(values[:len(values):len(values)], le))
+		}
+
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += atomic.LoadUint64(&hist.counts[i])
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, bucket(formatFloat(bound)), cumulative)
+		}
+		count := atomic.LoadUint64(&hist.count)
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, bucket("+Inf"), count)
+		sum := time.Duration(atomic.LoadUint64(&hist.sum)).Seconds()
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelString(h.labels, values), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelString(h.labels, values), count)
+	}
+}
+
+// sample is one value of a metric collected at scrape time.
+type sample struct {
+	labels []string // Alternating names and values
+	value  float64
+}
+
+// writeSamples writes a metric whose values are read when scraped.
+func writeSamples(w io.Writer, name, help, typ string, samples []sample) {
+	writeHeader(w, name, help, typ)
+	for _, s := range samples {
+		var names, values []string
+		for i := 0; i+1 < len(s.labels); i += 2 {
+			names = append(names, s.labels[i])
+			values = append(values, s.labels[i+1])
+		}
+		fmt.Fprintf(w, "%s%s %s\n", name, labelString(names, values), formatFloat(s.value))
+	}
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// labelString formats {name="value",...}, empty without labels.
+func labelString(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys returns the series keys of m in order, for a stable output.
+func sortedKeys(m *sync.Map) []string {
+	var keys []string
+	m.Range(func(k, _ any) bool {
+		keys = append(keys, k.(string))
+		return true
+	})
+	sort.Strings(keys)
+	return keys
+}
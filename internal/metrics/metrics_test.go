@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"0x53/internal/core"
+)
+
+// fakeEngine and fakeLists provide the scrape-time metrics, other methods
+// of the embedded interfaces are not called.
+type fakeEngine struct{ core.Engine }
+
+func (fakeEngine) Stats() core.Stats {
+	return core.Stats{CacheHits: 7, CacheMisses: 3, CacheEntries: 5}
+}
+
+func (fakeEngine) UpstreamStats() []core.UpstreamStats {
+	return []core.UpstreamStats{{Address: "1.1.1.1:53", Healthy: true}, {Address: "tls://9.9.9.9:853"}}
+}
+
+type fakeLists struct{ core.BlocklistManager }
+
+func (fakeLists) SourceStats() []core.SourceStats {
+	return []core.SourceStats{{Name: `Steven "Black"`, Rules: 1200, FetchDuration: 1500 * time.Millisecond, Failures: 1}}
+}
+
+func TestRegistry_Exposition(t *testing.T) {
+	reg := New(fakeEngine{}, fakeLists{})
+	reg.Record(core.QueryEvent{Type: "A", Status: core.StatusBlocked, Group: "kids", Latency: 200 * time.Microsecond})
+	reg.Record(core.QueryEvent{Type: "A", Status: core.StatusBlocked, Group: "kids", Latency: 300 * time.Microsecond})
+	reg.Record(core.QueryEvent{Type: "AAAA", Status: core.StatusAllowed, Latency: 30 * time.Millisecond})
+	reg.ObserveExchange("1.1.1.1:53", 20*time.Millisecond, true)
+	reg.ObserveExchange("tls://9.9.9.9:853", 2*time.Second, false)
+	reg.CountIPC("Sinkhole.GetStats")
+	reg.CountIPC("Sinkhole.GetStats")
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	out := string(body)
+
+	want := []string{
+		"# TYPE sinkhole_queries_total counter",
+		`sinkhole_queries_total{type="A",status="blocked",group="kids"} 2`,
+		`sinkhole_queries_total{type="AAAA",status="allowed",group=""} 1`,
+		"# TYPE sinkhole_query_duration_seconds histogram",
+		`sinkhole_query_duration_seconds_bucket{status="blocked",le="0.0005"} 2`,
+		`sinkhole_query_duration_seconds_bucket{status="allowed",le="0.025"} 0`,
+		`sinkhole_query_duration_seconds_bucket{status="allowed",le="0.05"} 1`,
+		`sinkhole_query_duration_seconds_bucket{status="allowed",le="+Inf"} 1`,
+		`sinkhole_query_duration_seconds_sum{status="blocked"} 0.0005`,
+		`sinkhole_query_duration_seconds_count{status="blocked"} 2`,
+		"sinkhole_cache_hits_total 7",
+		"sinkhole_cache_entries 5",
+		`sinkhole_upstream_request_duration_seconds_count{upstream="1.1.1.1:53"} 1`,
+		`sinkhole_upstream_failures_total{upstream="tls://9.9.9.9:853"} 1`,
+		`sinkhole_upstream_healthy{upstream="tls://9.9.9.9:853"} 0`,
+		`sinkhole_blocklist_rules{source="Steven \"Black\""} 1200`,
+		`sinkhole_blocklist_fetch_duration_seconds{source="Steven \"Black\""} 1.5`,
+		`sinkhole_blocklist_fetch_failures_total{source="Steven \"Black\""} 1`,
+		`sinkhole_ipc_calls_total{method="GetStats"} 2`,
+	}
+	for _, line := range want {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Missing %q in:\n%s", line, out)
+		}
+	}
+	if strings.Contains(out, `sinkhole_upstream_failures_total{upstream="1.1.1.1:53"}`) {
+		t.Error("Successful attempts must not count as failures")
+	}
+}
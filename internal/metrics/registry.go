@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"0x53/internal/core"
+)
+
+// Registry holds the daemon metrics. Query, upstream and IPC metrics are fed
+// as they happen (it is a core.QuerySink, an exchange observer and an IPC
+// call counter); cache and blocklist metrics are read when scraped.
+type Registry struct {
+	eng   core.Engine
+	lists core.BlocklistManager
+
+	queries          *counterVec
+	queryLatency     *histogramVec
+	upstreamLatency  *histogramVec
+	upstreamFailures *counterVec
+	ipcCalls         *counterVec
+}
+
+// New returns a registry reading scrape-time metrics from eng and lists.
+func New(eng core.Engine, lists core.BlocklistManager) *Registry {
+	return &Registry{
+		eng:   eng,
+		lists: lists,
+
+		queries: newCounterVec("sinkhole_queries_total",
+			"DNS queries by query type, result and client group.", "type", "status", "group"),
+		queryLatency: newHistogramVec("sinkhole_query_duration_seconds",
+			"Time to answer DNS queries, by result.", "status"),
+		upstreamLatency: newHistogramVec("sinkhole_upstream_request_duration_seconds",
+			"Round-trip time of upstream attempts, failed ones included.", "upstream"),
+		upstreamFailures: newCounterVec("sinkhole_upstream_failures_total",
+			"Upstream attempts that failed or answered SERVFAIL/REFUSED.", "upstream"),
+		ipcCalls: newCounterVec("sinkhole_ipc_calls_total",
+			"Calls received on the control socket, by method.", "method"),
+	}
+}
+
+// Record implements core.QuerySink.
+func (r *Registry) Record(ev core.QueryEvent) {
+	r.queries.inc(ev.Type, string(ev.Status), ev.Group)
+	r.queryLatency.observe(ev.Latency, string(ev.Status))
+}
+
+// ObserveExchange records one upstream attempt, see dns.Server.SetExchangeObserver.
+func (r *Registry) ObserveExchange(upstream string, rtt time.Duration, ok bool) {
+	r.upstreamLatency.observe(rtt, upstream)
+	if !ok {
+		r.upstreamFailures.inc(upstream)
+	}
+}
+
+// CountIPC records a control socket call, e.g. "Sinkhole.GetStats".
+func (r *Registry) CountIPC(method string) {
+	r.ipcCalls.inc(strings.TrimPrefix(method, "Sinkhole."))
+}
+
+// Write writes every metric in the Prometheus text format.
+func (r *Registry) Write(w io.Writer) {
+	r.queries.write(w)
+	r.queryLatency.write(w)
+
+	stats := r.eng.Stats()
+	writeSamples(w, "sinkhole_cache_hits_total", "Queries answered from the response cache.", "counter",
+		[]sample{{value: float64(stats.CacheHits)}})
+	writeSamples(w, "sinkhole_cache_misses_total", "Cacheable queries sent upstream.", "counter",
+		[]sample{{value: float64(stats.CacheMisses)}})
+	writeSamples(w, "sinkhole_cache_entries", "Answers in the response cache.", "gauge",
+		[]sample{{value: float64(stats.CacheEntries)}})
+
+	r.upstreamLatency.write(w)
+	r.upstreamFailures.write(w)
+	var healthy []sample
+	for _, u := range r.eng.UpstreamStats() {
+		up := 0.0
+		if u.Healthy {
+			up = 1
+		}
+		healthy = append(healthy, sample{labels: []string{"upstream", u.Address}, value: up})
+	}
+	writeSamples(w, "sinkhole_upstream_healthy", "1 unless the upstream is sidelined after repeated failures.", "gauge", healthy)
+
+	var rules, durations, failures []sample
+	for _, st := range r.lists.SourceStats() {
+		labels := []string{"source", st.Name}
+		rules = append(rules, sample{labels: labels, value: float64(st.Rules)})
+		durations = append(durations, sample{labels: labels, value: st.FetchDuration.Seconds()})
+		failures = append(failures, sample{labels: labels, value: float64(st.Failures)})
+	}
+	writeSamples(w, "sinkhole_blocklist_rules", "Domains or networks loaded from each blocklist source.", "gauge", rules)
+	writeSamples(w, "sinkhole_blocklist_fetch_duration_seconds", "Duration of the last fetch of each source.", "gauge", durations)
+	writeSamples(w, "sinkhole_blocklist_fetch_failures_total", "Failed fetches of each source.", "counter", failures)
+
+	r.ipcCalls.write(w)
+}
+
+// ServeHTTP serves the metrics to a scraper.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	r.Write(bw)
+	bw.Flush()
+}
+
+// Serve exposes r on addr under /metrics. Close the returned server to stop.
+func Serve(addr string, r *Registry) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go srv.Serve(ln)
+	return srv, nil
+}
@@ -78,6 +78,38 @@ func (l *LinuxConfigurator) SetupDNS() error {
 	return nil
 }
 
+// DetectUpstreams returns the resolvers the system used before we took over.
+// Sources are tried in order and the first one with usable entries wins:
+//  1. The resolv.conf backup written by SetupDNS
+//  2. systemd-resolved's per-link servers (resolvectl)
+//  3. systemd-resolved's upstream resolv.conf under /run
+//  4. The current /etc/resolv.conf (before SetupDNS ran)
+func (l *LinuxConfigurator) DetectUpstreams() ([]string, string, error) {
+	if data, err := os.ReadFile("/etc/resolv.conf.orig.sinkhole"); err == nil {
+		if servers := parseResolvConf(data); len(servers) > 0 {
+			return servers, "resolv.conf backup", nil
+		}
+	}
+
+	if out, err := exec.Command("resolvectl", "dns").Output(); err == nil {
+		if servers := parseResolvectlDNS(out); len(servers) > 0 {
+			return servers, "resolvectl", nil
+		}
+	}
+
+	if data, err := os.ReadFile("/run/systemd/resolve/resolv.conf"); err == nil {
+		if servers := parseResolvConf(data); len(servers) > 0 {
+			return servers, "systemd-resolved", nil
+		}
+	}
+
+	if servers := parseResolvConf(readResolvConf()); len(servers) > 0 {
+		return servers, "resolv.conf", nil
+	}
+
+	return nil, "", fmt.Errorf("no system resolvers found")
+}
+
 func (l *LinuxConfigurator) RestoreDNS() error {
 	if os.Geteuid() != 0 {
 		return fmt.Errorf("root privileges required")
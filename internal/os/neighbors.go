@@ -0,0 +1,121 @@
+package os
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// neighborTTL is how long a read of the neighbor table is reused.
+const neighborTTL = 30 * time.Second
+
+// NeighborTable maps LAN addresses to MAC addresses using the system's
+// ARP/neighbor table, so clients can be identified by hardware address.
+type NeighborTable struct {
+	mu      sync.Mutex
+	entries map[string]net.HardwareAddr // By IP string
+	loaded  time.Time
+}
+
+// NewNeighborTable returns an empty table, read on first lookup.
+func NewNeighborTable() *NeighborTable {
+	return &NeighborTable{}
+}
+
+// Lookup returns the MAC address of ip, if it is a known neighbor.
+func (t *NeighborTable) Lookup(ip net.IP) (net.HardwareAddr, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if time.Since(t.loaded) > neighborTTL {
+		t.entries = readNeighbors()
+		t.loaded = time.Now()
+	}
+	mac, ok := t.entries[ip.String()]
+	return mac, ok
+}
+
+// readNeighbors reads the neighbor table of the OS. Errors leave it empty:
+// MAC-based clients then simply do not match.
+func readNeighbors() map[string]net.HardwareAddr {
+	if runtime.GOOS == "windows" {
+		out, _ := exec.Command("arp", "-a").Output()
+		return parseWindowsARP(out)
+	}
+	// `ip neigh` also lists IPv6 neighbors, /proc/net/arp is the fallback
+	if out, err := exec.Command("ip", "neigh", "show").Output(); err == nil {
+		if entries := parseIPNeigh(out); len(entries) > 0 {
+			return entries
+		}
+	}
+	data, _ := os.ReadFile("/proc/net/arp")
+	return parseProcARP(data)
+}
+
+// parseProcARP reads /proc/net/arp:
+//
+//	IP address       HW type     Flags       HW address            Mask     Device
+//	192.168.1.1      0x1         0x2         aa:bb:cc:dd:ee:ff     *        eth0
+func parseProcARP(data []byte) map[string]net.HardwareAddr {
+	entries := make(map[string]net.HardwareAddr)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[2] == "0x0" { // Incomplete entry
+			continue
+		}
+		addNeighbor(entries, fields[0], fields[3])
+	}
+	return entries
+}
+
+// parseIPNeigh reads `ip neigh show` output:
+//
+//	192.168.1.1 dev eth0 lladdr aa:bb:cc:dd:ee:ff REACHABLE
+//	fe80::1 dev eth0 lladdr aa:bb:cc:dd:ee:ff router STALE
+func parseIPNeigh(out []byte) map[string]net.HardwareAddr {
+	entries := make(map[string]net.HardwareAddr)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for i := 1; i < len(fields)-1; i++ {
+			if fields[i] == "lladdr" {
+				addNeighbor(entries, fields[0], fields[i+1])
+				break
+			}
+		}
+	}
+	return entries
+}
+
+// parseWindowsARP reads `arp -a` output:
+//
+//	Internet Address      Physical Address      Type
+//	192.168.1.1           aa-bb-cc-dd-ee-ff     dynamic
+func parseWindowsARP(out []byte) map[string]net.HardwareAddr {
+	entries := make(map[string]net.HardwareAddr)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 {
+			addNeighbor(entries, fields[0], fields[1])
+		}
+	}
+	return entries
+}
+
+// addNeighbor records ip -> mac if both parse and mac is not all zeros.
+func addNeighbor(entries map[string]net.HardwareAddr, ip, mac string) {
+	addr := net.ParseIP(ip)
+	hw, err := net.ParseMAC(mac)
+	if addr == nil || err != nil || bytes.Count(hw, []byte{0}) == len(hw) {
+		return
+	}
+	entries[addr.String()] = hw
+}
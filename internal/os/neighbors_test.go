@@ -0,0 +1,68 @@
+package os
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseNeighbors(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func([]byte) map[string]string
+		input string
+		want  map[string]string
+	}{
+		{
+			name:  "proc",
+			parse: stringify(parseProcARP),
+			input: `IP address       HW type     Flags       HW address            Mask     Device
+192.168.1.1      0x1         0x2         AA:BB:CC:DD:EE:01     *        eth0
+192.168.1.9      0x1         0x0         00:00:00:00:00:00     *        eth0
+`,
+			want: map[string]string{"192.168.1.1": "aa:bb:cc:dd:ee:01"},
+		},
+		{
+			name:  "ip neigh",
+			parse: stringify(parseIPNeigh),
+			input: `192.168.1.20 dev wlan0 lladdr aa:bb:cc:dd:ee:02 REACHABLE
+192.168.1.21 dev wlan0 FAILED
+fe80::1 dev wlan0 lladdr aa:bb:cc:dd:ee:01 router STALE
+`,
+			want: map[string]string{"192.168.1.20": "aa:bb:cc:dd:ee:02", "fe80::1": "aa:bb:cc:dd:ee:01"},
+		},
+		{
+			name:  "windows",
+			parse: stringify(parseWindowsARP),
+			input: `
+Interface: 192.168.1.30 --- 0xb
+  Internet Address      Physical Address      Type
+  192.168.1.1           aa-bb-cc-dd-ee-01     dynamic
+  192.168.1.255         ff-ff-ff-ff-ff-ff     static
+`,
+			want: map[string]string{"192.168.1.1": "aa:bb:cc:dd:ee:01", "192.168.1.255": "ff:ff:ff:ff:ff:ff"},
+		},
+	}
+
+	for _, tt := range tests {
+		got := tt.parse([]byte(tt.input))
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v; want %v", tt.name, got, tt.want)
+			continue
+		}
+		for ip, mac := range tt.want {
+			if got[ip] != mac {
+				t.Errorf("%s: %s = %q; want %q", tt.name, ip, got[ip], mac)
+			}
+		}
+	}
+}
+
+func stringify(parse func([]byte) map[string]net.HardwareAddr) func([]byte) map[string]string {
+	return func(data []byte) map[string]string {
+		out := make(map[string]string)
+		for ip, mac := range parse(data) {
+			out[ip] = mac.String()
+		}
+		return out
+	}
+}
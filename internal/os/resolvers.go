@@ -0,0 +1,58 @@
+package os
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+)
+
+// parseResolvConf extracts the "nameserver" entries of a resolv.conf file.
+func parseResolvConf(data []byte) []string {
+	var servers []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return usableResolvers(servers)
+}
+
+// parseResolvectlDNS extracts server addresses from `resolvectl dns` output:
+//
+//	Global: 1.1.1.1
+//	Link 2 (eth0): 192.168.1.1 fe80::1%eth0
+func parseResolvectlDNS(out []byte) []string {
+	var servers []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		_, list, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		// Only the first colon separates the label, IPv6 addresses contain more
+		servers = append(servers, strings.Fields(list)...)
+	}
+	return usableResolvers(servers)
+}
+
+// usableResolvers drops duplicates, non-IP entries and loopback addresses.
+// Loopback resolvers are either us (after SetupDNS) or the systemd-resolved
+// stub that UnlockPort disables, so forwarding to them would loop.
+func usableResolvers(servers []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, s := range servers {
+		host, _, _ := strings.Cut(s, "#") // resolved's "IP#ServerName" form
+		ipPart, _, _ := strings.Cut(host, "%")
+		ip := net.ParseIP(ipPart)
+		if ip == nil || ip.IsLoopback() || ip.IsUnspecified() || seen[host] {
+			continue
+		}
+		seen[host] = true
+		out = append(out, host)
+	}
+	return out
+}
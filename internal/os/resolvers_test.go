@@ -0,0 +1,35 @@
+package os
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseResolvConf(t *testing.T) {
+	data := []byte(`# Generated by NetworkManager
+search lan
+nameserver 127.0.0.53
+nameserver 192.168.1.1
+nameserver 192.168.1.1
+nameserver fe80::1%wlan0
+options edns0 trust-ad
+nameserver not-an-ip
+`)
+	got := parseResolvConf(data)
+	want := []string{"192.168.1.1", "fe80::1%wlan0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseResolvConf() = %v; want %v", got, want)
+	}
+}
+
+func TestParseResolvectlDNS(t *testing.T) {
+	out := []byte(`Global:
+Link 2 (enp3s0): 10.0.0.1 2001:db8::53
+Link 3 (tun0): 172.16.0.2#vpn.corp 127.0.0.1
+`)
+	got := parseResolvectlDNS(out)
+	want := []string{"10.0.0.1", "2001:db8::53", "172.16.0.2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseResolvectlDNS() = %v; want %v", got, want)
+	}
+}
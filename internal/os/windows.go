@@ -64,6 +64,22 @@ func (w *WindowsConfigurator) RestoreDNS() error {
 	return cmd.Run()
 }
 
+// DetectUpstreams returns the DNS servers configured on the network adapters.
+func (w *WindowsConfigurator) DetectUpstreams() ([]string, string, error) {
+	cmd := exec.Command("powershell", "-Command",
+		"Get-DnsClientServerAddress | Select-Object -ExpandProperty ServerAddresses")
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query DNS servers: %w", err)
+	}
+	servers := usableResolvers(strings.Fields(string(out)))
+	if len(servers) == 0 {
+		return nil, "", fmt.Errorf("no system resolvers found")
+	}
+	return servers, "adapter settings", nil
+}
+
 func (w *WindowsConfigurator) detectInterface() (string, error) {
 	// PowerShell hack to find interface with Default Gateway
 	cmd := exec.Command("powershell", "-Command", 
@@ -0,0 +1,119 @@
+package querylog
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"0x53/internal/core"
+)
+
+const (
+	// fileQueueSize is how many events may wait for the writer before
+	// new ones are dropped, so a slow disk never stalls queries.
+	fileQueueSize = 4096
+	// fileFlushInterval bounds how long an event stays in the write buffer.
+	fileFlushInterval = time.Second
+	// rejectSample is how many refused and throttled events a persistent
+	// sink writes per minute. A probe or flood shows up in the log without
+	// turning every rejected packet into a disk write; all of them are
+	// still counted in core.Stats and the metrics.
+	rejectSample = 60
+)
+
+// rejectSampler picks the refused and throttled events worth writing.
+type rejectSampler struct {
+	mu     sync.Mutex
+	minute int64
+	kept   int
+}
+
+// keep reports whether ev should be written.
+func (r *rejectSampler) keep(ev *core.QueryEvent) bool {
+	if ev.Status != core.StatusRefused && ev.Status != core.StatusThrottled {
+		return true
+	}
+	minute := ev.Time.Unix() / 60
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if minute != r.minute {
+		r.minute, r.kept = minute, 0
+	}
+	r.kept++
+	return r.kept <= rejectSample
+}
+
+// FileSink appends events to a file as JSON lines. It implements core.QuerySink.
+type FileSink struct {
+	f       *os.File
+	queue   chan core.QueryEvent
+	done    chan struct{}
+	dropped uint64
+	rejects rejectSampler
+}
+
+// NewFileSink opens (or creates) path for appending and starts the writer.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileSink{
+		f:     f,
+		queue: make(chan core.QueryEvent, fileQueueSize),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Record queues ev, dropping it if the writer is too far behind. Refused
+// and throttled queries are sampled, see rejectSample.
+func (s *FileSink) Record(ev core.QueryEvent) {
+	if !s.rejects.keep(&ev) {
+		return
+	}
+	select {
+	case s.queue <- ev:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// Dropped returns how many events were lost to a full queue.
+func (s *FileSink) Dropped() int {
+	return int(atomic.LoadUint64(&s.dropped))
+}
+
+// Close flushes the queued events and closes the file. Record must not be
+// called afterwards.
+func (s *FileSink) Close() error {
+	close(s.queue)
+	<-s.done
+	return s.f.Close()
+}
+
+func (s *FileSink) run() {
+	defer close(s.done)
+
+	w := bufio.NewWriter(s.f)
+	enc := json.NewEncoder(w)
+	ticker := time.NewTicker(fileFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev, ok := <-s.queue:
+			if !ok {
+				w.Flush()
+				return
+			}
+			enc.Encode(ev)
+		case <-ticker.C:
+			w.Flush()
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package querylog
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"0x53/internal/core"
+)
+
+func TestRing_Query(t *testing.T) {
+	r := NewRing(3)
+	base := time.Unix(1000, 0)
+	events := []core.QueryEvent{
+		{Time: base, Client: "192.168.1.2", Domain: "old.example", Status: core.StatusAllowed},
+		{Time: base.Add(1 * time.Second), Client: "192.168.1.2", Domain: "ads.example", Status: core.StatusBlocked},
+		{Time: base.Add(2 * time.Second), Client: "192.168.1.3", Domain: "nas.lan", Status: core.StatusLocal},
+		{Time: base.Add(3 * time.Second), Client: "192.168.1.2", Domain: "news.example", Status: core.StatusAllowed},
+	}
+	for _, ev := range events {
+		r.Record(ev)
+	}
+
+	got := r.Query(core.QueryFilter{})
+	if len(got) != 3 || got[0].Domain != "news.example" || got[2].Domain != "ads.example" {
+		t.Fatalf("Expected the 3 newest events, newest first, got %v", got)
+	}
+
+	tests := []struct {
+		filter core.QueryFilter
+		want   []string
+	}{
+		{core.QueryFilter{Client: "192.168.1.2"}, []string{"news.example", "ads.example"}},
+		{core.QueryFilter{Domain: "EXAMPLE", Limit: 1}, []string{"news.example"}},
+		{core.QueryFilter{Status: core.StatusLocal}, []string{"nas.lan"}},
+		{core.QueryFilter{Since: base.Add(2 * time.Second)}, []string{"news.example", "nas.lan"}},
+	}
+	for _, tt := range tests {
+		got := r.Query(tt.filter)
+		if len(got) != len(tt.want) {
+			t.Errorf("Query(%+v) = %v; want %v", tt.filter, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i].Domain != tt.want[i] {
+				t.Errorf("Query(%+v)[%d] = %s; want %s", tt.filter, i, got[i].Domain, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.jsonl")
+	s, err := NewFileSink(path)
+	if err != nil {
+		t.Fatalf("NewFileSink: %v", err)
+	}
+	s.Record(core.QueryEvent{Domain: "a.example", Status: core.StatusAllowed, Latency: time.Millisecond})
+	s.Record(core.QueryEvent{Domain: "b.example", Status: core.StatusBlocked, Rule: "EasyList"})
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var got []core.QueryEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev core.QueryEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("Invalid line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, ev)
+	}
+	if len(got) != 2 || got[1].Rule != "EasyList" || got[0].Latency != time.Millisecond {
+		t.Errorf("Unexpected events read back: %+v", got)
+	}
+}
+
+func TestRejectSampler(t *testing.T) {
+	var r rejectSampler
+	now := time.Now()
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		if r.keep(&core.QueryEvent{Time: now, Status: core.StatusThrottled}) {
+			kept++
+		}
+	}
+	if kept != rejectSample {
+		t.Errorf("Kept %d throttled events in a minute; want %d", kept, rejectSample)
+	}
+	if !r.keep(&core.QueryEvent{Time: now, Status: core.StatusAllowed}) {
+		t.Error("Answered queries must always be kept")
+	}
+	if !r.keep(&core.QueryEvent{Time: now.Add(time.Minute), Status: core.StatusRefused}) {
+		t.Error("Expected the sample to restart the next minute")
+	}
+}
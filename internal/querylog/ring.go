@@ -0,0 +1,62 @@
+// Package querylog provides sinks for the query events of the engine.
+package querylog
+
+import (
+	"sync"
+
+	"0x53/internal/core"
+)
+
+// Ring keeps the last events in memory, for the TUI and the CLI.
+// It implements core.QuerySink.
+type Ring struct {
+	mu     sync.RWMutex
+	events []core.QueryEvent
+	next   int  // Slot of the next event
+	full   bool // The buffer wrapped around at least once
+}
+
+// NewRing returns a ring holding up to size events.
+func NewRing(size int) *Ring {
+	if size < 1 {
+		size = 1
+	}
+	return &Ring{events: make([]core.QueryEvent, size)}
+}
+
+// Record stores ev, evicting the oldest event when full.
+func (r *Ring) Record(ev core.QueryEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events[r.next] = ev
+	r.next++
+	if r.next == len(r.events) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// Query returns the events matching f, newest first.
+func (r *Ring) Query(f core.QueryFilter) []core.QueryEvent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	n := r.next
+	if r.full {
+		n = len(r.events)
+	}
+
+	var out []core.QueryEvent
+	for i := 1; i <= n; i++ {
+		ev := r.events[(r.next-i+len(r.events))%len(r.events)]
+		if !f.Match(ev) {
+			continue
+		}
+		out = append(out, ev)
+		if f.Limit > 0 && len(out) == f.Limit {
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,529 @@
+package querylog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"0x53/internal/core"
+)
+
+const (
+	// segmentSpan is the time range covered by one segment file.
+	segmentSpan = time.Hour
+	// segmentLayout names segment files after their UTC start hour.
+	segmentLayout = "20060102-15"
+	segmentExt    = ".jsonl"
+
+	// defaultHistoryLimit is the page size of queries without a limit.
+	defaultHistoryLimit = 100
+	// maxBatch bounds how many queued events are written at once.
+	maxBatch = 512
+	// maxLoadedIndexes bounds how many segment indexes are kept in memory;
+	// the least recently loaded one is dropped first and re-read from its
+	// file when queried again. The segment being written is always kept.
+	maxLoadedIndexes = 24
+)
+
+// Store is the persistent query history: events are appended as JSON lines
+// to one segment file per hour, and segments older than the retention are
+// deleted. Each segment has an in-memory index of its records by domain,
+// client and status, built when the segment is first written or queried,
+// for up to maxLoadedIndexes segments.
+// It implements core.QuerySink.
+type Store struct {
+	dir       string
+	retention time.Duration
+
+	mu       sync.RWMutex
+	segments []*segment // Sorted by start, oldest first
+	loaded   []*segment // Segments with an index, least recently loaded first
+
+	queue   chan core.QueryEvent
+	done    chan struct{}
+	dropped uint64
+	rejects rejectSampler
+
+	// Owned by the writer goroutine
+	cur *segment
+	f   *os.File
+}
+
+type segment struct {
+	start   time.Time
+	path    string
+	index   *segmentIndex // nil until loaded
+	writing bool          // Written to, its index must stay loaded
+}
+
+// segmentIndex locates the records of a segment. Record i spans
+// offsets[i]:offsets[i+1] in the file; the lists hold record numbers in
+// file order. Slices are only appended to, so copies taken under the
+// store's read lock stay valid.
+type segmentIndex struct {
+	offsets  []int64
+	byDomain map[string][]int32
+	byClient map[string][]int32
+	byStatus map[core.QueryStatus][]int32
+}
+
+// indexedFields is the part of a record the index needs.
+type indexedFields struct {
+	Domain string
+	Client string
+	Status core.QueryStatus
+}
+
+// OpenStore opens the history in dir, creating it if needed, and starts
+// the writer. Segments older than retention are deleted every hour.
+func OpenStore(dir string, retention time.Duration) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		dir:       dir,
+		retention: retention,
+		queue:     make(chan core.QueryEvent, fileQueueSize),
+		done:      make(chan struct{}),
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		start, err := time.Parse(segmentLayout, strings.TrimSuffix(name, segmentExt))
+		if err != nil {
+			continue // Not ours
+		}
+		s.segments = append(s.segments, &segment{start: start, path: filepath.Join(dir, name)})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].start.Before(s.segments[j].start) })
+
+	s.expire(time.Now())
+	go s.run()
+	return s, nil
+}
+
+// Record queues ev, dropping it if the writer is too far behind. Refused
+// and throttled queries are sampled, see rejectSample.
+func (s *Store) Record(ev core.QueryEvent) {
+	if !s.rejects.keep(&ev) {
+		return
+	}
+	select {
+	case s.queue <- ev:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// Dropped returns how many events were lost to a full queue.
+func (s *Store) Dropped() int {
+	return int(atomic.LoadUint64(&s.dropped))
+}
+
+// Close writes the queued events and closes the store. Record must not be
+// called afterwards.
+func (s *Store) Close() error {
+	close(s.queue)
+	<-s.done
+	if s.f != nil {
+		return s.f.Close()
+	}
+	return nil
+}
+
+func (s *Store) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(segmentSpan)
+	defer ticker.Stop()
+
+	batch := make([]core.QueryEvent, 0, maxBatch)
+	for {
+		select {
+		case ev, ok := <-s.queue:
+			if !ok {
+				return
+			}
+			batch = append(batch[:0], ev)
+			// Take what else is waiting, written with one syscall per segment
+		drain:
+			for len(batch) < maxBatch {
+				select {
+				case ev, ok := <-s.queue:
+					if !ok {
+						break drain
+					}
+					batch = append(batch, ev)
+				default:
+					break drain
+				}
+			}
+			s.write(batch)
+		case now := <-ticker.C:
+			s.expire(now)
+		}
+	}
+}
+
+// write appends events to their segments, then indexes them.
+func (s *Store) write(events []core.QueryEvent) {
+	for len(events) > 0 {
+		start := events[0].Time.UTC().Truncate(segmentSpan)
+		n := 1
+		for n < len(events) && events[n].Time.UTC().Truncate(segmentSpan).Equal(start) {
+			n++
+		}
+		s.append(start, events[:n])
+		events = events[n:]
+	}
+}
+
+// append writes events, all starting in the hour at start, to its segment.
+func (s *Store) append(start time.Time, events []core.QueryEvent) {
+	if err := s.open(start); err != nil {
+		atomic.AddUint64(&s.dropped, uint64(len(events)))
+		return
+	}
+
+	var buf []byte
+	fields := make([]indexedFields, len(events))
+	ends := make([]int, len(events))
+	for i, ev := range events {
+		line, err := json.Marshal(ev)
+		if err != nil {
+			ends[i] = -1
+			continue
+		}
+		buf = append(append(buf, line...), '\n')
+		fields[i] = indexedFields{Domain: ev.Domain, Client: ev.Client, Status: ev.Status}
+		ends[i] = len(buf)
+	}
+	if _, err := s.f.Write(buf); err != nil {
+		atomic.AddUint64(&s.dropped, uint64(len(events)))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := s.cur.index
+	base := idx.offsets[len(idx.offsets)-1]
+	for i := range events {
+		if ends[i] < 0 {
+			continue // Not encodable
+		}
+		idx.add(base+int64(ends[i]), fields[i])
+	}
+}
+
+// open makes the segment starting at start the one written to, creating it
+// if needed.
+func (s *Store) open(start time.Time) error {
+	if s.cur != nil && s.cur.start.Equal(start) {
+		return nil
+	}
+	if s.f != nil {
+		s.f.Close()
+		s.mu.Lock()
+		s.cur.writing = false
+		s.evict()
+		s.mu.Unlock()
+		s.f, s.cur = nil, nil
+	}
+
+	s.mu.Lock()
+	seg := s.find(start)
+	if seg == nil {
+		seg = &segment{start: start, path: filepath.Join(s.dir, start.Format(segmentLayout)+segmentExt)}
+	}
+	seg.writing = true
+	s.mu.Unlock()
+	fail := func(err error) error {
+		s.mu.Lock()
+		seg.writing = false
+		s.mu.Unlock()
+		return err
+	}
+
+	idx, err := s.load(seg)
+	if err != nil {
+		return fail(err)
+	}
+
+	f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fail(err)
+	}
+	// Cut a record left half-written by a crash, it would corrupt the next one
+	end := idx.offsets[len(idx.offsets)-1]
+	if err := f.Truncate(end); err != nil {
+		f.Close()
+		return fail(err)
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		f.Close()
+		return fail(err)
+	}
+
+	s.mu.Lock()
+	if s.find(start) == nil {
+		s.segments = append(s.segments, seg)
+		sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].start.Before(s.segments[j].start) })
+	}
+	s.mu.Unlock()
+
+	s.f, s.cur = f, seg
+	return nil
+}
+
+// find returns the segment starting at start. Caller must hold s.mu.
+func (s *Store) find(start time.Time) *segment {
+	for _, seg := range s.segments {
+		if seg.start.Equal(start) {
+			return seg
+		}
+	}
+	return nil
+}
+
+// load returns the index of seg, reading the segment file the first time.
+func (s *Store) load(seg *segment) (*segmentIndex, error) {
+	s.mu.RLock()
+	idx := seg.index
+	s.mu.RUnlock()
+	if idx != nil {
+		return idx, nil
+	}
+
+	idx = newSegmentIndex()
+	f, err := os.Open(seg.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		defer f.Close()
+		r := bufio.NewReader(f)
+		var end int64
+		for {
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				break // EOF, a trailing partial line is ignored
+			}
+			end += int64(len(line))
+			var fields indexedFields
+			if json.Unmarshal(line, &fields) != nil {
+				// Keep the offsets right, the record just matches no index
+				idx.offsets = append(idx.offsets, end)
+				continue
+			}
+			idx.add(end, fields)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seg.index == nil { // Unless a concurrent load won
+		seg.index = idx
+		s.loaded = append(s.loaded, seg)
+		s.evict()
+	}
+	return seg.index, nil
+}
+
+// evict drops the least recently loaded indexes past maxLoadedIndexes,
+// except the one being written. Caller must hold s.mu.
+func (s *Store) evict() {
+	for len(s.loaded) > maxLoadedIndexes {
+		i := slices.IndexFunc(s.loaded, func(seg *segment) bool { return !seg.writing })
+		if i < 0 {
+			return
+		}
+		s.loaded[i].index = nil
+		s.loaded = slices.Delete(s.loaded, i, i+1)
+	}
+}
+
+// expire deletes the segments that ended before the retention period.
+func (s *Store) expire(now time.Time) {
+	if s.retention <= 0 {
+		return
+	}
+	cutoff := now.Add(-s.retention)
+
+	s.mu.Lock()
+	var old []*segment
+	kept := s.segments[:0]
+	for _, seg := range s.segments {
+		if seg.start.Add(segmentSpan).Before(cutoff) && seg != s.cur {
+			old = append(old, seg)
+			continue
+		}
+		kept = append(kept, seg)
+	}
+	s.segments = kept
+	for _, seg := range old {
+		seg.index = nil
+	}
+	s.loaded = slices.DeleteFunc(s.loaded, func(seg *segment) bool { return seg.index == nil })
+	s.mu.Unlock()
+
+	for _, seg := range old {
+		os.Remove(seg.path)
+	}
+}
+
+// Query returns a page of the events matching q, newest first.
+func (s *Store) Query(q core.HistoryQuery) (core.HistoryPage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+
+	s.mu.RLock()
+	var segs []*segment
+	for i := len(s.segments) - 1; i >= 0; i-- {
+		seg := s.segments[i]
+		if (!q.To.IsZero() && !seg.start.Before(q.To)) ||
+			(!q.From.IsZero() && !seg.start.Add(segmentSpan).After(q.From)) {
+			continue
+		}
+		segs = append(segs, seg)
+	}
+	s.mu.RUnlock()
+
+	var page core.HistoryPage
+	for _, seg := range segs {
+		if err := s.scan(seg, q, limit, &page); err != nil {
+			return page, err
+		}
+	}
+	return page, nil
+}
+
+// scan adds the matches of q in seg to page, newest first.
+func (s *Store) scan(seg *segment, q core.HistoryQuery, limit int, page *core.HistoryPage) error {
+	idx, err := s.load(seg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	offsets := idx.offsets
+	records, exact := idx.candidates(q)
+	s.mu.RUnlock()
+	n := len(offsets) - 1
+	count := len(records)
+	if records == nil {
+		count = n
+	}
+	// A range fully covering the segment filters nothing
+	if (!q.From.IsZero() && seg.start.Before(q.From)) || (!q.To.IsZero() && seg.start.Add(segmentSpan).After(q.To)) || q.Search != "" {
+		exact = false
+	}
+
+	f, err := os.Open(seg.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // Expired meanwhile
+		}
+		return err
+	}
+	defer f.Close()
+
+	var line []byte
+	for i := count - 1; i >= 0; i-- {
+		r := int32(i)
+		if records != nil {
+			r = records[i]
+		}
+		if int(r) >= n {
+			continue
+		}
+		// Every candidate matches, only read the ones on the page
+		wanted := page.Total >= q.Offset && len(page.Events) < limit
+		if exact && !wanted {
+			page.Total++
+			continue
+		}
+
+		start, end := offsets[r], offsets[r+1]
+		if cap(line) < int(end-start) {
+			line = make([]byte, end-start)
+		}
+		line = line[:end-start]
+		if _, err := f.ReadAt(line, start); err != nil {
+			return err
+		}
+		var ev core.QueryEvent
+		if json.Unmarshal(line, &ev) != nil || !q.Match(ev) {
+			continue
+		}
+		if wanted {
+			page.Events = append(page.Events, ev)
+		}
+		page.Total++
+	}
+	return nil
+}
+
+func newSegmentIndex() *segmentIndex {
+	return &segmentIndex{
+		offsets:  []int64{0},
+		byDomain: make(map[string][]int32),
+		byClient: make(map[string][]int32),
+		byStatus: make(map[core.QueryStatus][]int32),
+	}
+}
+
+// add indexes the record ending at end. Caller must hold the store's lock.
+func (idx *segmentIndex) add(end int64, fields indexedFields) {
+	r := int32(len(idx.offsets) - 1)
+	idx.offsets = append(idx.offsets, end)
+	idx.byDomain[fields.Domain] = append(idx.byDomain[fields.Domain], r)
+	idx.byClient[fields.Client] = append(idx.byClient[fields.Client], r)
+	idx.byStatus[fields.Status] = append(idx.byStatus[fields.Status], r)
+}
+
+// candidates returns the records that may match q: the shortest index list
+// of the fields q sets, or nil for all of them. exact reports whether every
+// candidate matches the indexed fields of q. Caller must hold the store's
+// read lock.
+func (idx *segmentIndex) candidates(q core.HistoryQuery) (records []int32, exact bool) {
+	var lists [][]int32
+	if q.Domain != "" {
+		lists = append(lists, idx.byDomain[strings.ToLower(q.Domain)])
+	}
+	if q.Client != "" {
+		lists = append(lists, idx.byClient[q.Client])
+	}
+	if q.Status != "" {
+		lists = append(lists, idx.byStatus[q.Status])
+	}
+	if len(lists) == 0 {
+		return nil, true
+	}
+	records = lists[0]
+	for _, l := range lists[1:] {
+		if len(l) < len(records) {
+			records = l
+		}
+	}
+	if records == nil {
+		records = []int32{} // No record has the value
+	}
+	return records, len(lists) == 1
+}
@@ -0,0 +1,196 @@
+package querylog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"0x53/internal/core"
+)
+
+func TestStore_Query(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenStore(dir, 0)
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+
+	// Three hours of queries from two clients
+	base := time.Date(2026, 10, 15, 13, 0, 0, 0, time.UTC)
+	for i := 0; i < 180; i++ {
+		ev := core.QueryEvent{
+			Time:     base.Add(time.Duration(i) * time.Minute),
+			Client:   "192.168.1.20",
+			Domain:   "news.example",
+			Status:   core.StatusAllowed,
+			Upstream: "1.1.1.1:53",
+		}
+		if i%3 == 0 {
+			ev.Client = "192.168.1.30"
+		}
+		if i%10 == 0 {
+			ev.Domain, ev.Status, ev.Rule = "ads.example", core.StatusBlocked, "EasyList"
+		}
+		s.Record(ev)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if n := len(s.segments); n != 3 {
+		t.Fatalf("Expected 3 hourly segments, got %d", n)
+	}
+
+	// Reopen: the indexes are rebuilt from disk
+	s, err = OpenStore(dir, 0)
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name  string
+		query core.HistoryQuery
+		total int
+		first time.Time // Newest event of the page
+	}{
+		{"all", core.HistoryQuery{}, 180, base.Add(179 * time.Minute)},
+		{"client", core.HistoryQuery{Client: "192.168.1.30"}, 60, base.Add(177 * time.Minute)},
+		{"status", core.HistoryQuery{Status: core.StatusBlocked}, 18, base.Add(170 * time.Minute)},
+		{"domain and client", core.HistoryQuery{Domain: "ADS.example", Client: "192.168.1.30"}, 6, base.Add(150 * time.Minute)},
+		{"search", core.HistoryQuery{Search: "easylist"}, 18, base.Add(170 * time.Minute)},
+		{"range", core.HistoryQuery{From: base.Add(60 * time.Minute), To: base.Add(90 * time.Minute)}, 30, base.Add(89 * time.Minute)},
+		{"range and status", core.HistoryQuery{From: base.Add(30 * time.Minute), To: base.Add(120 * time.Minute), Status: core.StatusBlocked}, 9, base.Add(110 * time.Minute)},
+		{"page", core.HistoryQuery{Client: "192.168.1.20", Offset: 10, Limit: 5}, 120, base.Add(164 * time.Minute)},
+		{"no match", core.HistoryQuery{Client: "10.0.0.1"}, 0, time.Time{}},
+	}
+	for _, tt := range tests {
+		page, err := s.Query(tt.query)
+		if err != nil {
+			t.Fatalf("%s: Query: %v", tt.name, err)
+		}
+		if page.Total != tt.total {
+			t.Errorf("%s: Total = %d; want %d", tt.name, page.Total, tt.total)
+		}
+		if tt.total == 0 {
+			continue
+		}
+		if len(page.Events) == 0 || !page.Events[0].Time.Equal(tt.first) {
+			t.Errorf("%s: Expected the page to start at %s, got %v", tt.name, tt.first, page.Events)
+			continue
+		}
+		for i := 1; i < len(page.Events); i++ {
+			if page.Events[i].Time.After(page.Events[i-1].Time) {
+				t.Errorf("%s: Expected newest first, got %v", tt.name, page.Events)
+				break
+			}
+		}
+	}
+
+	if page, _ := s.Query(core.HistoryQuery{Client: "192.168.1.20", Limit: 5}); len(page.Events) != 5 {
+		t.Errorf("Expected a page of 5 events, got %d", len(page.Events))
+	}
+}
+
+func TestStore_Retention(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC()
+	old := filepath.Join(dir, now.Add(-50*time.Hour).Format(segmentLayout)+segmentExt)
+	recent := filepath.Join(dir, now.Add(-2*time.Hour).Format(segmentLayout)+segmentExt)
+	for _, path := range []string{old, recent} {
+		if err := os.WriteFile(path, []byte(`{"Domain":"a.example"}`+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := OpenStore(dir, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	defer s.Close()
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("Expected the segment past retention to be deleted")
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("Expected the recent segment to be kept: %v", err)
+	}
+	if page, _ := s.Query(core.HistoryQuery{}); page.Total != 1 {
+		t.Errorf("Expected 1 event left, got %d", page.Total)
+	}
+}
+
+func TestStore_PartialRecord(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().UTC().Truncate(segmentSpan)
+	path := filepath.Join(dir, start.Format(segmentLayout)+segmentExt)
+	// A crash left the second record half-written
+	if err := os.WriteFile(path, []byte(`{"Domain":"a.example"}`+"\n"+`{"Domain":"b.ex`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := OpenStore(dir, 0)
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	s.Record(core.QueryEvent{Time: start.Add(time.Second), Domain: "c.example"})
+	s.Close()
+
+	s, _ = OpenStore(dir, 0)
+	defer s.Close()
+	page, err := s.Query(core.HistoryQuery{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if page.Total != 2 || page.Events[0].Domain != "c.example" || page.Events[1].Domain != "a.example" {
+		t.Errorf("Expected the partial record to be dropped, got %v", page.Events)
+	}
+}
+
+func TestStore_IndexEviction(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenStore(dir, 0)
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	base := time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC)
+	const hours = maxLoadedIndexes + 6
+	for i := 0; i < hours; i++ {
+		s.Record(core.QueryEvent{Time: base.Add(time.Duration(i) * time.Hour), Domain: "a.example", Status: core.StatusAllowed})
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s, err = OpenStore(dir, 0)
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	defer s.Close()
+	for i := 0; i < 2; i++ {
+		page, err := s.Query(core.HistoryQuery{Domain: "a.example"})
+		if err != nil || page.Total != hours {
+			t.Fatalf("Query %d: %d events, %v; want %d", i, page.Total, err, hours)
+		}
+	}
+	s.mu.RLock()
+	loaded := len(s.loaded)
+	s.mu.RUnlock()
+	if loaded > maxLoadedIndexes {
+		t.Errorf("%d indexes loaded; want at most %d", loaded, maxLoadedIndexes)
+	}
+
+	// Pruned segments take their index with them
+	s.retention = 4 * time.Hour
+	s.expire(base.Add(hours * time.Hour))
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.segments) > 5 {
+		t.Errorf("Expected old segments pruned, %d left", len(s.segments))
+	}
+	for _, seg := range s.loaded {
+		if s.find(seg.start) == nil {
+			t.Errorf("The index of pruned segment %s is still loaded", seg.start)
+		}
+	}
+}
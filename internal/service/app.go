@@ -3,11 +3,14 @@ package service
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"0x53/internal/config"
 	"0x53/internal/core"
+	"0x53/internal/querylog"
+	"0x53/internal/timeseries"
 )
 
 // AppService implements core.Service.
@@ -20,6 +23,10 @@ type AppService struct {
 	logLines []string
 	logMu    sync.RWMutex
 	logLimit int
+
+	queries *querylog.Ring    // Recent query events
+	history *querylog.Store   // Persistent query history, nil if disabled
+	series  *timeseries.Store // Query counters over time, nil if unavailable
 }
 
 // NewAppService creates a new service instance.
@@ -29,6 +36,7 @@ func NewAppService(eng core.Engine, mgr core.BlocklistManager) *AppService {
 		manager:  mgr,
 		logLines: make([]string, 0, 1000),
 		logLimit: 200, // Keep last 200 lines in memory for TUI
+		queries:  querylog.NewRing(1000),
 	}
 	return svc
 }
@@ -51,10 +59,35 @@ func (s *AppService) Log(msg string) {
 }
 
 // GetStats returns combined metrics.
-func (s *AppService) GetStats() (int, int, int, error) {
-	q, b := s.engine.Stats()
-	r := s.manager.Stats()
-	return q, b, r, nil
+func (s *AppService) GetStats() (core.Stats, error) {
+	st := s.engine.Stats()
+	st.ActiveRules = s.manager.Stats()
+	return st, nil
+}
+
+func (s *AppService) GetUpstreamStats() ([]core.UpstreamStats, error) {
+	return s.engine.UpstreamStats(), nil
+}
+
+func (s *AppService) GetLatencyStats() (core.LatencyStats, error) {
+	return s.engine.LatencyStats(), nil
+}
+
+// SetStatsSeries sets the store answering GetStatsSeries.
+func (s *AppService) SetStatsSeries(ts *timeseries.Store) {
+	s.series = ts
+}
+
+// GetStatsSeries returns the query counters kept by the statistics store.
+func (s *AppService) GetStatsSeries(from, to time.Time, step time.Duration) (core.StatsSeries, error) {
+	if s.series == nil {
+		return core.StatsSeries{}, fmt.Errorf("statistics history is unavailable")
+	}
+	return s.series.Series(from, to, step)
+}
+
+func (s *AppService) GetTopStats(window time.Duration, n int) (core.TopStats, error) {
+	return s.engine.TopStats(window, n), nil
 }
 
 // Blocklist Management
@@ -81,15 +114,44 @@ func (s *AppService) ListAllowed() ([]string, error) {
 	return s.manager.ListAllowed(), nil
 }
 
-func (s *AppService) Reload() error {
+func (s *AppService) AddBlocked(domain string) error {
+	s.Log(fmt.Sprintf("Blocking domain: %s", domain))
+	return s.manager.AddBlocked(domain)
+}
+
+func (s *AppService) RemoveBlocked(domain string) error {
+	s.Log(fmt.Sprintf("Removing blocked domain: %s", domain))
+	return s.manager.RemoveBlocked(domain)
+}
+
+func (s *AppService) ListBlocked() ([]string, error) {
+	return s.manager.ListBlocked(), nil
+}
+
+func (s *AppService) Reload() (core.ReloadResult, error) {
 	s.Log("Reloading configuration and blocklists...")
-	// TODO: Reload config from disk
+	res, err := s.engine.Reload()
+	if err != nil {
+		s.Log(fmt.Sprintf("Reload failed: %v", err))
+		return res, err
+	}
+	switch {
+	case res.Path == "":
+		s.Log("No configuration file, settings unchanged")
+	case len(res.Changed) == 0:
+		s.Log(fmt.Sprintf("Configuration %s unchanged", res.Path))
+	default:
+		s.Log(fmt.Sprintf("Configuration %s changed: %s", res.Path, strings.Join(res.Changed, ", ")))
+	}
+	if len(res.Restart) > 0 {
+		s.Log(fmt.Sprintf("Restart to apply: %s", strings.Join(res.Restart, ", ")))
+	}
 	if err := s.manager.LoadBlocklists(context.Background()); err != nil {
 		s.Log(fmt.Sprintf("Reload failed: %v", err))
-		return err
+		return res, err
 	}
 	s.Log("Reload complete.")
-	return nil
+	return res, nil
 }
 
 // Logs
@@ -107,17 +169,99 @@ func (s *AppService) GetRecentLogs(count int) ([]string, error) {
 	return dst, nil
 }
 
+// Record implements core.QuerySink, keeping the event for GetQueryEvents.
+func (s *AppService) Record(ev core.QueryEvent) {
+	s.queries.Record(ev)
+}
+
+func (s *AppService) GetQueryEvents(filter core.QueryFilter) ([]core.QueryEvent, error) {
+	return s.queries.Query(filter), nil
+}
+
+// SetHistory sets the store answering QueryHistory.
+func (s *AppService) SetHistory(h *querylog.Store) {
+	s.history = h
+}
+
+func (s *AppService) QueryHistory(q core.HistoryQuery) (core.HistoryPage, error) {
+	if s.history == nil {
+		return core.HistoryPage{}, fmt.Errorf("query history is disabled (query_history_days is 0)")
+	}
+	return s.history.Query(q)
+}
+
 // Local Records
-func (s *AppService) AddLocalRecord(domain, ip string) error {
-	s.Log(fmt.Sprintf("Adding Local Record: %s -> %s", domain, ip))
-	return s.engine.AddLocalRecord(domain, ip)
+func (s *AppService) AddLocalRecord(rec config.LocalRecord) error {
+	s.Log(fmt.Sprintf("Adding Local Record: %s %s -> %s", rec.Domain, rec.Type, rec.Value))
+	return s.engine.AddLocalRecord(rec)
 }
 
-func (s *AppService) RemoveLocalRecord(domain string) error {
-	s.Log(fmt.Sprintf("Removing Local Record: %s", domain))
-	return s.engine.RemoveLocalRecord(domain)
+func (s *AppService) RemoveLocalRecord(rec config.LocalRecord) error {
+	s.Log(fmt.Sprintf("Removing Local Record: %s %s", rec.Domain, rec.Type))
+	return s.engine.RemoveLocalRecord(rec)
 }
 
-func (s *AppService) ListLocalRecords() (map[string]string, error) {
+func (s *AppService) ListLocalRecords() ([]config.LocalRecord, error) {
 	return s.engine.ListLocalRecords(), nil
 }
+
+func (s *AppService) ImportHosts(opts core.HostsImportOptions) (core.HostsImportResult, error) {
+	res, err := s.engine.ImportHosts(opts)
+	switch {
+	case err != nil:
+		s.Log(fmt.Sprintf("Hosts import from %s failed: %v", res.Path, err))
+	case opts.Unlink && !opts.DryRun:
+		s.Log(fmt.Sprintf("Unlinked hosts file %s", res.Path))
+	case !opts.DryRun && !opts.Unlink:
+		s.Log(fmt.Sprintf("Imported %d local records from %s (%d conflicts)", len(res.Added), res.Path, len(res.Conflicts)))
+	}
+	return res, err
+}
+
+// Conditional Forwarding
+func (s *AppService) AddForwardRule(rule config.ForwardRule) error {
+	s.Log(fmt.Sprintf("Adding Forward Rule: %s -> %s", rule.Domain, strings.Join(rule.Upstreams, ", ")))
+	return s.engine.AddForwardRule(rule)
+}
+
+func (s *AppService) RemoveForwardRule(domain string) error {
+	s.Log(fmt.Sprintf("Removing Forward Rule: %s", domain))
+	return s.engine.RemoveForwardRule(domain)
+}
+
+func (s *AppService) ListForwardRules() ([]config.ForwardRule, error) {
+	return s.engine.ListForwardRules(), nil
+}
+
+// Client Groups
+func (s *AppService) AddClientGroup(group config.ClientGroup) error {
+	s.Log(fmt.Sprintf("Adding Client Group: %s (%s)", group.Name, strings.Join(group.Clients, ", ")))
+	if err := s.engine.AddClientGroup(group); err != nil {
+		return err
+	}
+	s.reloadBlocklists()
+	return nil
+}
+
+func (s *AppService) RemoveClientGroup(name string) error {
+	s.Log(fmt.Sprintf("Removing Client Group: %s", name))
+	if err := s.engine.RemoveClientGroup(name); err != nil {
+		return err
+	}
+	s.reloadBlocklists()
+	return nil
+}
+
+func (s *AppService) ListClientGroups() ([]config.ClientGroup, error) {
+	return s.engine.ListClientGroups(), nil
+}
+
+// reloadBlocklists reloads the blocklists in the background, so that the
+// group policies and the sources they use are recompiled.
+func (s *AppService) reloadBlocklists() {
+	go func() {
+		if err := s.manager.LoadBlocklists(context.Background()); err != nil {
+			s.Log(fmt.Sprintf("Blocklist reload failed: %v", err))
+		}
+	}()
+}
@@ -0,0 +1,321 @@
+// Package timeseries keeps query counters over time: per-minute buckets,
+// rolled up into hourly and daily ones, stored in fixed-size ring files so
+// the history survives restarts in a bounded amount of disk space.
+package timeseries
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"0x53/internal/core"
+)
+
+const (
+	// flushInterval is how often counters are written out; a crash loses
+	// at most this much.
+	flushInterval = 10 * time.Second
+
+	// recordSize is the size of a bucket on disk: its start in Unix
+	// seconds, then one uint64 per counter, little endian.
+	recordSize = 8 + 8*numCounters
+
+	// maxPoints bounds the length of a series, the step is widened to fit.
+	maxPoints = 4096
+)
+
+// Counter indexes.
+const (
+	queries = iota
+	blocked
+	cached
+	errored
+	numCounters
+)
+
+type counts [numCounters]uint64
+
+func (c *counts) add(o *counts) {
+	for i := range c {
+		c[i] += o[i]
+	}
+}
+
+// resolution is one ring: a bucket of span per slot, slots buckets kept.
+type resolution struct {
+	file  string
+	span  time.Duration
+	slots int64
+}
+
+// resolutions go from the finest to the coarsest. Buckets are aligned on
+// Unix time, so days are UTC days.
+var resolutions = []resolution{
+	{"minutes.ring", time.Minute, 2 * 24 * 60}, // Two days
+	{"hours.ring", time.Hour, 90 * 24},         // 90 days
+	{"days.ring", 24 * time.Hour, 3 * 366},     // Three years
+}
+
+// ring is a resolution's file. Slot i holds the bucket whose start is
+// congruent to i; a slot holding another start is an empty bucket.
+type ring struct {
+	res resolution
+	f   *os.File
+}
+
+func (r *ring) span() int64 { return int64(r.res.span / time.Second) }
+
+// oldest returns the start of the oldest bucket still held at now.
+func (r *ring) oldest(now time.Time) time.Time {
+	return now.Truncate(r.res.span).Add(-time.Duration(r.res.slots-1) * r.res.span)
+}
+
+// offset returns where the bucket starting at start is stored.
+func (r *ring) offset(start int64) int64 {
+	return (start / r.span()) % r.res.slots * recordSize
+}
+
+// read returns the n buckets from start, at most a full ring.
+func (r *ring) read(start int64, n int64) ([]counts, error) {
+	out := make([]counts, n)
+	buf := make([]byte, n*recordSize)
+	// The range wraps around the end of the file at most once
+	first := r.offset(start)
+	head := min(int64(len(buf)), r.res.slots*recordSize-first)
+	if err := readFull(r.f, buf[:head], first); err != nil {
+		return nil, err
+	}
+	if err := readFull(r.f, buf[head:], 0); err != nil {
+		return nil, err
+	}
+
+	span := r.span()
+	for i := range out {
+		rec := buf[i*recordSize : (i+1)*recordSize]
+		if int64(binary.LittleEndian.Uint64(rec)) != start+int64(i)*span {
+			continue // Stale or never written
+		}
+		for c := range out[i] {
+			out[i][c] = binary.LittleEndian.Uint64(rec[8+8*c:])
+		}
+	}
+	return out, nil
+}
+
+// add adds c to the bucket starting at start.
+func (r *ring) add(start int64, c *counts) error {
+	cur, err := r.read(start, 1)
+	if err != nil {
+		return err
+	}
+	cur[0].add(c)
+
+	var rec [recordSize]byte
+	binary.LittleEndian.PutUint64(rec[:], uint64(start))
+	for i, v := range cur[0] {
+		binary.LittleEndian.PutUint64(rec[8+8*i:], v)
+	}
+	_, err = r.f.WriteAt(rec[:], r.offset(start))
+	return err
+}
+
+// readFull reads len(buf) bytes at off; bytes past the end of the file,
+// never written yet, read as zeros.
+func readFull(f *os.File, buf []byte, off int64) error {
+	n, err := f.ReadAt(buf, off)
+	if errors.Is(err, io.EOF) {
+		clear(buf[n:])
+		return nil
+	}
+	return err
+}
+
+// Store records query counters. It implements core.QuerySink.
+type Store struct {
+	rings []*ring
+
+	mu      sync.Mutex
+	pending map[int64]*counts // Not yet written, by minute start
+
+	io   sync.Mutex // Held while the rings are written or read
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Open opens the rings in dir, creating them if needed, and starts
+// flushing counters every flushInterval.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		pending: make(map[int64]*counts),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, res := range resolutions {
+		f, err := os.OpenFile(filepath.Join(dir, res.file), os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			s.closeFiles()
+			return nil, err
+		}
+		s.rings = append(s.rings, &ring{res: res, f: f})
+	}
+	go s.run()
+	return s, nil
+}
+
+// Record counts ev in the bucket of its minute. Refused and throttled
+// queries are left out, as in core.Stats.
+func (s *Store) Record(ev core.QueryEvent) {
+	if ev.Status == core.StatusRefused || ev.Status == core.StatusThrottled {
+		return
+	}
+	minute := ev.Time.Unix() / 60 * 60
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.pending[minute]
+	if c == nil {
+		c = &counts{}
+		s.pending[minute] = c
+	}
+	c[queries]++
+	switch ev.Status {
+	case core.StatusBlocked:
+		c[blocked]++
+	case core.StatusError:
+		c[errored]++
+	}
+	if ev.Cached {
+		c[cached]++
+	}
+}
+
+// Close writes the pending counters and closes the rings. Record must not
+// be called afterwards.
+func (s *Store) Close() error {
+	close(s.stop)
+	<-s.done
+	err := s.flush()
+	if cerr := s.closeFiles(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *Store) closeFiles() error {
+	var err error
+	for _, r := range s.rings {
+		if cerr := r.f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (s *Store) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// flush adds the pending minutes to every ring, which rolls them up.
+func (s *Store) flush() error {
+	s.io.Lock()
+	defer s.io.Unlock()
+
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[int64]*counts)
+	s.mu.Unlock()
+
+	var err error
+	for minute, c := range pending {
+		for _, r := range s.rings {
+			start := minute - minute%r.span()
+			if werr := r.add(start, c); err == nil {
+				err = werr
+			}
+		}
+	}
+	return err
+}
+
+// Series returns the counters from from to to, one point per step. It uses
+// the finest resolution still holding from, and step is rounded up to a
+// multiple of it; a zero step is the resolution itself. A zero to is now.
+func (s *Store) Series(from, to time.Time, step time.Duration) (core.StatsSeries, error) {
+	now := time.Now()
+	if to.IsZero() || to.After(now) {
+		to = now
+	}
+
+	r := s.rings[len(s.rings)-1]
+	for _, cand := range s.rings {
+		if !from.Before(cand.oldest(now)) {
+			r = cand
+			break
+		}
+	}
+	span := r.res.span
+	if oldest := r.oldest(now); from.Before(oldest) {
+		from = oldest // Older buckets are gone
+	}
+	from = from.Truncate(span)
+	if !to.After(from) {
+		return core.StatsSeries{Step: max(step, span)}, nil
+	}
+
+	// Buckets per point, widened to keep the series bounded
+	per := max(1, int64((step+span-1)/span))
+	buckets := int64((to.Sub(from) + span - 1) / span)
+	if buckets/per > maxPoints {
+		per = (buckets + maxPoints - 1) / maxPoints
+	}
+	buckets = (buckets + per - 1) / per * per
+
+	s.io.Lock()
+	defer s.io.Unlock()
+	start := from.Unix()
+	data, err := r.read(start, min(buckets, r.res.slots))
+	if err != nil {
+		return core.StatsSeries{}, err
+	}
+	data = append(data, make([]counts, buckets-int64(len(data)))...)
+	s.mu.Lock()
+	for minute, c := range s.pending {
+		if i := (minute - minute%r.span() - start) / r.span(); minute >= start && i < buckets {
+			data[i].add(c)
+		}
+	}
+	s.mu.Unlock()
+
+	series := core.StatsSeries{Step: time.Duration(per) * span}
+	for i := int64(0); i < buckets; i += per {
+		var sum counts
+		for _, c := range data[i : i+per] {
+			sum.add(&c)
+		}
+		series.Points = append(series.Points, core.StatsPoint{
+			Time:    time.Unix(start+i*r.span(), 0),
+			Queries: int(sum[queries]),
+			Blocked: int(sum[blocked]),
+			Cached:  int(sum[cached]),
+			Errors:  int(sum[errored]),
+		})
+	}
+	return series, nil
+}
@@ -0,0 +1,101 @@
+package timeseries
+
+import (
+	"testing"
+	"time"
+
+	"0x53/internal/core"
+)
+
+// total sums the points of a series.
+func total(series core.StatsSeries) core.StatsPoint {
+	var sum core.StatsPoint
+	for _, p := range series.Points {
+		sum.Queries += p.Queries
+		sum.Blocked += p.Blocked
+		sum.Cached += p.Cached
+		sum.Errors += p.Errors
+	}
+	return sum
+}
+
+func TestStore_Series(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	now := time.Now()
+	s.Record(core.QueryEvent{Time: now.Add(-3 * time.Minute), Status: core.StatusAllowed})
+	s.Record(core.QueryEvent{Time: now.Add(-3 * time.Minute), Status: core.StatusBlocked})
+	s.Record(core.QueryEvent{Time: now.Add(-time.Minute), Status: core.StatusAllowed, Cached: true})
+	s.Record(core.QueryEvent{Time: now.Add(-time.Minute), Status: core.StatusError})
+	s.Record(core.QueryEvent{Time: now, Status: core.StatusRefused})
+	s.Record(core.QueryEvent{Time: now.Add(-30 * time.Hour), Status: core.StatusBlocked})
+	want := core.StatsPoint{Queries: 4, Blocked: 1, Cached: 1, Errors: 1}
+
+	// Pending counters are visible before being written
+	series, err := s.Series(now.Add(-10*time.Minute), time.Time{}, 0)
+	if err != nil {
+		t.Fatalf("Series: %v", err)
+	}
+	if series.Step != time.Minute || len(series.Points) < 10 || len(series.Points) > 11 {
+		t.Errorf("Expected 10 or 11 one-minute points, got %d of %s", len(series.Points), series.Step)
+	}
+	if got := total(series); got != want {
+		t.Errorf("Pending total = %+v, want %+v", got, want)
+	}
+
+	// Counters survive a restart
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if s, err = Open(dir); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	series, _ = s.Series(now.Add(-10*time.Minute), time.Time{}, 5*time.Minute)
+	if series.Step != 5*time.Minute || len(series.Points) > 3 {
+		t.Errorf("Expected 5m points, got %d of %s", len(series.Points), series.Step)
+	}
+	if got := total(series); got != want {
+		t.Errorf("Reopened total = %+v, want %+v", got, want)
+	}
+
+	// Ranges older than the minute ring are read from the hourly rollup
+	series, _ = s.Series(now.Add(-72*time.Hour), time.Time{}, 0)
+	want.Queries++
+	want.Blocked++
+	if series.Step != time.Hour {
+		t.Errorf("Expected hourly points, got %s", series.Step)
+	}
+	if got := total(series); got != want {
+		t.Errorf("Hourly total = %+v, want %+v", got, want)
+	}
+	series, _ = s.Series(time.Time{}, time.Time{}, 0)
+	if series.Step != 24*time.Hour || total(series) != want {
+		t.Errorf("Expected the daily rollup to hold %+v, got %+v in %s steps", want, total(series), series.Step)
+	}
+}
+
+func TestStore_StaleSlot(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	// Two days ago, in the minute slot that now reuses
+	now := time.Now()
+	s.Record(core.QueryEvent{Time: now.Add(-48 * time.Hour), Status: core.StatusAllowed})
+	s.flush()
+	s.Record(core.QueryEvent{Time: now, Status: core.StatusAllowed})
+	defer s.Close()
+	s.flush()
+
+	series, _ := s.Series(now.Add(-time.Minute), time.Time{}, 0)
+	if got := total(series).Queries; got != 1 {
+		t.Errorf("Expected the stale bucket to be replaced, got %d queries", got)
+	}
+}
@@ -2,10 +2,13 @@ package ui
 
 import (
 	"fmt"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"0x53/internal/config"
 	"0x53/internal/core"
 
 	"github.com/charmbracelet/bubbles/table"
@@ -41,17 +44,46 @@ var (
 
 type tickMsg time.Time
 
+// tabNames are the menu entries, in tab index order.
+var tabNames = []string{"DASHBOARD", "LISTS", "ALLOW", "LOCAL", "FORWARD", "GROUPS", "QUERIES", "TOP"}
+
+// queryFilters are the statuses the QUERIES tab cycles through, "" shows all.
+var queryFilters = []core.QueryStatus{"", core.StatusBlocked, core.StatusAllowed, core.StatusLocal, core.StatusRebind, core.StatusRefused, core.StatusThrottled, core.StatusError}
+
+// seriesRefresh is how often the dashboard chart is refetched.
+const seriesRefresh = 30 * time.Second
+
+// sparkBlocks draw the dashboard chart, from empty to full.
+var sparkBlocks = []rune(" ▁▂▃▄▅▆▇█")
+
+// topWindows are the windows the TOP tab cycles through.
+var topWindows = []time.Duration{time.Hour, 24 * time.Hour}
+
+// topCount is the number of entries of each TOP tab list.
+const topCount = 10
+
 type Model struct {
 	svc core.Service
 
 	// Stats
-	startTime      time.Time
-	queriesTotal   int
-	queriesBlocked int
+	startTime time.Time
+	stats     core.Stats
+	upstreams []core.UpstreamStats
+	latency   core.LatencyStats
+	series    core.StatsSeries // Last 24 hours, refreshed every seriesRefresh
+	seriesAt  time.Time
 
 	// Logs
 	logLines []string
 
+	// Query Events (newest first) and the index of the status filter
+	queries     []core.QueryEvent
+	queryFilter int
+
+	// Top domains and clients, and the index of the window
+	top       core.TopStats
+	topWindow int
+
 	// View State
 	activeTab  int
 	menuFocus  bool // True if user is navigating the top menu
@@ -64,11 +96,15 @@ type Model struct {
 	inputMode bool
 	inputText string
 
-	// Local Records Table & Form
-	localTable table.Model
-	inputs     []textinput.Model
-	focusIndex int
-	showForm   bool
+	// Local Records Table & Forms
+	localTable    table.Model
+	localRecords  []config.LocalRecord // Rows of localTable, in display order
+	inputs        []textinput.Model // Inputs of the form currently shown
+	localInputs   []textinput.Model
+	forwardInputs []textinput.Model
+	groupInputs   []textinput.Model
+	focusIndex    int
+	showForm      bool
 
 	width  int
 	height int
@@ -77,8 +113,11 @@ type Model struct {
 func NewModel(svc core.Service) Model {
 	// Initialize Table
 	columns := []table.Column{
-		{Title: "IP Address", Width: 20},
-		{Title: "Domain", Width: 40},
+		{Title: "Type", Width: 6},
+		{Title: "Domain", Width: 35},
+		{Title: "Value", Width: 35},
+		{Title: "TTL", Width: 6},
+		{Title: "Source", Width: 12},
 	}
 	t := table.New(
 		table.WithColumns(columns),
@@ -97,19 +136,55 @@ func NewModel(svc core.Service) Model {
 		Bold(false)
 	t.SetStyles(s)
 
-	// Initialize Inputs (0: IP, 1: Domain)
-	inputs := make([]textinput.Model, 2)
-	inputs[0] = textinput.New()
-	inputs[0].Placeholder = "192.168.1.1"
-	inputs[0].CharLimit = 15
-	inputs[0].Width = 20
-	inputs[0].Prompt = "IP: "
+	// Local Record Inputs (0: Domain, 1: Type, 2: Value, 3: TTL, 4: Priority, 5: Weight, 6: Port)
+	localFields := []struct{ prompt, placeholder string }{
+		{"Domain: ", "router.lan or *.dev.lan"},
+		{"Type: ", "A, AAAA, CNAME, TXT, MX or SRV"},
+		{"Value: ", "192.168.1.1"},
+		{"TTL: ", "3600"},
+		{"Priority: ", "MX/SRV only"},
+		{"Weight: ", "SRV only"},
+		{"Port: ", "SRV only"},
+	}
+	inputs := make([]textinput.Model, len(localFields))
+	for i, f := range localFields {
+		inputs[i] = textinput.New()
+		inputs[i].Placeholder = f.placeholder
+		inputs[i].CharLimit = 255
+		inputs[i].Width = 40
+		inputs[i].Prompt = f.prompt
+	}
 
-	inputs[1] = textinput.New()
-	inputs[1].Placeholder = "router.lan"
-	inputs[1].CharLimit = 50
-	inputs[1].Width = 40
-	inputs[1].Prompt = "Domain: "
+	// Forward Rule Inputs (0: Domain, 1: Upstreams)
+	fwdInputs := make([]textinput.Model, 2)
+	fwdInputs[0] = textinput.New()
+	fwdInputs[0].Placeholder = "corp.internal"
+	fwdInputs[0].CharLimit = 100
+	fwdInputs[0].Width = 40
+	fwdInputs[0].Prompt = "Domain: "
+
+	fwdInputs[1] = textinput.New()
+	fwdInputs[1].Placeholder = "10.0.0.1, 10.0.0.2"
+	fwdInputs[1].CharLimit = 200
+	fwdInputs[1].Width = 40
+	fwdInputs[1].Prompt = "Upstreams: "
+
+	// Client Group Inputs (0: Name, 1: Clients, 2: Sources, 3: Allowlist, 4: Blocking Mode)
+	groupFields := []struct{ prompt, placeholder string }{
+		{"Name: ", "kids"},
+		{"Clients: ", "192.168.1.50, 10.0.8.0/24, aa:bb:cc:dd:ee:ff"},
+		{"Sources: ", "Blocklist names, empty for the enabled ones"},
+		{"Allowlist: ", "homework.example"},
+		{"Blocking Mode: ", "null, nxdomain, refused, nodata or custom"},
+	}
+	grpInputs := make([]textinput.Model, len(groupFields))
+	for i, f := range groupFields {
+		grpInputs[i] = textinput.New()
+		grpInputs[i].Placeholder = f.placeholder
+		grpInputs[i].CharLimit = 255
+		grpInputs[i].Width = 40
+		grpInputs[i].Prompt = f.prompt
+	}
 
 	return Model{
 		svc:        svc,
@@ -118,8 +193,11 @@ func NewModel(svc core.Service) Model {
 		activeTab:  0,
 		menuCursor: 0,
 		isLoading:  true,
-		localTable: t,
-		inputs:     inputs,
+		localTable:    t,
+		inputs:        inputs,
+		localInputs:   inputs,
+		forwardInputs: fwdInputs,
+		groupInputs:   grpInputs,
 	}
 }
 
@@ -169,7 +247,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		case tea.KeyRight:
 			if m.menuFocus {
-				m.menuCursor = min(3, m.menuCursor+1)
+				m.menuCursor = min(len(tabNames)-1, m.menuCursor+1)
 			}
 
 		case tea.KeyEnter:
@@ -181,6 +259,12 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if m.activeTab == 3 {
 					m.refreshTable()
 				}
+				if m.activeTab == 6 {
+					m.refreshQueries()
+				}
+				if m.activeTab == 7 {
+					m.refreshTop()
+				}
 			} else if m.inputMode {
 				// Legacy Allowlist Input
 				if m.inputText != "" {
@@ -231,6 +315,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					} else if m.activeTab == 2 {
 						list, _ := m.svc.ListAllowed()
 						limit = len(list)
+					} else if m.activeTab == 4 {
+						rules, _ := m.svc.ListForwardRules()
+						limit = len(rules)
+					} else if m.activeTab == 5 {
+						groups, _ := m.svc.ListClientGroups()
+						limit = len(groups)
+					} else if m.activeTab == 6 {
+						limit = len(m.queries)
+					} else if m.activeTab == 7 {
+						limit = len(m.top.Domains) + len(m.top.Blocked)
 					}
 					if m.listCursor < limit-1 {
 						m.listCursor++
@@ -256,11 +350,46 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if m.activeTab == 2 {
 					m.inputMode = true
 					m.inputText = ""
-				} else if m.activeTab == 3 {
+				} else if m.activeTab >= 3 && m.activeTab <= 5 {
+					switch m.activeTab {
+					case 3:
+						m.inputs = m.localInputs
+					case 4:
+						m.inputs = m.forwardInputs
+					case 5:
+						m.inputs = m.groupInputs
+					}
 					m.showForm = true
 					m.focusIndex = 0
 					m.inputs[0].Focus()
 					return m, textinput.Blink
+				} else if m.activeTab == 7 {
+					// Allow the selected domain
+					if domain, ok := m.selectedTopDomain(); ok {
+						if err := m.svc.AddAllowed(domain); err != nil {
+							m.logLines = append(m.logLines, fmt.Sprintf("Error allowing %s: %v", domain, err))
+						}
+					}
+				}
+			case "b":
+				if m.activeTab == 7 {
+					// Block the selected domain
+					if domain, ok := m.selectedTopDomain(); ok {
+						if err := m.svc.AddBlocked(domain); err != nil {
+							m.logLines = append(m.logLines, fmt.Sprintf("Error blocking %s: %v", domain, err))
+						}
+					}
+				}
+			case "w":
+				if m.activeTab == 7 {
+					m.topWindow = (m.topWindow + 1) % len(topWindows)
+					m.refreshTop()
+				}
+			case "f":
+				if m.activeTab == 6 {
+					m.queryFilter = (m.queryFilter + 1) % len(queryFilters)
+					m.listCursor = 0
+					m.refreshQueries()
 				}
 			case "d":
 				if m.activeTab == 2 {
@@ -271,12 +400,26 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					}
 				} else if m.activeTab == 3 {
 					// Delete Local Record
-					sel := m.localTable.SelectedRow()
-					if len(sel) > 1 {
-						// sel[1] is Domain because Columns are IP, Domain
-						m.svc.RemoveLocalRecord(sel[1])
+					if i := m.localTable.Cursor(); i >= 0 && i < len(m.localRecords) {
+						if err := m.svc.RemoveLocalRecord(m.localRecords[i]); err != nil {
+							m.logLines = append(m.logLines, fmt.Sprintf("Error removing local record: %v", err))
+						}
 						m.refreshTable()
 					}
+				} else if m.activeTab == 4 {
+					// Delete Forward Rule
+					rules, _ := m.svc.ListForwardRules()
+					if m.listCursor < len(rules) {
+						m.svc.RemoveForwardRule(rules[m.listCursor].Domain)
+					}
+				} else if m.activeTab == 5 {
+					// Delete Client Group
+					groups, _ := m.svc.ListClientGroups()
+					if m.listCursor < len(groups) {
+						if err := m.svc.RemoveClientGroup(groups[m.listCursor].Name); err != nil {
+							m.logLines = append(m.logLines, fmt.Sprintf("Error removing client group: %v", err))
+						}
+					}
 				}
 			}
 		}
@@ -285,25 +428,40 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.width = msg.Width
 		m.height = msg.Height
 		m.resizeContent(msg.Width)
+		m.seriesAt = time.Time{} // Refetch the chart for the new width
 
 	case tickMsg:
 		// ... (Keep Stats/Log Poll logic) ...
-		var activeRules int
-		var err error
-		m.queriesTotal, m.queriesBlocked, activeRules, err = m.svc.GetStats()
+		stats, err := m.svc.GetStats()
 		if err != nil {
 			// If service is down/unreachable
 			m.logLines = append(m.logLines, fmt.Sprintf("Error fetching stats: %v", err))
 		}
 		if err == nil {
-			if m.isLoading && activeRules > 0 {
+			m.stats = stats
+			if m.isLoading && stats.ActiveRules > 0 {
 				m.isLoading = false
 			}
 		}
+		if ups, err := m.svc.GetUpstreamStats(); err == nil {
+			m.upstreams = ups
+		}
+		if lat, err := m.svc.GetLatencyStats(); err == nil {
+			m.latency = lat
+		}
+		if m.activeTab == 0 && time.Since(m.seriesAt) >= seriesRefresh {
+			m.refreshSeries()
+		}
 		newLogs, err := m.svc.GetRecentLogs(50)
 		if err == nil {
 			m.logLines = newLogs
 		}
+		if m.activeTab == 6 {
+			m.refreshQueries()
+		}
+		if m.activeTab == 7 {
+			m.refreshTop()
+		}
 
 		return m, tea.Tick(time.Second, func(t time.Time) tea.Msg { return tickMsg(t) })
 	}
@@ -324,15 +482,11 @@ func (m Model) updateForm(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "enter":
 			if m.focusIndex == len(m.inputs)-1 {
 				// Submit
-				ip := m.inputs[0].Value()
-				domain := m.inputs[1].Value()
-				if ip != "" && domain != "" {
-					m.svc.AddLocalRecord(domain, ip)
-					m.refreshTable()
-				}
+				m.submitForm()
 				// Reset
-				m.inputs[0].SetValue("")
-				m.inputs[1].SetValue("")
+				for i := range m.inputs {
+					m.inputs[i].SetValue("")
+				}
 				m.showForm = false
 				return m, nil
 			}
@@ -369,24 +523,161 @@ func (m Model) updateForm(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+// submitForm saves the values of the form shown for the active tab.
+func (m *Model) submitForm() {
+	switch m.activeTab {
+	case 3:
+		rec := config.LocalRecord{
+			Domain: m.inputs[0].Value(),
+			Type:   m.inputs[1].Value(),
+			Value:  m.inputs[2].Value(),
+		}
+		if rec.Domain == "" || rec.Value == "" {
+			return
+		}
+		var nums [4]uint64
+		for i := range nums {
+			v := strings.TrimSpace(m.inputs[3+i].Value())
+			if v == "" {
+				continue
+			}
+			bits := 16
+			if i == 0 {
+				bits = 32 // TTL
+			}
+			n, err := strconv.ParseUint(v, 10, bits)
+			if err != nil {
+				m.logLines = append(m.logLines, fmt.Sprintf("Invalid number %q: %v", v, err))
+				return
+			}
+			nums[i] = n
+		}
+		rec.TTL = uint32(nums[0])
+		rec.Priority, rec.Weight, rec.Port = uint16(nums[1]), uint16(nums[2]), uint16(nums[3])
+
+		if err := m.svc.AddLocalRecord(rec); err != nil {
+			m.logLines = append(m.logLines, fmt.Sprintf("Error adding local record: %v", err))
+		}
+		m.refreshTable()
+	case 4:
+		domain := m.inputs[0].Value()
+		upstreams := splitList(m.inputs[1].Value())
+		if domain != "" && len(upstreams) > 0 {
+			if err := m.svc.AddForwardRule(config.ForwardRule{Domain: domain, Upstreams: upstreams}); err != nil {
+				m.logLines = append(m.logLines, fmt.Sprintf("Error adding forward rule: %v", err))
+			}
+		}
+	case 5:
+		group := config.ClientGroup{
+			Name:         strings.TrimSpace(m.inputs[0].Value()),
+			Clients:      splitList(m.inputs[1].Value()),
+			Sources:      splitList(m.inputs[2].Value()),
+			Allowlist:    splitList(m.inputs[3].Value()),
+			BlockingMode: config.BlockingMode(strings.TrimSpace(m.inputs[4].Value())),
+		}
+		if group.Name == "" || len(group.Clients) == 0 {
+			return
+		}
+		if err := m.svc.AddClientGroup(group); err != nil {
+			m.logLines = append(m.logLines, fmt.Sprintf("Error adding client group: %v", err))
+		}
+	}
+}
+
+// splitList splits a comma-separated form value, dropping empty entries.
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func (m *Model) refreshTable() {
 	records, _ := m.svc.ListLocalRecords()
-	// Sort by IP for display
-	keys := make([]string, 0, len(records))
-	for k := range records {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
+	// Sort by domain, then type for display
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Domain != records[j].Domain {
+			return records[i].Domain < records[j].Domain
+		}
+		return records[i].Type < records[j].Type
+	})
 
 	rows := []table.Row{}
-	for _, domain := range keys {
-		ip := records[domain]
-		// Columns: IP, Domain
-		rows = append(rows, table.Row{ip, domain})
+	for _, rec := range records {
+		source := "config"
+		if rec.Source != "" {
+			source = filepath.Base(rec.Source)
+		}
+		// Columns: Type, Domain, Value, TTL, Source
+		rows = append(rows, table.Row{rec.Type, rec.Domain, recordValue(rec), strconv.Itoa(int(rec.TTLOrDefault())), source})
 	}
+	m.localRecords = records
 	m.localTable.SetRows(rows)
 }
 
+// recordValue formats the data of rec the way it appears in a zone file.
+func recordValue(rec config.LocalRecord) string {
+	switch rec.Type {
+	case config.RecordMX:
+		return fmt.Sprintf("%d %s", rec.Priority, rec.Value)
+	case config.RecordSRV:
+		return fmt.Sprintf("%d %d %d %s", rec.Priority, rec.Weight, rec.Port, rec.Value)
+	case config.RecordTXT:
+		return strconv.Quote(rec.Value)
+	}
+	return rec.Value
+}
+
+// refreshQueries fetches the latest query events matching the status filter.
+func (m *Model) refreshQueries() {
+	events, err := m.svc.GetQueryEvents(core.QueryFilter{Status: queryFilters[m.queryFilter], Limit: 200})
+	if err != nil {
+		m.logLines = append(m.logLines, fmt.Sprintf("Error fetching queries: %v", err))
+		return
+	}
+	m.queries = events
+}
+
+// refreshSeries fetches the query counters of the last 24 hours, one point
+// per column of the chart.
+func (m *Model) refreshSeries() {
+	m.seriesAt = time.Now()
+	columns := max(1, m.width-sparkLabelWidth-2)
+	step := (24 * time.Hour / time.Duration(columns)).Truncate(time.Minute) + time.Minute
+	series, err := m.svc.GetStatsSeries(time.Now().Add(-24*time.Hour), time.Time{}, step)
+	if err != nil {
+		return // Statistics history unavailable, the chart stays empty
+	}
+	m.series = series
+}
+
+// refreshTop fetches the top domains and clients over the selected window.
+func (m *Model) refreshTop() {
+	top, err := m.svc.GetTopStats(topWindows[m.topWindow], topCount)
+	if err != nil {
+		m.logLines = append(m.logLines, fmt.Sprintf("Error fetching top stats: %v", err))
+		return
+	}
+	m.top = top
+}
+
+// selectedTopDomain returns the domain under the cursor of the TOP tab: the
+// cursor runs through the top domains, then the top blocked domains.
+func (m *Model) selectedTopDomain() (string, bool) {
+	i := m.listCursor
+	if i < len(m.top.Domains) {
+		return m.top.Domains[i].Key, true
+	}
+	i -= len(m.top.Domains)
+	if i < len(m.top.Blocked) {
+		return m.top.Blocked[i].Key, true
+	}
+	return "", false
+}
+
 func (m *Model) toggleCurrentSource() {
 	sources, _ := m.svc.ListSources()
 	if len(sources) > 0 && m.listCursor < len(sources) {
@@ -427,10 +718,9 @@ func (m Model) View() string {
 		Background(lipgloss.Color("#43BF6D")). // Green
 		Padding(0, 1)
 
-	tabs := []string{"DASHBOARD", "LISTS", "ALLOW", "LOCAL"}
-	renderedTabs := make([]string, len(tabs))
+	renderedTabs := make([]string, len(tabNames))
 
-	for i, t := range tabs {
+	for i, t := range tabNames {
 		style := inactiveStyle
 		if m.menuFocus {
 			if m.menuCursor == i {
@@ -446,7 +736,7 @@ func (m Model) View() string {
 	tabStr := lipgloss.JoinHorizontal(lipgloss.Top, renderedTabs...)
 
 	// ... (Rest of resizing logic) ...
-	fixedHeight := 19
+	fixedHeight := 21
 	logHeight := m.height - fixedHeight
 	if logHeight < 5 {
 		logHeight = 5 // Min height
@@ -456,17 +746,27 @@ func (m Model) View() string {
 
 	if m.showForm {
 		// Form View
+		title := "Add Local Record:"
+		switch m.activeTab {
+		case 4:
+			title = "Add Forward Rule:"
+		case 5:
+			title = "Add Client Group (same name replaces it):"
+		}
+		fields := make([]string, len(m.inputs))
+		for i := range m.inputs {
+			fields[i] = m.inputs[i].View()
+		}
 		content = fmt.Sprintf(
-			"Add Local Record:\n\n%s\n\n%s\n\n[ENTER] Next/Submit  [ESC] Cancel",
-			m.inputs[0].View(),
-			m.inputs[1].View(),
+			"%s\n\n%s\n\n[ENTER] Next/Submit  [ESC] Cancel",
+			title,
+			strings.Join(fields, "\n\n"),
 		)
 		// Center it a bit
 		content = lipgloss.Place(m.width, m.height-5, lipgloss.Center, lipgloss.Center, content)
 	} else if m.activeTab == 0 {
 		// --- DASHBOARD VIEW ---
 		uptime := time.Since(m.startTime).Round(time.Second)
-		_, _, blockedCount, _ := m.svc.GetStats()
 		srcs, _ := m.svc.ListSources()
 
 		status := "Running"
@@ -474,28 +774,85 @@ func (m Model) View() string {
 			status = "LOADING..."
 		}
 
+		// Recent latency shows slowdowns, fall back to since startup when idle
+		queryLat, upLat, window := m.latency.RecentQuery, m.latency.RecentUpstream, fmt.Sprintf("%gm", m.latency.Window.Minutes())
+		if queryLat.Count == 0 {
+			queryLat, upLat, window = m.latency.Query, m.latency.Upstream, "all"
+		}
+
 		stats := fmt.Sprintf(
-			"STATUS:  %s\nUPTIME:  %s\nBLOCKED: %d (%d%%)\nTOTAL:   %d",
+			"STATUS:  %s\nUPTIME:  %s\nBLOCKED: %d (%d%%)\nTOTAL:   %d\nREFUSED: %d  THROTTLED: %d\nLATENCY: %s (%s)\nUPSTREAM: %s",
 			status,
 			uptime,
-			m.queriesBlocked,
-			opts(m.queriesTotal, m.queriesBlocked),
-			m.queriesTotal,
+			m.stats.Blocked,
+			opts(m.stats.Queries, m.stats.Blocked),
+			m.stats.Queries,
+			m.stats.Refused,
+			m.stats.Throttled,
+			formatPercentiles(queryLat),
+			window,
+			formatPercentiles(upLat),
 		)
 
 		statsBox := statusStyle.
-			Height(6).
+			Height(8).
 			Width(m.width/2 - 2).
 			Render(stats)
 
-		blStatus := fmt.Sprintf("Active Rules: %d\nSources:      %d", blockedCount, len(srcs))
+		blStatus := fmt.Sprintf(
+			"Active Rules: %d\nSources:      %d\nCache Hits:   %d (%d%%)\nCached:       %d",
+			m.stats.ActiveRules,
+			len(srcs),
+			m.stats.CacheHits,
+			opts(m.stats.CacheHits+m.stats.CacheMisses, m.stats.CacheHits),
+			m.stats.CacheEntries,
+		)
 		blBox := statusStyle.
-			Height(6).
+			Height(8).
 			Width(m.width/2 - 2).
 			Render(blStatus)
 
 		headerBlock := lipgloss.JoinHorizontal(lipgloss.Top, statsBox, blBox)
 
+		// Upstreams
+		upLines := []string{"UPSTREAMS:"}
+		if len(m.upstreams) > 0 {
+			upLines[0] = fmt.Sprintf("UPSTREAMS (%s):", m.upstreams[0].Source)
+		}
+		for _, u := range m.upstreams {
+			state := "UP  "
+			if !u.Healthy {
+				state = "DOWN"
+			}
+			upLines = append(upLines, fmt.Sprintf(
+				"  [%s] %-32s queries: %-7d errors: %-5d avg: %s",
+				state, u.Address, u.Queries, u.Errors, u.AvgLatency.Round(time.Millisecond),
+			))
+		}
+		headerBlock = lipgloss.JoinVertical(lipgloss.Left, headerBlock, strings.Join(upLines, "\n"))
+
+		// Last 24 hours, both lines on the scale of the busiest step
+		var queries, blocked []int
+		peak := 0
+		for _, p := range m.series.Points {
+			queries = append(queries, p.Queries)
+			blocked = append(blocked, p.Blocked)
+			peak = max(peak, p.Queries)
+		}
+		chart := []string{
+			fmt.Sprintf("%-*s%s", sparkLabelWidth, "QUERIES 24h:", sparkline(queries, peak)),
+			fmt.Sprintf("%-*s%s", sparkLabelWidth, "BLOCKED 24h:", sparkline(blocked, peak)),
+		}
+		if m.series.Step > 0 {
+			chart = append(chart, fmt.Sprintf("%-*speak %d per %s", sparkLabelWidth, "", peak, m.series.Step))
+		}
+		headerBlock = lipgloss.JoinVertical(lipgloss.Left, headerBlock, strings.Join(chart, "\n"))
+
+		logHeight -= len(upLines) + len(chart)
+		if logHeight < 5 {
+			logHeight = 5
+		}
+
 		// Log Tail
 		linesToShow := logHeight
 		start := 0
@@ -539,6 +896,9 @@ func (m Model) View() string {
 				checked = "[x]"
 			}
 			line := fmt.Sprintf("%s%s %s (%s)", cursor, checked, src.Name, src.Format)
+			if src.BlockingMode != "" {
+				line += fmt.Sprintf(" [%s]", src.BlockingMode)
+			}
 			if m.listCursor == i {
 				line = headerStyle.Render(line)
 			}
@@ -601,11 +961,225 @@ func (m Model) View() string {
 		// Local Table
 		content = baseTableStyle.Render(m.localTable.View())
 		content += "\n  [A] Add Record  [D] Delete  [R] Soft Reload"
+	} else if m.activeTab == 4 {
+		// --- CONDITIONAL FORWARDING VIEW ---
+		rules, _ := m.svc.ListForwardRules()
+
+		if m.listCursor >= len(rules) {
+			m.listCursor = len(rules) - 1
+		}
+		if m.listCursor < 0 {
+			m.listCursor = 0
+		}
+
+		startRow := 0
+		if m.listCursor >= logHeight {
+			startRow = m.listCursor - logHeight + 1
+		}
+		endRow := startRow + logHeight
+		if endRow > len(rules) {
+			endRow = len(rules)
+		}
+
+		var listRows []string
+		listRows = append(listRows, "  [A] Add Rule  [D] Delete Selected\n")
+
+		if len(rules) == 0 {
+			listRows = append(listRows, "\n  (No forward rules, all queries use the default upstreams)")
+		}
+
+		for i := startRow; i < endRow; i++ {
+			rule := rules[i]
+			cursor := "  "
+			if m.listCursor == i {
+				cursor = "> "
+			}
+			line := fmt.Sprintf("%s%-30s -> %s", cursor, rule.Domain, strings.Join(rule.Upstreams, ", "))
+			if m.listCursor == i {
+				line = headerStyle.Render(line)
+			}
+			listRows = append(listRows, line)
+		}
+		content = strings.Join(listRows, "\n")
+	} else if m.activeTab == 5 {
+		// --- CLIENT GROUPS VIEW ---
+		groups, _ := m.svc.ListClientGroups()
+
+		if m.listCursor >= len(groups) {
+			m.listCursor = len(groups) - 1
+		}
+		if m.listCursor < 0 {
+			m.listCursor = 0
+		}
+
+		startRow := 0
+		if m.listCursor >= logHeight {
+			startRow = m.listCursor - logHeight + 1
+		}
+		endRow := startRow + logHeight
+		if endRow > len(groups) {
+			endRow = len(groups)
+		}
+
+		var listRows []string
+		listRows = append(listRows, "  [A] Add/Replace Group  [D] Delete Selected\n")
+
+		if len(groups) == 0 {
+			listRows = append(listRows, "\n  (No client groups, every client gets the default policy)")
+		}
+
+		for i := startRow; i < endRow; i++ {
+			g := groups[i]
+			cursor := "  "
+			if m.listCursor == i {
+				cursor = "> "
+			}
+			sources := "enabled lists"
+			if len(g.Sources) > 0 {
+				sources = strings.Join(g.Sources, ", ")
+			}
+			line := fmt.Sprintf("%s%-15s %-40s lists: %s", cursor, g.Name, strings.Join(g.Clients, ", "), sources)
+			if len(g.Allowlist) > 0 {
+				line += fmt.Sprintf("  allow: %s", strings.Join(g.Allowlist, ", "))
+			}
+			if g.BlockingMode != "" {
+				line += fmt.Sprintf(" [%s]", g.BlockingMode)
+			}
+			if m.listCursor == i {
+				line = headerStyle.Render(line)
+			}
+			listRows = append(listRows, line)
+		}
+		content = strings.Join(listRows, "\n")
+	} else if m.activeTab == 6 {
+		// --- QUERY LOG VIEW ---
+		if m.listCursor >= len(m.queries) {
+			m.listCursor = len(m.queries) - 1
+		}
+		if m.listCursor < 0 {
+			m.listCursor = 0
+		}
+
+		startRow := 0
+		if m.listCursor >= logHeight {
+			startRow = m.listCursor - logHeight + 1
+		}
+		endRow := startRow + logHeight
+		if endRow > len(m.queries) {
+			endRow = len(m.queries)
+		}
+
+		filter := "all"
+		if f := queryFilters[m.queryFilter]; f != "" {
+			filter = string(f)
+		}
+		var listRows []string
+		listRows = append(listRows, fmt.Sprintf("  [F] Filter: %s\n", filter))
+		listRows = append(listRows, fmt.Sprintf("  %-8s %-15s %-5s %-35s %-16s %-24s %s",
+			"TIME", "CLIENT", "TYPE", "DOMAIN", "STATUS", "RULE/UPSTREAM", "LATENCY"))
+
+		if len(m.queries) == 0 {
+			listRows = append(listRows, "\n  (No queries yet)")
+		}
+
+		for i := startRow; i < endRow; i++ {
+			ev := m.queries[i]
+			cursor := "  "
+			if m.listCursor == i {
+				cursor = "> "
+			}
+			status := string(ev.Status)
+			if ev.Cached {
+				status += " (cache)"
+			}
+			detail := ev.Rule
+			if detail == "" {
+				detail = ev.Upstream
+			}
+			line := fmt.Sprintf("%s%-8s %-15s %-5s %-35s %-16s %-24s %s",
+				cursor, ev.Time.Format("15:04:05"), ev.Client, ev.Type, ev.Domain, status, detail,
+				ev.Latency.Round(time.Millisecond))
+			if m.listCursor == i {
+				line = headerStyle.Render(line)
+			}
+			listRows = append(listRows, line)
+		}
+		content = strings.Join(listRows, "\n")
+	} else if m.activeTab == 7 {
+		// --- TOP VIEW ---
+		selectable := len(m.top.Domains) + len(m.top.Blocked)
+		if m.listCursor >= selectable {
+			m.listCursor = selectable - 1
+		}
+		if m.listCursor < 0 {
+			m.listCursor = 0
+		}
+
+		// Domain lists are selectable, cursor holds the index of their first row
+		renderList := func(title string, entries []core.TopEntry, cursor int) string {
+			rows := []string{headerStyle.Render(title)}
+			if len(entries) == 0 {
+				rows = append(rows, "  (No queries yet)")
+			}
+			for i, e := range entries {
+				count := fmt.Sprintf("%d", e.Count)
+				if e.Error > 0 {
+					count = fmt.Sprintf("~%d", e.Count)
+				}
+				line := fmt.Sprintf("  %-40s %8s", e.Key, count)
+				if cursor >= 0 && m.listCursor == cursor+i {
+					line = headerStyle.Render("> " + line[2:])
+				}
+				rows = append(rows, line)
+			}
+			return strings.Join(rows, "\n")
+		}
+		column := lipgloss.NewStyle().Width(m.width/2 - 2)
+		left := lipgloss.JoinVertical(lipgloss.Left,
+			renderList("TOP DOMAINS", m.top.Domains, 0), "",
+			renderList("TOP CLIENTS", m.top.Clients, -1))
+		right := lipgloss.JoinVertical(lipgloss.Left,
+			renderList("TOP BLOCKED", m.top.Blocked, len(m.top.Domains)), "",
+			renderList("TOP BLOCKED CLIENTS", m.top.BlockedClients, -1))
+
+		window := fmt.Sprintf("%gh", topWindows[m.topWindow].Hours())
+		content = fmt.Sprintf("  [W] Window: %s  [A] Allow domain  [B] Block domain\n\n%s", window,
+			lipgloss.JoinHorizontal(lipgloss.Top, column.Render(left), column.Render(right)))
 	}
 
 	return lipgloss.JoinVertical(lipgloss.Left, header, "\n", tabStr, "\n", content)
 }
 
+// sparkLabelWidth is the width of the labels left of the dashboard chart.
+const sparkLabelWidth = 14
+
+// sparkline renders values as block characters, peak being a full block.
+func sparkline(values []int, peak int) string {
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if peak > 0 {
+			i = (v*(len(sparkBlocks)-1) + peak - 1) / peak // Any activity shows
+		}
+		b.WriteRune(sparkBlocks[i])
+	}
+	return b.String()
+}
+
+// formatPercentiles renders latency percentiles as "p50 1ms p90 12ms p99 80ms".
+func formatPercentiles(p core.Percentiles) string {
+	if p.Count == 0 {
+		return "-"
+	}
+	round := func(d time.Duration) time.Duration {
+		if d < 10*time.Millisecond {
+			return d.Round(10 * time.Microsecond)
+		}
+		return d.Round(time.Millisecond)
+	}
+	return fmt.Sprintf("p50 %s  p90 %s  p99 %s", round(p.P50), round(p.P90), round(p.P99))
+}
+
 func max(a, b int) int {
 	if a > b {
 		return a